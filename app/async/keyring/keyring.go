@@ -0,0 +1,116 @@
+// Package keyring persists each tenant's token signing key ring in Postgres
+// and keeps each process's in-memory copy in sync with it.
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"auth-as-a-service/app/memory/store/signingkey"
+	"auth-as-a-service/app/memory/store/tenant"
+	"auth-as-a-service/sdk/token"
+)
+
+// Load reads every key stored for the tenant into a ring. When no key is
+// current yet, one is generated; the default tenant is bootstrapped from
+// JWT_PRIVATE_KEY_FILE instead if it is set.
+func Load(ctx context.Context, store *signingkey.Store, t tenant.Tenant) (*token.KeyRing, error) {
+	keys, err := list(ctx, store, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if hasCurrent(keys) {
+		return token.NewKeyRing(keys...)
+	}
+
+	k, err := bootstrapKey(t)
+	if err != nil {
+		return nil, err
+	}
+	k.State = token.KeyCurrent
+	if err := Save(ctx, store, t.ID, append(keys, k)); err != nil {
+		// Another instance may have bootstrapped concurrently; use its key.
+		log.Printf("bootstrap signing key for tenant %s: %v", t.Slug, err)
+	}
+
+	if keys, err = list(ctx, store, t.ID); err != nil {
+		return nil, err
+	}
+	return token.NewKeyRing(keys...)
+}
+
+// Reload replaces the keys in ring with those stored for the tenant, so
+// rotations made by the admin command reach every running instance.
+func Reload(ctx context.Context, store *signingkey.Store, tenantID string, ring *token.KeyRing) error {
+	keys, err := list(ctx, store, tenantID)
+	if err != nil {
+		return err
+	}
+	return ring.Replace(keys)
+}
+
+// Save writes the given keys, e.g. a ring snapshot after Rotate or Retire.
+func Save(ctx context.Context, store *signingkey.Store, tenantID string, keys []*token.Key) error {
+	rows := make([]signingkey.SigningKey, 0, len(keys))
+	for _, k := range keys {
+		pemBytes, err := k.MarshalPEM()
+		if err != nil {
+			return err
+		}
+		row := signingkey.SigningKey{
+			ID:         k.ID,
+			Algorithm:  k.Algorithm,
+			PrivateKey: string(pemBytes),
+			State:      string(k.State),
+			CreatedAt:  k.CreatedAt,
+		}
+		if !k.RetiresAt.IsZero() {
+			row.RetiresAt = &k.RetiresAt
+		}
+		rows = append(rows, row)
+	}
+	return store.Save(ctx, tenantID, rows)
+}
+
+func list(ctx context.Context, store *signingkey.Store, tenantID string) ([]*token.Key, error) {
+	rows, err := store.List(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("list signing keys: %w", err)
+	}
+
+	keys := make([]*token.Key, 0, len(rows))
+	for _, row := range rows {
+		k, err := token.ParseKey([]byte(row.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("parse signing key %s: %w", row.ID, err)
+		}
+		if k.ID != row.ID {
+			return nil, fmt.Errorf("signing key %s does not match its stored kid", row.ID)
+		}
+		k.State = token.KeyState(row.State)
+		k.CreatedAt = row.CreatedAt
+		if row.RetiresAt != nil {
+			k.RetiresAt = *row.RetiresAt
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func hasCurrent(keys []*token.Key) bool {
+	for _, k := range keys {
+		if k.State == token.KeyCurrent {
+			return true
+		}
+	}
+	return false
+}
+
+func bootstrapKey(t tenant.Tenant) (*token.Key, error) {
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" && t.Slug == tenant.DefaultSlug {
+		return token.LoadKeyFile(path)
+	}
+	return token.GenerateKey(token.AlgEdDSA)
+}
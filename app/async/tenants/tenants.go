@@ -0,0 +1,198 @@
+// Package tenants keeps every tenant's signing keys, token issuer and
+// verifier, and password policy in memory, and reloads them from Postgres so
+// tenants and key rotations added by the admin command reach every instance.
+package tenants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-as-a-service/app/async/keyring"
+	"auth-as-a-service/app/memory/redis"
+	"auth-as-a-service/app/memory/store/signingkey"
+	"auth-as-a-service/app/memory/store/tenant"
+	"auth-as-a-service/sdk/token"
+)
+
+const defaultRefreshInterval = time.Minute
+
+// PasswordPolicy is what a tenant requires of new passwords.
+type PasswordPolicy struct {
+	MinLength int
+	// CheckBreached rejects passwords found in known data breaches.
+	CheckBreached bool
+}
+
+// Tenant is a loaded tenant, ready to issue and verify tokens.
+type Tenant struct {
+	ID       string
+	Slug     string
+	Keys     *token.KeyRing
+	Issuer   *token.Issuer
+	Verifier *token.Verifier
+	Password PasswordPolicy
+}
+
+// Directory finds loaded tenants by slug or host. It is safe for
+// concurrent use.
+type Directory struct {
+	tenants  *tenant.Store
+	keys     *signingkey.Store
+	cache    redis.Service
+	base     token.Config
+	interval time.Duration
+
+	mu     sync.RWMutex
+	bySlug map[string]*Tenant
+	byHost map[string]*Tenant
+
+	done chan struct{}
+}
+
+// Load reads every tenant and its key ring. base supplies the issuer,
+// audiences, leeway, format and the lifetimes a tenant does not override.
+func Load(ctx context.Context, tenants *tenant.Store, keys *signingkey.Store, cache redis.Service, base token.Config) (*Directory, error) {
+	d := &Directory{
+		tenants:  tenants,
+		keys:     keys,
+		cache:    cache,
+		base:     base,
+		interval: defaultRefreshInterval,
+		bySlug:   map[string]*Tenant{},
+		byHost:   map[string]*Tenant{},
+		done:     make(chan struct{}),
+	}
+	if err := d.reload(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// BySlug returns the tenant with the given slug.
+func (d *Directory) BySlug(slug string) (*Tenant, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.bySlug[slug]
+	return t, ok
+}
+
+// ByHost returns the tenant served on host. Matching ignores case.
+func (d *Directory) ByHost(host string) (*Tenant, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.byHost[strings.ToLower(host)]
+	return t, ok
+}
+
+// Start launches the background reload goroutine.
+func (d *Directory) Start() {
+	go d.run()
+}
+
+// Stop signals the reload goroutine to exit.
+func (d *Directory) Stop() {
+	close(d.done)
+}
+
+func (d *Directory) run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := d.reload(ctx); err != nil {
+				log.Printf("reload tenants: %v", err)
+			}
+			cancel()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// reload rebuilds the directory from the database. A tenant that fails to
+// load keeps its previous state, so one bad key cannot take every tenant down.
+func (d *Directory) reload(ctx context.Context) error {
+	rows, err := d.tenants.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list tenants: %w", err)
+	}
+
+	bySlug := make(map[string]*Tenant, len(rows))
+	byHost := make(map[string]*Tenant, len(rows))
+	var errs []error
+	for _, row := range rows {
+		prev, _ := d.BySlug(row.Slug)
+		t, err := d.build(ctx, row, prev)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", row.Slug, err))
+			if t = prev; t == nil {
+				continue
+			}
+		}
+		bySlug[row.Slug] = t
+		if row.Host != nil {
+			byHost[strings.ToLower(*row.Host)] = t
+		}
+	}
+
+	d.mu.Lock()
+	d.bySlug, d.byHost = bySlug, byHost
+	d.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// build loads a tenant. The key ring of a previously loaded tenant is
+// reloaded in place rather than replaced, since handlers may hold it.
+func (d *Directory) build(ctx context.Context, row tenant.Tenant, prev *Tenant) (*Tenant, error) {
+	var ring *token.KeyRing
+	if prev != nil && prev.ID == row.ID {
+		ring = prev.Keys
+		if err := keyring.Reload(ctx, d.keys, row.ID, ring); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if ring, err = keyring.Load(ctx, d.keys, row); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := Config(d.base, row)
+	cfg.Keys = ring
+
+	return &Tenant{
+		ID:       row.ID,
+		Slug:     row.Slug,
+		Keys:     ring,
+		Issuer:   token.NewIssuer(cfg, d.cache),
+		Verifier: token.NewVerifier(cfg, d.cache),
+		Password: PasswordPolicy{
+			MinLength:     row.PasswordMinLength,
+			CheckBreached: row.PasswordCheckBreached,
+		},
+	}, nil
+}
+
+// Config returns base with the tenant's claim, issuer and lifetime
+// overrides applied. Keys is left as base has it.
+func Config(base token.Config, row tenant.Tenant) token.Config {
+	cfg := base
+	cfg.Tenant = row.ID
+	if row.Issuer != nil {
+		cfg.Issuer = *row.Issuer
+	}
+	if row.AccessTTLSeconds != nil {
+		cfg.AccessTTL = time.Duration(*row.AccessTTLSeconds) * time.Second
+	}
+	if row.RefreshTTLSeconds != nil {
+		cfg.RefreshTTL = time.Duration(*row.RefreshTTLSeconds) * time.Second
+	}
+	return cfg
+}
@@ -0,0 +1,31 @@
+package admin
+
+type userRequest struct {
+	ID string `validate:"required,uuid"`
+}
+
+func (r *userRequest) SetParam(field, value string) error {
+	if field == "id" {
+		r.ID = value
+	}
+	return nil
+}
+
+type userRoleRequest struct {
+	ID   string `validate:"required,uuid"`
+	Role string `validate:"required,max=64"`
+}
+
+func (r *userRoleRequest) SetParam(field, value string) error {
+	switch field {
+	case "id":
+		r.ID = value
+	case "role":
+		r.Role = value
+	}
+	return nil
+}
+
+type rolesResponse struct {
+	Roles []string `json:"roles"`
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	eventStore "auth-as-a-service/app/memory/store/event"
+)
+
+func (h *Handler) listRoles(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeRequest[*userRequest](r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.requireUser(r, req.ID); err != nil {
+		return nil, err
+	}
+	roles, err := h.roles.NamesForUser(r.Context(), tenantMW.From(r.Context()).ID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body:   rolesResponse{Roles: roles},
+	}, nil
+}
+
+// assignRole grants a role. The user's tokens pick it up at their next
+// refresh.
+func (h *Handler) assignRole(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeRequest[*userRoleRequest](r, "id", "role")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.requireUser(r, req.ID); err != nil {
+		return nil, err
+	}
+	if err := h.roles.Assign(r.Context(), tenantMW.From(r.Context()).ID, req.ID, req.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httpkit.ClientErr(http.StatusNotFound, "role not found")
+		}
+		return nil, err
+	}
+
+	h.record(r, eventStore.KindRoleAssigned, req.ID, req.Role)
+	return &httpkit.Response{Status: http.StatusNoContent}, nil
+}
+
+// removeRole takes a role away. Tokens already issued keep it until they
+// are refreshed or expire.
+func (h *Handler) removeRole(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeRequest[*userRoleRequest](r, "id", "role")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.requireUser(r, req.ID); err != nil {
+		return nil, err
+	}
+	if err := h.roles.Remove(r.Context(), tenantMW.From(r.Context()).ID, req.ID, req.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httpkit.ClientErr(http.StatusNotFound, "user does not have this role")
+		}
+		return nil, err
+	}
+
+	h.record(r, eventStore.KindRoleRemoved, req.ID, req.Role)
+	return &httpkit.Response{Status: http.StatusNoContent}, nil
+}
+
+// requireUser checks that the user exists in the request's tenant, so admins
+// of one tenant cannot manage another's users.
+func (h *Handler) requireUser(r *http.Request, id string) error {
+	if _, err := h.users.GetByID(r.Context(), tenantMW.From(r.Context()).ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return httpkit.ClientErr(http.StatusNotFound, "user not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// record logs a role change as a security event. A failure to record does
+// not undo the change.
+func (h *Handler) record(r *http.Request, kind, userID, role string) {
+	err := h.events.Record(r.Context(), eventStore.Event{
+		Kind:      kind,
+		Subject:   userID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail: map[string]string{
+			"role": role,
+			"by":   authMW.ClaimsFrom(r.Context()).Subject,
+		},
+	})
+	if err != nil {
+		log.Printf("record security event %s: %v", kind, err)
+	}
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"auth-as-a-service/app/http/httpkit"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	roleStore "auth-as-a-service/app/memory/store/role"
+	userStore "auth-as-a-service/app/memory/store/user"
+
+	authMW "auth-as-a-service/app/http/middleware/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PermManageRoles is the permission the role management endpoints require.
+const PermManageRoles = "roles:manage"
+
+type Handler struct {
+	users  *userStore.Store
+	roles  *roleStore.Store
+	events *eventStore.Store
+}
+
+func New(users *userStore.Store, roles *roleStore.Store, events *eventStore.Store) *Handler {
+	return &Handler{
+		users:  users,
+		roles:  roles,
+		events: events,
+	}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authMW.RequireAuth())
+		r.Use(authMW.RequirePermission(h.roles, PermManageRoles))
+
+		r.Get("/users/{id}/roles", httpkit.Handle(h.listRoles))
+		r.Put("/users/{id}/roles/{role}", httpkit.Handle(h.assignRole))
+		r.Delete("/users/{id}/roles/{role}", httpkit.Handle(h.removeRole))
+	})
+}
@@ -1,14 +1,19 @@
 package auth
 
 import (
-	"database/sql"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/jackc/pgx/v5/pgconn"
 
 	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	eventStore "auth-as-a-service/app/memory/store/event"
 	"auth-as-a-service/sdk/crypto"
 	"auth-as-a-service/sdk/token"
 )
@@ -19,8 +24,30 @@ func (h *Handler) register(r *http.Request) (*httpkit.Response, error) {
 		return nil, err
 	}
 
-	if err := checkBreachedPassword(req.Password); err != nil {
-		return nil, err
+	// A directory checks its users' passwords, so none may register one
+	// here, least of all before the user first signs in.
+	if _, ok := h.signin.Directory(r, req.Email); ok {
+		return nil, httpkit.FieldError{
+			Code: http.StatusConflict,
+			Fields: map[string][]string{
+				"email": {"is managed by your organization's directory; sign in with your directory password"},
+			},
+		}
+	}
+
+	t := tenantMW.From(r.Context())
+	if len(req.Password) < t.Password.MinLength {
+		return nil, httpkit.FieldError{
+			Code: http.StatusBadRequest,
+			Fields: map[string][]string{
+				"password": {fmt.Sprintf("must be at least %d characters", t.Password.MinLength)},
+			},
+		}
+	}
+	if t.Password.CheckBreached {
+		if err := checkBreachedPassword(req.Password); err != nil {
+			return nil, err
+		}
 	}
 
 	hashPW, err := crypto.HashPassword(req.Password)
@@ -28,7 +55,7 @@ func (h *Handler) register(r *http.Request) (*httpkit.Response, error) {
 		return nil, err
 	}
 
-	user, err := h.users.Create(r.Context(), req.Email, hashPW)
+	user, err := h.users.Create(r.Context(), t.ID, req.Email, hashPW)
 	if err != nil {
 		// TODO: Better SQL default error handling
 		var pgErr *pgconn.PgError
@@ -50,47 +77,88 @@ func (h *Handler) register(r *http.Request) (*httpkit.Response, error) {
 }
 
 func (h *Handler) login(r *http.Request) (*httpkit.Response, error) {
-	req, err := httpkit.DecodeBody[*authRequest](r)
+	req, err := httpkit.DecodeBody[*loginRequest](r)
 	if err != nil {
 		return nil, err
 	}
 
-	user, err := h.users.GetByEmail(r.Context(), req.Email)
+	audience, err := h.resolveAudience(r, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.signin.Authenticate(r, req.Email, req.Password)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, httpkit.ClientErr(http.StatusUnauthorized, "Invalid credentials")
-		}
 		return nil, err
 	}
 
-	doesMatch, err := crypto.VerifyPassword(req.Password, user.PasswordHash)
+	jkt, err := h.dpopThumbprint(r)
 	if err != nil {
 		return nil, err
 	}
 
-	if !doesMatch {
-		return nil, httpkit.ClientErr(http.StatusUnauthorized, "Invalid credentials")
+	return h.signedIn(r, user.ID, audience, req.Scope, jkt)
+}
+
+// signedIn ends every sign-in the user's first factor has passed, a
+// password or an identity provider's word for them. With MFA enabled that
+// only earns a challenge; /auth/mfa/verify issues the tokens.
+func (h *Handler) signedIn(r *http.Request, userID, audience, scope, jkt string) (*httpkit.Response, error) {
+	if resp, ok, err := h.mfaRequired(r, userID, audience, scope); ok || err != nil {
+		return resp, err
+	}
+	return h.issueLogin(r, userID, audience, scope, jkt)
+}
+
+// issueLogin starts a session for userID and returns the token pair every
+// way of signing in ends with.
+func (h *Handler) issueLogin(r *http.Request, userID, audience, scope, jkt string) (*httpkit.Response, error) {
+	family := token.NewFamily()
+	if err := h.sessions.Create(r.Context(), family, userID, r.UserAgent(), httpkit.ClientIP(r)); err != nil {
+		return nil, err
+	}
+
+	// Scopes the user may not have are dropped rather than refused, as
+	// RFC 6749 section 3.3 allows; the response says what was granted.
+	scopes := token.GrantScopes(strings.Fields(scope), h.userScopes)
+
+	roles, err := h.roles.NamesForUser(r.Context(), tenantMW.From(r.Context()).ID, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	accessTok, err := token.Generate(user.ID)
+	claims := token.Claims{
+		Subject:       userID,
+		Family:        family,
+		Audience:      []string{audience},
+		Scopes:        scopes,
+		Roles:         roles,
+		KeyThumbprint: jkt,
+	}
+	accessTok, err := issuer(r).Generate(r.Context(), claims)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshTok, err := token.GenerateRefresh(user.ID)
+	refreshTok, err := issuer(r).GenerateRefresh(r.Context(), claims)
 	if err != nil {
 		return nil, err
 	}
 
 	return &httpkit.Response{
 		Status: http.StatusOK,
-		Body:   loginResponse{AccessToken: accessTok, RefreshToken: refreshTok},
+		Body: loginResponse{
+			AccessToken:  accessTok,
+			RefreshToken: refreshTok,
+			TokenType:    tokenType(jkt),
+			Scope:        strings.Join(scopes, " "),
+		},
 	}, nil
 }
 
 func (h *Handler) logout(r *http.Request) (*httpkit.Response, error) {
-	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	if err := token.Revoke(r.Context(), accessToken, h.redis); err != nil {
+	_, accessToken := authMW.Credentials(r)
+	if err := verifier(r).Revoke(r.Context(), accessToken); err != nil {
 		return nil, err
 	}
 
@@ -99,40 +167,238 @@ func (h *Handler) logout(r *http.Request) (*httpkit.Response, error) {
 		return nil, err
 	}
 
-	if err := token.Revoke(r.Context(), req.RefreshToken, h.redis); err != nil {
+	// End the whole refresh chain so access tokens minted by earlier
+	// rotations stop working too.
+	grant, err := verifier(r).ValidateRefresh(r.Context(), req.RefreshToken)
+	var reuse *token.ReuseError
+	switch {
+	case err == nil:
+		if err := h.endSession(r, grant.Family); err != nil {
+			return nil, err
+		}
+	case errors.As(err, &reuse):
+		h.recordReuse(r, reuse)
+	}
+
+	if err := verifier(r).Revoke(r.Context(), req.RefreshToken); err != nil {
+		if errors.Is(err, token.ErrInvalidToken) {
+			return nil, httpkit.ClientErr(http.StatusBadRequest, "invalid refresh token")
+		}
+		return nil, err
+	}
+
+	return &httpkit.Response{Status: http.StatusNoContent}, nil
+}
+
+// logoutAll signs the user out of every device by invalidating all tokens
+// issued to them so far, including the one on this request. Only the user
+// may do so, not someone acting for them.
+func (h *Handler) logoutAll(r *http.Request) (*httpkit.Response, error) {
+	claims := authMW.ClaimsFrom(r.Context())
+	if claims.Actor != nil {
+		return nil, errEndingForUser
+	}
+	userID := claims.Subject
+	if err := verifier(r).RevokeUser(r.Context(), userID); err != nil {
+		return nil, err
+	}
+	if err := h.sessions.RevokeAllForUser(r.Context(), userID); err != nil {
 		return nil, err
 	}
 
+	err := h.events.Record(r.Context(), eventStore.Event{
+		Kind:      eventStore.KindLogoutAll,
+		Subject:   userID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		log.Printf("record security event: %v", err)
+	}
+
 	return &httpkit.Response{Status: http.StatusNoContent}, nil
 }
 
 func (h *Handler) refresh(r *http.Request) (*httpkit.Response, error) {
-	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	_, tokenString := authMW.Credentials(r)
 	if tokenString == "" {
 		return nil, httpkit.ClientErr(http.StatusUnauthorized, "missing token")
 	}
 
-	userID, err := token.ValidateRefresh(r.Context(), tokenString, h.redis)
+	grant, err := verifier(r).ValidateRefresh(r.Context(), tokenString)
 	if err != nil {
+		var reuse *token.ReuseError
+		if errors.As(err, &reuse) {
+			h.recordReuse(r, reuse)
+		}
 		return nil, httpkit.ClientErr(http.StatusUnauthorized, "invalid or expired refresh token")
 	}
 
-	accessTok, err := token.Generate(userID)
+	// A bound refresh token may only be used by the key it is bound to, and
+	// the tokens it yields stay bound to that key.
+	jkt, err := h.dpopThumbprint(r)
 	if err != nil {
 		return nil, err
 	}
+	if grant.KeyThumbprint != "" && jkt != grant.KeyThumbprint {
+		return nil, httpkit.ClientErr(http.StatusUnauthorized, "DPoP proof does not match the refresh token")
+	}
 
-	refreshTok, err := token.GenerateRefresh(userID)
+	audience := grant.Audience[0]
+	scopes := grant.Scopes
+	if r.Body != http.NoBody {
+		req, err := httpkit.DecodeBody[*refreshRequest](r)
+		if err != nil {
+			return nil, err
+		}
+		if req.Audience != "" {
+			if audience, err = h.resolveAudience(r, req.Audience); err != nil {
+				return nil, err
+			}
+		}
+		if requested := strings.Fields(req.Scope); len(requested) > 0 {
+			for _, s := range requested {
+				if !slices.Contains(grant.Scopes, s) {
+					return nil, httpkit.FieldError{
+						Code: http.StatusBadRequest,
+						Fields: map[string][]string{
+							"scope": {"exceeds the scope originally granted"},
+						},
+					}
+				}
+			}
+			scopes = token.GrantScopes(requested, grant.Scopes)
+		}
+	}
+
+	// Spending the token before issuing the next pair makes concurrent
+	// refreshes with it count as reuse rather than all succeeding.
+	if err := verifier(r).Rotate(r.Context(), tokenString, grant); err != nil {
+		var reuse *token.ReuseError
+		if errors.As(err, &reuse) {
+			h.recordReuse(r, reuse)
+			return nil, httpkit.ClientErr(http.StatusUnauthorized, "invalid or expired refresh token")
+		}
+		return nil, err
+	}
+
+	if err := h.sessions.Touch(r.Context(), grant.Family, httpkit.ClientIP(r)); err != nil {
+		return nil, err
+	}
+
+	// Roles are read afresh so that assignments and removals reach the
+	// user at their next refresh rather than their next login.
+	roles, err := h.roles.NamesForUser(r.Context(), tenantMW.From(r.Context()).ID, grant.Subject)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := token.Revoke(r.Context(), tokenString, h.redis); err != nil {
+	// The rotated pair keeps everything else the grant carried, except that
+	// the audience may change, scopes may narrow and an unbound grant may
+	// become DPoP-bound.
+	claims := token.Claims{
+		Subject:       grant.Subject,
+		Family:        grant.Family,
+		Audience:      []string{audience},
+		Scopes:        scopes,
+		Roles:         roles,
+		Custom:        grant.Custom,
+		KeyThumbprint: jkt,
+	}
+	accessTok, err := issuer(r).Generate(r.Context(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTok, err := issuer(r).GenerateRefresh(r.Context(), claims)
+	if err != nil {
 		return nil, err
 	}
 
 	return &httpkit.Response{
 		Status: http.StatusOK,
-		Body:   refreshResponse{AccessToken: accessTok, RefreshToken: refreshTok},
+		Body: refreshResponse{
+			AccessToken:  accessTok,
+			RefreshToken: refreshTok,
+			TokenType:    tokenType(jkt),
+			Scope:        strings.Join(scopes, " "),
+		},
 	}, nil
 }
+
+// dpopThumbprint verifies the request's DPoP proof, if it has one, and
+// returns the thumbprint of the key the issued tokens should be bound to.
+func (h *Handler) dpopThumbprint(r *http.Request) (string, error) {
+	proofs := r.Header.Values("DPoP")
+	switch len(proofs) {
+	case 0:
+		return "", nil
+	case 1:
+	default:
+		return "", httpkit.ClientErr(http.StatusBadRequest, "invalid DPoP proof")
+	}
+
+	proof, err := verifier(r).VerifyProof(r.Context(), proofs[0], r.Method, httpkit.RequestURL(r), "")
+	if err != nil {
+		return "", httpkit.ClientErr(http.StatusBadRequest, "invalid DPoP proof")
+	}
+	return proof.Thumbprint, nil
+}
+
+// tokenType is the token_type clients must present the access token with.
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// resolveAudience maps a requested audience to the one tokens are issued for.
+func (h *Handler) resolveAudience(r *http.Request, requested string) (string, error) {
+	audience, err := issuer(r).Config().ResolveAudience(requested)
+	if errors.Is(err, token.ErrAudienceNotAllowed) {
+		return "", httpkit.FieldError{
+			Code: http.StatusBadRequest,
+			Fields: map[string][]string{
+				"audience": {"is not allowed"},
+			},
+		}
+	}
+	return audience, err
+}
+
+// recordReuse logs a replayed refresh token. Failing to record must not
+// change the response, which is already a 401.
+func (h *Handler) recordReuse(r *http.Request, reuse *token.ReuseError) {
+	log.Printf("security: refresh token reuse for user %s, family %s revoked", reuse.UserID, reuse.Family)
+
+	if err := h.sessions.Revoke(r.Context(), reuse.Family); err != nil {
+		log.Printf("revoke session %s: %v", reuse.Family, err)
+	}
+
+	err := h.events.Record(r.Context(), eventStore.Event{
+		Kind:      eventStore.KindRefreshReuse,
+		Subject:   reuse.UserID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    map[string]string{"family": reuse.Family, "jti": reuse.TokenID},
+	})
+	if err != nil {
+		log.Printf("record security event: %v", err)
+	}
+}
+
+// record logs a security event. A failure to record does not fail the
+// request.
+func (h *Handler) record(r *http.Request, kind, userID string, detail map[string]string) {
+	err := h.events.Record(r.Context(), eventStore.Event{
+		Kind:      kind,
+		Subject:   userID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	})
+	if err != nil {
+		log.Printf("record security event %s: %v", kind, err)
+	}
+}
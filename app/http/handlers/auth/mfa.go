@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	mfaStore "auth-as-a-service/app/memory/store/mfa"
+	"auth-as-a-service/sdk/totp"
+)
+
+var errActingForUser = httpkit.ClientErr(http.StatusForbidden, "MFA cannot be changed while acting as another user")
+
+// mfaRequired returns the challenge that stands in for the token pair when
+// userID has MFA enabled, and false when they do not.
+func (h *Handler) mfaRequired(r *http.Request, userID, audience, scope string) (*httpkit.Response, bool, error) {
+	tok, ok, err := h.signin.StartMFA(r, userID, signin.PurposeLogin, map[string]string{"audience": audience, "scope": scope})
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body: mfaChallengeResponse{
+			MFARequired: true,
+			MFAToken:    tok,
+			ExpiresIn:   int(signin.ChallengeTTL.Seconds()),
+		},
+	}, true, nil
+}
+
+// mfaVerify completes a login challenged for a second factor with the
+// same token pair /auth/login would have returned.
+func (h *Handler) mfaVerify(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeBody[*mfaVerifyRequest](r)
+	if err != nil {
+		return nil, err
+	}
+	// A bad proof is refused before the challenge is spent on it.
+	jkt, err := h.dpopThumbprint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := h.signin.VerifyMFA(r, req.MFAToken, signin.PurposeLogin, req.Code, req.RecoveryCode)
+	if err != nil {
+		return nil, err
+	}
+	return h.issueLogin(r, c.UserID, c.Data["audience"], c.Data["scope"], jkt)
+}
+
+// mfaEnroll starts a TOTP enrollment for the signed-in user and returns
+// the secret for their authenticator app. The user gives their password
+// again first, so whoever holds only their access token cannot put an
+// authenticator of their own on the account. Nothing changes at login
+// until the enrollment is confirmed; enrolling again replaces an
+// unconfirmed secret.
+func (h *Handler) mfaEnroll(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeBody[*mfaEnrollRequest](r)
+	if err != nil {
+		return nil, err
+	}
+	// Someone acting as the user, such as a support agent, may not change
+	// how the user signs in.
+	claims := authMW.ClaimsFrom(r.Context())
+	if claims.Actor != nil {
+		return nil, errActingForUser
+	}
+	t := tenantMW.From(r.Context())
+	user, err := h.users.GetByID(r.Context(), t.ID, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users who only sign in through an identity provider have no password
+	// to confirm; their provider's second factor covers them.
+	if _, ok := h.signin.Directory(r, user.Email); !ok && !user.HasPassword() {
+		return nil, httpkit.ClientErr(http.StatusForbidden, "MFA enrollment requires a password")
+	}
+	if _, err := h.signin.Authenticate(r, user.Email, req.Password); err != nil {
+		if errors.Is(err, signin.ErrInvalidCredentials) {
+			return nil, httpkit.FieldError{
+				Code:   http.StatusUnauthorized,
+				Fields: map[string][]string{"password": {"is incorrect"}},
+			}
+		}
+		return nil, err
+	}
+
+	secret := totp.NewSecret()
+	if err := h.mfa.Enroll(r.Context(), user.ID, secret); err != nil {
+		if errors.Is(err, mfaStore.ErrEnabled) {
+			return nil, httpkit.ClientErr(http.StatusConflict, "MFA is already enabled")
+		}
+		return nil, err
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Cache-Control": {"no-store"}},
+		Body: mfaEnrollResponse{
+			Secret:     secret,
+			OTPAuthURI: totp.URI(t.Slug, user.Email, secret),
+		},
+	}, nil
+}
+
+// mfaConfirm enables the signed-in user's pending enrollment with a first
+// code from their authenticator and issues their recovery codes.
+func (h *Handler) mfaConfirm(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeBody[*mfaConfirmRequest](r)
+	if err != nil {
+		return nil, err
+	}
+	claims := authMW.ClaimsFrom(r.Context())
+	if claims.Actor != nil {
+		return nil, errActingForUser
+	}
+
+	t, err := h.mfa.Get(r.Context(), claims.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, httpkit.ClientErr(http.StatusNotFound, "No MFA enrollment pending")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, httpkit.ClientErr(http.StatusConflict, "MFA is already enabled")
+	}
+
+	ok, err := h.signin.AcceptTOTP(r.Context(), t, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, httpkit.FieldError{
+			Code:   http.StatusBadRequest,
+			Fields: map[string][]string{"code": {"is not the current code"}},
+		}
+	}
+
+	codes, hashes := signin.NewRecoveryCodes()
+	if err := h.mfa.Confirm(r.Context(), t.UserID, hashes); err != nil {
+		// Another request confirmed it first.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httpkit.ClientErr(http.StatusConflict, "MFA is already enabled")
+		}
+		return nil, err
+	}
+	h.record(r, eventStore.KindMFAEnabled, t.UserID, nil)
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Cache-Control": {"no-store"}},
+		Body:   mfaConfirmResponse{RecoveryCodes: codes},
+	}, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-as-a-service/app/http/signin"
+	mfaStore "auth-as-a-service/app/memory/store/mfa"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/ldap"
+)
+
+// mfaUsers challenges the users it holds and no one else.
+type mfaUsers map[string]bool
+
+func (mfaUsers) Authenticate(*http.Request, string, string) (userStore.User, error) {
+	return userStore.User{}, signin.ErrInvalidCredentials
+}
+
+func (mfaUsers) Directory(*http.Request, string) (*ldap.Directory, bool) { return nil, false }
+
+func (m mfaUsers) StartMFA(_ *http.Request, userID, _ string, _ map[string]string) (string, bool, error) {
+	if !m[userID] {
+		return "", false, nil
+	}
+	return "challenge-" + userID, true, nil
+}
+
+func (mfaUsers) VerifyMFA(*http.Request, string, string, string, string) (signin.Challenge, error) {
+	return signin.Challenge{}, signin.ErrInvalidMFAToken
+}
+
+func (mfaUsers) AcceptTOTP(context.Context, mfaStore.TOTP, string) (bool, error) {
+	return false, nil
+}
+
+// An identity provider's word for the user stands in for their password
+// only: the SAML ACS ends the sign-in as /auth/login does, with the MFA
+// challenge for a user who has MFA enabled.
+func TestSignedInRequiresSecondFactor(t *testing.T) {
+	// Without sessions or roles, issuing tokens would panic.
+	h := &Handler{signin: mfaUsers{"user-mfa": true}}
+	r := httptest.NewRequest(http.MethodPost, "/auth/saml/corp/acs", nil)
+
+	resp, err := h.signedIn(r, "user-mfa", "https://api.test", "", "")
+	if err != nil {
+		t.Fatalf("signed in: %v", err)
+	}
+	challenge, ok := resp.Body.(mfaChallengeResponse)
+	if !ok || !challenge.MFARequired || challenge.MFAToken != "challenge-user-mfa" {
+		t.Fatalf("expected the MFA challenge, got %d %+v", resp.Status, resp.Body)
+	}
+}
@@ -50,6 +50,25 @@ func checkBreachedPassword(password string) error {
 	return nil
 }
 
+type loginRequest struct {
+	Email    string `json:"email"    validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=64"`
+	Audience string `json:"audience"`
+	// Scope is a space-separated list of requested scopes.
+	Scope string `json:"scope"`
+}
+
+func (r *loginRequest) SetBody() error { return nil }
+
+// refreshRequest is optional; without it the new pair keeps the old
+// audience and scopes. Scope may only narrow what the grant carries.
+type refreshRequest struct {
+	Audience string `json:"audience"`
+	Scope    string `json:"scope"`
+}
+
+func (r *refreshRequest) SetBody() error { return nil }
+
 type registerResponse struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
@@ -58,11 +77,34 @@ type registerResponse struct {
 type loginResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope,omitempty"`
 }
 
 type refreshResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type sessionRequest struct {
+	ID string `validate:"required,uuid"`
+}
+
+func (r *sessionRequest) SetParam(field, value string) error {
+	if field == "id" {
+		r.ID = value
+	}
+	return nil
 }
 
 type logoutRequest struct {
@@ -70,3 +112,45 @@ type logoutRequest struct {
 }
 
 func (r *logoutRequest) SetBody() error { return nil }
+
+// mfaChallengeResponse answers a correct password for a user with MFA
+// enabled in place of loginResponse.
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// mfaEnrollRequest asks for the current password again, so a stolen
+// access token alone cannot enroll an authenticator.
+type mfaEnrollRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (r *mfaEnrollRequest) SetBody() error { return nil }
+
+type mfaEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type mfaConfirmRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+func (r *mfaConfirmRequest) SetBody() error { return nil }
+
+type mfaConfirmResponse struct {
+	// RecoveryCodes are shown once; only their hashes are kept.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaVerifyRequest completes a login with either a code from the
+// authenticator or one of the recovery codes.
+type mfaVerifyRequest struct {
+	MFAToken     string `json:"mfa_token"     validate:"required"`
+	Code         string `json:"code"          validate:"required_without=RecoveryCode,excluded_with=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+func (r *mfaVerifyRequest) SetBody() error { return nil }
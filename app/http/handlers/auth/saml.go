@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/saml"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// samlRequestTTL bounds how long the user may spend at the IdP.
+const samlRequestTTL = 10 * time.Minute
+
+// samlRequest is remembered under the ID of an AuthnRequest until the IdP
+// answers it, with what the tokens should be issued for.
+type samlRequest struct {
+	TenantID string `json:"tenant_id"`
+	IdP      string `json:"idp"`
+	Audience string `json:"audience"`
+	Scope    string `json:"scope"`
+}
+
+// idp returns the IdP the request's path names, if it serves the
+// request's tenant. To other tenants it does not exist.
+func (h *Handler) idp(r *http.Request) (*saml.IdP, bool) {
+	name, slug := chi.URLParam(r, "idp"), tenantMW.From(r.Context()).Slug
+	for _, p := range h.idps {
+		if p.Name() == name && p.ServesTenant(slug) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// serviceProvider is this service as p knows it, on the host the request
+// came to, so each tenant's host is a service provider of its own.
+func serviceProvider(r *http.Request, p *saml.IdP) saml.ServiceProvider {
+	base := httpkit.BaseURL(r) + "/auth/saml/" + p.Name()
+	return saml.ServiceProvider{EntityID: base + "/metadata", ACSURL: base + "/acs"}
+}
+
+// samlMetadata serves the SP metadata to register with the IdP.
+func (h *Handler) samlMetadata(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.idp(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	out, err := saml.Metadata(serviceProvider(r, p))
+	if err != nil {
+		log.Printf("saml: metadata: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(out)
+}
+
+// samlLogin sends the user to the IdP to sign in. The audience and scope
+// query parameters are those of /auth/login.
+func (h *Handler) samlLogin(r *http.Request) (*httpkit.Response, error) {
+	p, ok := h.idp(r)
+	if !ok {
+		return nil, httpkit.ClientErr(http.StatusNotFound, "Unknown identity provider")
+	}
+	q := r.URL.Query()
+	audience, err := h.resolveAudience(r, q.Get("audience"))
+	if err != nil {
+		return nil, err
+	}
+
+	id := saml.NewRequestID()
+	data, err := json.Marshal(samlRequest{
+		TenantID: tenantMW.From(r.Context()).ID,
+		IdP:      p.Name(),
+		Audience: audience,
+		Scope:    q.Get("scope"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := h.cache.Set(r.Context(), "saml_request:"+id, string(data), samlRequestTTL); err != nil {
+		return nil, err
+	}
+
+	authnURL, err := p.AuthnRequestURL(serviceProvider(r, p), id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &httpkit.Response{
+		Status: http.StatusFound,
+		Header: http.Header{"Location": {authnURL}, "Cache-Control": {"no-store"}},
+	}, nil
+}
+
+// samlACS is the Assertion Consumer Service the IdP posts its response to.
+// A verified assertion answering one of our requests signs the user in,
+// creating or linking them just in time, with the same MFA challenge or
+// token pair as /auth/login.
+func (h *Handler) samlACS(r *http.Request) (*httpkit.Response, error) {
+	p, ok := h.idp(r)
+	if !ok {
+		return nil, httpkit.ClientErr(http.StatusNotFound, "Unknown identity provider")
+	}
+	t := tenantMW.From(r.Context())
+	invalid := httpkit.ClientErr(http.StatusUnauthorized, "Invalid SAML response")
+
+	a, err := p.ParseResponse(serviceProvider(r, p), r.PostFormValue("SAMLResponse"), time.Now())
+	if err != nil {
+		log.Printf("saml: %s: %v", p.Name(), err)
+		return nil, invalid
+	}
+
+	// Taking the request makes each response good for one sign-in.
+	var req samlRequest
+	data, err := h.cache.GetDel(r.Context(), "saml_request:"+a.InResponseTo)
+	if err != nil || json.Unmarshal([]byte(data), &req) != nil || req.IdP != p.Name() || req.TenantID != t.ID {
+		return nil, invalid
+	}
+
+	// An IdP limited to domains may not sign anyone else in, linked or not.
+	if !p.AllowsEmail(a.Identity.Email) {
+		log.Printf("saml: %s: email outside the IdP's domains", p.Name())
+		return nil, httpkit.ClientErr(http.StatusForbidden, "The identity provider may not sign in this email address")
+	}
+
+	user, linked, err := h.users.ResolveFederated(r.Context(), t.ID, userStore.Identity{
+		Provider:      p.Name(),
+		Subject:       a.Identity.Subject,
+		Email:         a.Identity.Email,
+		EmailVerified: a.Identity.EmailVerified,
+	})
+	switch {
+	case errors.Is(err, userStore.ErrNoEmail):
+		return nil, httpkit.ClientErr(http.StatusBadRequest, "The identity provider sent no email address")
+	case errors.Is(err, userStore.ErrUnverifiedEmail):
+		return nil, httpkit.ClientErr(http.StatusConflict, "An account with this email address already exists")
+	case err != nil:
+		return nil, err
+	}
+	if linked {
+		h.record(r, eventStore.KindIdentityLinked, user.ID, map[string]string{"provider": p.Name(), "provider_subject": a.Identity.Subject})
+	}
+
+	return h.signedIn(r, user.ID, req.Audience, req.Scope, "")
+}
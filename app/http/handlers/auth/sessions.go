@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+)
+
+// errEndingForUser refuses a token acting for the user, such as a support
+// agent's impersonation token, on the routes that end the user's sessions.
+var errEndingForUser = httpkit.ClientErr(http.StatusForbidden, "Sessions cannot be ended while acting as another user")
+
+func (h *Handler) listSessions(r *http.Request) (*httpkit.Response, error) {
+	userID := authMW.ClaimsFrom(r.Context()).Subject
+
+	// A session whose refresh token has not been used for a full token
+	// lifetime has expired on its own.
+	sessions, err := h.sessions.ListActive(r.Context(), userID, time.Now().Add(-issuer(r).Config().MaxLifetime()))
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		body = append(body, sessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+		})
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body:   body,
+	}, nil
+}
+
+func (h *Handler) deleteSession(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeRequest[*sessionRequest](r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	claims := authMW.ClaimsFrom(r.Context())
+	if claims.Actor != nil {
+		return nil, errEndingForUser
+	}
+	userID := claims.Subject
+	sess, err := h.sessions.Get(r.Context(), req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httpkit.ClientErr(http.StatusNotFound, "session not found")
+		}
+		return nil, err
+	}
+	// Another user's session is indistinguishable from a missing one.
+	if sess.UserID != userID {
+		return nil, httpkit.ClientErr(http.StatusNotFound, "session not found")
+	}
+
+	if err := h.endSession(r, sess.ID); err != nil {
+		return nil, err
+	}
+
+	return &httpkit.Response{Status: http.StatusNoContent}, nil
+}
+
+// endSession revokes every token in the session's family and marks it revoked.
+func (h *Handler) endSession(r *http.Request, id string) error {
+	if err := verifier(r).RevokeFamily(r.Context(), id); err != nil {
+		return err
+	}
+	return h.sessions.Revoke(r.Context(), id)
+}
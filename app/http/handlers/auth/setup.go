@@ -1,22 +1,68 @@
 package auth
 
 import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
 	"auth-as-a-service/app/http/httpkit"
+	"auth-as-a-service/app/http/signin"
 	"auth-as-a-service/app/memory/redis"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	mfaStore "auth-as-a-service/app/memory/store/mfa"
+	roleStore "auth-as-a-service/app/memory/store/role"
+	sessionStore "auth-as-a-service/app/memory/store/session"
 	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/ldap"
+	"auth-as-a-service/sdk/saml"
+	"auth-as-a-service/sdk/token"
 
 	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// authenticator checks the passwords and second factors users sign in
+// with. The signin service implements it.
+type authenticator interface {
+	Authenticate(r *http.Request, email, password string) (userStore.User, error)
+	Directory(r *http.Request, email string) (*ldap.Directory, bool)
+	StartMFA(r *http.Request, userID, purpose string, data map[string]string) (string, bool, error)
+	VerifyMFA(r *http.Request, tok, purpose, code, recoveryCode string) (signin.Challenge, error)
+	AcceptTOTP(ctx context.Context, t mfaStore.TOTP, code string) (bool, error)
+}
+
 type Handler struct {
-	users *userStore.Store
-	redis redis.Service
+	users    *userStore.Store
+	sessions *sessionStore.Store
+	events   *eventStore.Store
+	roles    *roleStore.Store
+	mfa      *mfaStore.Store
+	cache    redis.Service
+	// idps are the enterprise SAML identity providers users may sign in
+	// with.
+	idps []*saml.IdP
+	// signin checks passwords against the users table or the directory
+	// serving the user.
+	signin authenticator
+	// userScopes are the scopes any signed-in user may request.
+	userScopes []string
 }
 
-func New(users *userStore.Store, redis redis.Service) *Handler {
-	return &Handler{users: users, redis: redis}
+func New(users *userStore.Store, sessions *sessionStore.Store, events *eventStore.Store, roles *roleStore.Store, mfa *mfaStore.Store, cache redis.Service, idps []*saml.IdP, signin *signin.Service) *Handler {
+	return &Handler{
+		users:      users,
+		sessions:   sessions,
+		events:     events,
+		roles:      roles,
+		mfa:        mfa,
+		cache:      cache,
+		idps:       idps,
+		signin:     signin,
+		userScopes: strings.Fields(os.Getenv("USER_SCOPES")),
+	}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
@@ -24,8 +70,29 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 		r.Post("/register", httpkit.Handle(h.register))
 		r.Post("/login", httpkit.Handle(h.login))
 		r.Post("/refresh", httpkit.Handle(h.refresh))
+		r.Post("/mfa/verify", httpkit.Handle(h.mfaVerify))
+		r.Get("/saml/{idp}/metadata", h.samlMetadata)
+		r.Get("/saml/{idp}/login", httpkit.Handle(h.samlLogin))
+		r.Post("/saml/{idp}/acs", httpkit.Handle(h.samlACS))
 
-		r.With(authMW.RequireAuth(h.redis)).
-			Post("/logout", httpkit.Handle(h.logout))
+		r.Group(func(r chi.Router) {
+			r.Use(authMW.RequireAuth(), authMW.RequireUser())
+			r.Post("/logout", httpkit.Handle(h.logout))
+			r.Post("/logout-all", httpkit.Handle(h.logoutAll))
+			r.Get("/sessions", httpkit.Handle(h.listSessions))
+			r.Delete("/sessions/{id}", httpkit.Handle(h.deleteSession))
+			r.Post("/mfa/enroll", httpkit.Handle(h.mfaEnroll))
+			r.Post("/mfa/confirm", httpkit.Handle(h.mfaConfirm))
+		})
 	})
 }
+
+// issuer and verifier return the token issuer and verifier of the request's
+// tenant. Every route runs behind tenant resolution.
+func issuer(r *http.Request) *token.Issuer {
+	return tenantMW.From(r.Context()).Issuer
+}
+
+func verifier(r *http.Request) *token.Verifier {
+	return tenantMW.From(r.Context()).Verifier
+}
@@ -0,0 +1,265 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/pkce"
+	"auth-as-a-service/sdk/token"
+)
+
+// loginPage is the central sign-in form. The authorization request rides
+// along in hidden fields and is checked again when the form is posted.
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .25rem 0 1rem; padding: .5rem; }
+button { padding: .6rem; }
+.error { color: #b00020; }
+.provider { display: block; margin-top: .5rem; padding: .6rem; border: 1px solid #999; text-align: center; color: inherit; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>Sign in</h1>
+<p>to continue to {{.ClientName}}</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<label for="email">Email</label>
+<input id="email" name="email" type="email" autocomplete="username" value="{{.Email}}" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form>
+{{if .Providers}}<p>or</p>{{range .Providers}}
+<a class="provider" href="{{.URL}}">Sign in with {{.Name}}</a>{{end}}{{end}}
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign-in error</title></head>
+<body><h1>Sign-in error</h1><p>{{.}}</p></body>
+</html>
+`))
+
+type loginData struct {
+	ClientName string
+	Request    authorizeRequest
+	Email      string
+	Error      string
+	Providers  []providerLink
+}
+
+// providerLink starts federated sign-in with a provider, carrying the
+// authorization request along.
+type providerLink struct {
+	Name string
+	URL  string
+}
+
+// authorizeForm starts the authorization code flow (RFC 6749 section 4.1.1)
+// by showing the sign-in form. Clients are first-party, so there is no
+// consent step.
+func (h *Handler) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+	client, ok := h.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	renderPage(w, http.StatusOK, loginPage, loginData{ClientName: client.Name, Request: req, Providers: h.providerLinks(req)})
+}
+
+// authorizeSubmit signs the user in and redirects back to the client with
+// a single-use code. A user with MFA enabled gets the code only once the
+// MFA form is posted back with their second factor.
+func (h *Handler) authorizeSubmit(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(r)
+	client, ok := h.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+	showLogin := func(status int, message string) {
+		renderPage(w, status, loginPage, loginData{
+			ClientName: client.Name,
+			Request:    req,
+			Email:      r.PostFormValue("email"),
+			Error:      message,
+			Providers:  h.providerLinks(req),
+		})
+	}
+
+	t := tenantMW.From(r.Context())
+	var userID string
+	if r.PostFormValue("mfa_token") != "" {
+		if userID, ok = h.secondFactor(w, r, signin.PurposeAuthorize, req.values(), showLogin); !ok {
+			return
+		}
+	} else {
+		user, status, message, err := h.signIn(r)
+		if err != nil {
+			log.Printf("authorize: sign in: %v", err)
+			renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+			return
+		}
+		if message != "" {
+			showLogin(status, message)
+			return
+		}
+		challenged, err := h.requireMFA(w, r, user.ID, signin.PurposeAuthorize, "", req.values())
+		if err != nil {
+			log.Printf("authorize: start MFA: %v", err)
+			renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+			return
+		}
+		if challenged {
+			return
+		}
+		userID = user.ID
+	}
+
+	code, err := h.issueCode(r.Context(), authorizationCode{
+		TenantID: t.ID,
+		userGrant: userGrant{
+			ClientID: client.ID,
+			UserID:   userID,
+			Scopes:   token.GrantScopes(strings.Fields(req.Scope), allowedScopes(client)),
+			Nonce:    req.Nonce,
+			AuthTime: time.Now().Unix(),
+		},
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		log.Printf("authorize: issue code: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{"code": {code}}, req.State)
+}
+
+// signIn checks the email and password posted with a sign-in form against
+// the request's tenant, as /auth/login does. A refusal comes back as the
+// status and message to show on the form; only a failure to check is an
+// error.
+func (h *Handler) signIn(r *http.Request) (user userStore.User, status int, message string, err error) {
+	user, err = h.signin.Authenticate(r, r.PostFormValue("email"), r.PostFormValue("password"))
+	if errors.Is(err, signin.ErrInvalidCredentials) {
+		return user, http.StatusUnauthorized, "Invalid email or password.", nil
+	}
+	if refused := (httpkit.Error{}); errors.As(err, &refused) {
+		return user, refused.Code, refused.Message + ".", nil
+	}
+	return user, http.StatusOK, "", err
+}
+
+// checkAuthorizeRequest validates req and writes the error response if it
+// is invalid. Until the client and redirect URI are known to be good, errors
+// are shown to the user rather than sent to the redirect URI (RFC 6749
+// section 4.1.2.1).
+func (h *Handler) checkAuthorizeRequest(w http.ResponseWriter, r *http.Request, req authorizeRequest) (clientStore.Client, bool) {
+	t := tenantMW.From(r.Context())
+	client, err := h.clients.Get(r.Context(), t.ID, req.ClientID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("authorize: look up client: %v", err)
+		}
+		renderPage(w, http.StatusBadRequest, errorPage, "Unknown application.")
+		return client, false
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		renderPage(w, http.StatusBadRequest, errorPage, "The application's redirect URI is not registered.")
+		return client, false
+	}
+
+	switch {
+	case !client.AllowsGrant(clientStore.GrantAuthorizationCode):
+		redirectError(w, r, req, "unauthorized_client", "")
+	case req.ResponseType != "code":
+		redirectError(w, r, req, "unsupported_response_type", "only the code response type is supported")
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != pkce.MethodS256:
+		redirectError(w, r, req, "invalid_request", "PKCE with the S256 method is required")
+	case !pkce.ValidChallenge(req.CodeChallenge):
+		redirectError(w, r, req, "invalid_request", "malformed code_challenge")
+	default:
+		return client, true
+	}
+	return client, false
+}
+
+// oidcScopes are the OpenID Connect scopes every client may request.
+var oidcScopes = []string{"openid", "email"}
+
+// allowedScopes is what a user may grant client: its registered scopes
+// plus the OpenID Connect ones.
+func allowedScopes(client clientStore.Client) []string {
+	return append(slices.Clone(oidcScopes), client.Scopes...)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	redirect(w, r, req.RedirectURI, params, req.State)
+}
+
+// redirect sends the user agent back to the client with params and state
+// added to the redirect URI's query.
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, state string) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		renderPage(w, http.StatusBadRequest, errorPage, "The application's redirect URI is invalid.")
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func renderPage(w http.ResponseWriter, status int, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := page.Execute(w, data); err != nil {
+		log.Printf("render %s: %v", page.Name(), err)
+	}
+}
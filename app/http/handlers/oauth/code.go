@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// codeTTL bounds how long a code may wait before it is exchanged. RFC
+	// 6749 section 4.1.2 recommends at most ten minutes; a redirect takes
+	// seconds.
+	codeTTL = time.Minute
+	// redeemedTTL is how long a redeemed code is remembered, so that a
+	// replay can revoke the tokens it was exchanged for.
+	redeemedTTL = 10 * time.Minute
+)
+
+// userGrant is what a signed-in user authorized a client to receive,
+// whether through an authorization code or an approved device.
+type userGrant struct {
+	ClientID string   `json:"client_id"`
+	UserID   string   `json:"user_id"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Nonce and AuthTime go into the ID token when openid was granted.
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time"`
+}
+
+// authorizationCode is what a code stands for until it is exchanged.
+type authorizationCode struct {
+	TenantID string `json:"tenant_id"`
+	userGrant
+	RedirectURI   string `json:"redirect_uri"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// codeKey stores codes by hash so a cache dump yields none that work.
+func codeKey(prefix, code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// issueCode stores ac under a new random code and returns the code.
+func (h *Handler) issueCode(ctx context.Context, ac authorizationCode) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	data, err := json.Marshal(ac)
+	if err != nil {
+		return "", err
+	}
+	if err := h.cache.Set(ctx, codeKey("auth_code:", code), string(data), codeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// redeemCode consumes code. It succeeds at most once per code, however many
+// requests race to exchange it.
+func (h *Handler) redeemCode(ctx context.Context, code string) (authorizationCode, bool) {
+	var ac authorizationCode
+	data, err := h.cache.GetDel(ctx, codeKey("auth_code:", code))
+	if err != nil || json.Unmarshal([]byte(data), &ac) != nil {
+		return ac, false
+	}
+	return ac, true
+}
+
+// markRedeemed remembers which token family code was exchanged for.
+func (h *Handler) markRedeemed(ctx context.Context, code, family string) error {
+	return h.cache.Set(ctx, codeKey("auth_code_redeemed:", code), family, redeemedTTL)
+}
+
+// redeemedFamily returns the family a previously redeemed code produced.
+func (h *Handler) redeemedFamily(ctx context.Context, code string) (string, bool) {
+	family, err := h.cache.Get(ctx, codeKey("auth_code_redeemed:", code))
+	return family, err == nil && family != ""
+}
@@ -0,0 +1,364 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	"auth-as-a-service/sdk/token"
+)
+
+const (
+	// deviceCodeTTL is how long the user has to approve a device.
+	deviceCodeTTL = 10 * time.Minute
+	// DevicePollInterval is the least time a device must wait between
+	// polls of the token endpoint.
+	DevicePollInterval = 5 * time.Second
+	// userCodeAlphabet has no vowels, so user codes never spell words, and
+	// no characters easily confused with one another (RFC 8628 section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// Device authorization states.
+const (
+	devicePending  = "pending"
+	deviceApproved = "approved"
+	deviceDenied   = "denied"
+)
+
+// deviceAuthorization is a device's pending request, keyed by its device
+// code. The user grant is filled in when the user approves it.
+type deviceAuthorization struct {
+	TenantID string `json:"tenant_id"`
+	userGrant
+	Status    string `json:"status"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+var devicePage = template.Must(template.New("device").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect a device</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .25rem 0 1rem; padding: .5rem; }
+button { padding: .6rem; margin-bottom: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Connect a device</h1>
+<p>Enter the code shown on your device and sign in to approve it.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="">
+<label for="user_code">Code</label>
+<input id="user_code" name="user_code" autocomplete="off" value="{{.UserCode}}" required>
+<label for="email">Email</label>
+<input id="email" name="email" type="email" autocomplete="username" value="{{.Email}}" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var deviceDonePage = template.Must(template.New("device_done").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body><h1>Connect a device</h1><p>{{.}}</p></body>
+</html>
+`))
+
+type deviceData struct {
+	UserCode string
+	Email    string
+	Error    string
+}
+
+// deviceAuthorization starts the device authorization grant (RFC 8628
+// section 3.1). The device shows the user code and polls the token
+// endpoint with the device code while the user approves it elsewhere.
+func (h *Handler) deviceAuthorization(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeForm[*grantRequest](r, "client_id", "client_secret", "scope")
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if !client.AllowsGrant(clientStore.GrantDeviceCode) {
+		return tokenError(http.StatusBadRequest, "unauthorized_client", "")
+	}
+
+	expiresAt := time.Now().Add(deviceCodeTTL)
+	deviceCode, userCode, err := h.issueDeviceCode(r.Context(), deviceAuthorization{
+		TenantID: tenantMW.From(r.Context()).ID,
+		userGrant: userGrant{
+			ClientID: client.ID,
+			Scopes:   token.GrantScopes(strings.Fields(req.Scope), allowedScopes(*client)),
+		},
+		Status:    devicePending,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	verificationURI := httpkit.BaseURL(r) + "/oauth/device"
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body: deviceAuthorizationResponse{
+			DeviceCode:              deviceCode,
+			UserCode:                userCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+			ExpiresIn:               int(deviceCodeTTL.Seconds()),
+			Interval:                int(DevicePollInterval.Seconds()),
+		},
+	}, nil
+}
+
+// deviceForm shows where the user enters the code from their device.
+func (h *Handler) deviceForm(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, http.StatusOK, devicePage, deviceData{UserCode: r.URL.Query().Get("user_code")})
+}
+
+// deviceSubmit signs the user in and approves or denies the device whose
+// user code they entered. A user with MFA enabled approves only once the
+// MFA form is posted back with their second factor; denying grants
+// nothing, so it takes the password alone.
+func (h *Handler) deviceSubmit(w http.ResponseWriter, r *http.Request) {
+	data := deviceData{UserCode: r.PostFormValue("user_code"), Email: r.PostFormValue("email")}
+	t := tenantMW.From(r.Context())
+
+	key, da, ok := h.lookupUserCode(r.Context(), data.UserCode)
+	if !ok || da.TenantID != t.ID || da.Status != devicePending {
+		data.Error = "That code is invalid or has expired."
+		renderPage(w, http.StatusBadRequest, devicePage, data)
+		return
+	}
+	showDevice := func(status int, message string) {
+		data.Error = message
+		renderPage(w, status, devicePage, data)
+	}
+
+	deny := r.PostFormValue("action") == "deny"
+	fields := url.Values{"user_code": {data.UserCode}, "action": {"approve"}}
+	var userID string
+	if r.PostFormValue("mfa_token") != "" {
+		if userID, ok = h.secondFactor(w, r, signin.PurposeDevice, fields, showDevice); !ok {
+			return
+		}
+	} else {
+		user, status, refusal, err := h.signIn(r)
+		if err != nil {
+			log.Printf("device: sign in: %v", err)
+			renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+			return
+		}
+		if refusal != "" {
+			showDevice(status, refusal)
+			return
+		}
+		if !deny {
+			challenged, err := h.requireMFA(w, r, user.ID, signin.PurposeDevice, "", fields)
+			if err != nil {
+				log.Printf("device: start MFA: %v", err)
+				renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+				return
+			}
+			if challenged {
+				return
+			}
+		}
+		userID = user.ID
+	}
+
+	message := "Your device is connected. You can return to it now."
+	if deny {
+		da.Status = deviceDenied
+		message = "The device was not connected."
+	} else {
+		da.Status = deviceApproved
+		da.UserID = userID
+		da.AuthTime = time.Now().Unix()
+	}
+	if err := h.saveDevice(r.Context(), key, da); err != nil {
+		log.Printf("device: save approval: %v", err)
+		renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+		return
+	}
+	// The code has served its purpose; it cannot be approved twice.
+	if err := h.cache.Delete(r.Context(), userCodeKey(data.UserCode)); err != nil {
+		log.Printf("device: delete user code: %v", err)
+	}
+
+	renderPage(w, http.StatusOK, deviceDonePage, message)
+}
+
+// deviceCodeGrant answers a device polling for tokens (RFC 8628 section
+// 3.4). Until the user acts it answers authorization_pending, and
+// slow_down to a device that polls more often than the interval allows.
+func (h *Handler) deviceCodeGrant(r *http.Request, req *grantRequest) (*httpkit.Response, error) {
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if !client.AllowsGrant(clientStore.GrantDeviceCode) {
+		return tokenError(http.StatusBadRequest, "unauthorized_client", "")
+	}
+	if req.DeviceCode == "" {
+		return tokenError(http.StatusBadRequest, "invalid_request", "device_code is required")
+	}
+
+	key := codeKey("device_code:", req.DeviceCode)
+	if ok, _ := h.polls.Allow(key); !ok {
+		return tokenError(http.StatusBadRequest, "slow_down", "")
+	}
+
+	da, ok := h.loadDevice(r.Context(), key)
+	if !ok {
+		return tokenError(http.StatusBadRequest, "expired_token", "")
+	}
+	if da.TenantID != tenantMW.From(r.Context()).ID || da.ClientID != client.ID {
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+
+	switch da.Status {
+	case devicePending:
+		return tokenError(http.StatusBadRequest, "authorization_pending", "")
+	case deviceDenied:
+		if err := h.cache.Delete(r.Context(), key); err != nil {
+			log.Printf("delete denied device code: %v", err)
+		}
+		return tokenError(http.StatusBadRequest, "access_denied", "")
+	}
+
+	// Only one poll may exchange an approved code.
+	if _, err := h.cache.GetDel(r.Context(), key); err != nil {
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+	resp, _, err := h.issueUserTokens(r, da.userGrant)
+	return resp, err
+}
+
+// issueDeviceCode stores da under a new device code and a new user code
+// and returns both. The user code is retried on the rare collision with
+// one still pending.
+func (h *Handler) issueDeviceCode(ctx context.Context, da deviceAuthorization) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(b)
+	key := codeKey("device_code:", deviceCode)
+
+	if err := h.saveDevice(ctx, key, da); err != nil {
+		return "", "", err
+	}
+	for range 5 {
+		userCode, err := newUserCode()
+		if err != nil {
+			return "", "", err
+		}
+		ok, err := h.cache.SetNX(ctx, userCodeKey(userCode), key, deviceCodeTTL)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			return deviceCode, userCode, nil
+		}
+	}
+	return "", "", fmt.Errorf("no free user code")
+}
+
+// lookupUserCode finds the device authorization a user code stands for and
+// the key it is stored under.
+func (h *Handler) lookupUserCode(ctx context.Context, userCode string) (string, deviceAuthorization, bool) {
+	key, err := h.cache.Get(ctx, userCodeKey(userCode))
+	if err != nil || key == "" {
+		return "", deviceAuthorization{}, false
+	}
+	da, ok := h.loadDevice(ctx, key)
+	return key, da, ok
+}
+
+func (h *Handler) loadDevice(ctx context.Context, key string) (deviceAuthorization, bool) {
+	var da deviceAuthorization
+	data, err := h.cache.Get(ctx, key)
+	if err != nil || data == "" || json.Unmarshal([]byte(data), &da) != nil {
+		return da, false
+	}
+	return da, true
+}
+
+// saveDevice stores da until it expires.
+func (h *Handler) saveDevice(ctx context.Context, key string, da deviceAuthorization) error {
+	ttl := time.Until(time.Unix(da.ExpiresAt, 0))
+	if ttl <= 0 {
+		return fmt.Errorf("device code expired")
+	}
+	data, err := json.Marshal(da)
+	if err != nil {
+		return err
+	}
+	return h.cache.Set(ctx, key, string(data), ttl)
+}
+
+// newUserCode returns a random user code formatted for reading aloud, e.g.
+// WDJB-MJHT.
+func newUserCode() (string, error) {
+	alphabet := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, 0, userCodeLength+1)
+	for i := range userCodeLength {
+		if i == userCodeLength/2 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, alphabet)
+		if err != nil {
+			return "", err
+		}
+		code = append(code, userCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// userCodeKey normalizes what the user typed, ignoring case, dashes and
+// spaces, before looking it up.
+func userCodeKey(userCode string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+	return "device_user_code:" + normalized
+}
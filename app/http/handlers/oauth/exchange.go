@@ -0,0 +1,317 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	"auth-as-a-service/sdk/token"
+
+	"github.com/google/uuid"
+)
+
+// PermImpersonate is the permission an actor needs to exchange its token
+// for one acting as another user.
+const PermImpersonate = "users:impersonate"
+
+// tokenTypeAccessToken is the only token type exchanged in either
+// direction (RFC 8693 section 3).
+const tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// Kinds of token exchange, recorded in the audit event.
+const (
+	exchangeImpersonation = "impersonation"
+	exchangeDelegation    = "delegation"
+)
+
+// refusal is a token exchange turned down, and why.
+type refusal struct {
+	status      int
+	code        string
+	description string
+}
+
+func refuse(code, description string) *refusal {
+	return &refusal{status: http.StatusBadRequest, code: code, description: description}
+}
+
+// exchange is the token a request asks for, as far as it is known.
+type exchange struct {
+	mode   string
+	claims token.Claims
+	// notAfter is the earliest expiry of the tokens exchanged, which the
+	// new token may not outlive.
+	notAfter time.Time
+}
+
+// tokenExchangeGrant implements RFC 8693. A confidential client exchanges
+// either a user's access token for one it may use on that user's behalf
+// (delegation), or a staff member's access token plus requested_subject
+// for one acting as that user (impersonation). Issued tokens carry the
+// actor in the act claim, live for the shorter exchange lifetime and never
+// come with a refresh token. Every exchange, granted or refused, is
+// recorded as a security event.
+func (h *Handler) tokenExchangeGrant(r *http.Request, req *grantRequest) (*httpkit.Response, error) {
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || client.Public() {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if !client.AllowsGrant(clientStore.GrantTokenExchange) {
+		return tokenError(http.StatusBadRequest, "unauthorized_client", "")
+	}
+
+	ex, denied, err := h.exchange(r, req, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// A refusal may come before the subject is known.
+	subject := ex.claims.Subject
+	if subject == "" {
+		subject = client.ID
+	}
+	detail := map[string]string{"client_id": client.ID, "mode": ex.mode}
+	if ex.claims.Actor != nil {
+		detail["actor"] = ex.claims.Actor.Subject
+	}
+	if denied != nil {
+		detail["error"] = denied.code
+		if err := h.recordExchange(r, eventStore.KindTokenExchangeDenied, subject, detail); err != nil {
+			log.Printf("record security event %s: %v", eventStore.KindTokenExchangeDenied, err)
+		}
+		return tokenError(denied.status, denied.code, denied.description)
+	}
+
+	t := tenantMW.From(r.Context())
+	accessTok, err := t.Issuer.GenerateExchanged(r.Context(), ex.claims, ex.notAfter)
+	if err != nil {
+		return nil, err
+	}
+	// A token that cannot be audited is not handed out.
+	detail["audience"] = strings.Join(ex.claims.Audience, " ")
+	detail["scope"] = strings.Join(ex.claims.Scopes, " ")
+	if err := h.recordExchange(r, eventStore.KindTokenExchange, subject, detail); err != nil {
+		return nil, err
+	}
+
+	tokenType := "Bearer"
+	if ex.claims.KeyThumbprint != "" {
+		tokenType = "DPoP"
+	}
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body: tokenResponse{
+			AccessToken:     accessTok,
+			IssuedTokenType: tokenTypeAccessToken,
+			TokenType:       tokenType,
+			ExpiresIn:       int(t.Issuer.ExchangedLifetime(ex.notAfter).Seconds()),
+			Scope:           strings.Join(ex.claims.Scopes, " "),
+		},
+	}, nil
+}
+
+// exchange checks req against the exchange policy and works out the claims
+// of the token to issue. A refusal comes back with whatever claims were
+// established before it, for the audit record.
+func (h *Handler) exchange(r *http.Request, req *grantRequest, client *clientStore.Client) (exchange, *refusal, error) {
+	ex := exchange{mode: exchangeDelegation}
+	if req.RequestedSubject != "" {
+		ex.mode = exchangeImpersonation
+	}
+
+	if req.RequestedTokenType != "" && req.RequestedTokenType != tokenTypeAccessToken {
+		return ex, refuse("invalid_request", "only access tokens can be requested"), nil
+	}
+	t := tenantMW.From(r.Context())
+	audience, err := t.Issuer.Config().ResolveAudience(req.Audience)
+	if errors.Is(err, token.ErrAudienceNotAllowed) {
+		return ex, refuse("invalid_target", "audience not allowed"), nil
+	}
+	ex.claims.Audience = []string{audience}
+	ex.claims.Custom = map[string]any{"client_id": client.ID}
+
+	// A DPoP proof binds the new token to its key, and is required for any
+	// bound token exchanged, so exchanging cannot strip the binding.
+	jkt, denied := exchangeProof(r)
+	if denied != nil {
+		return ex, denied, nil
+	}
+	ex.claims.KeyThumbprint = jkt
+
+	var actor *token.Claims
+	if req.ActorToken != "" {
+		if req.ActorTokenType != tokenTypeAccessToken {
+			return ex, refuse("invalid_request", "actor_token must be an access token"), nil
+		}
+		if actor, err = t.Verifier.Validate(r.Context(), req.ActorToken); err != nil {
+			return ex, refuse("invalid_grant", "invalid actor_token"), nil
+		}
+		if actor.KeyThumbprint != "" && actor.KeyThumbprint != jkt {
+			return ex, refuse("invalid_grant", "actor_token is DPoP-bound; send a proof signed with its key"), nil
+		}
+		ex.notAfter = actor.ExpiresAt
+	}
+
+	if ex.mode == exchangeImpersonation {
+		denied, err := h.impersonate(r, req, client, actor, &ex.claims)
+		return ex, denied, err
+	}
+	subject, denied, err := h.delegate(r, req, client, actor, &ex.claims)
+	if subject != nil && (ex.notAfter.IsZero() || subject.ExpiresAt.Before(ex.notAfter)) {
+		ex.notAfter = subject.ExpiresAt
+	}
+	return ex, denied, err
+}
+
+// exchangeProof returns the thumbprint of the key the request's DPoP proof
+// is signed with, or "" without one.
+func exchangeProof(r *http.Request) (string, *refusal) {
+	proofs := r.Header.Values("DPoP")
+	switch len(proofs) {
+	case 0:
+		return "", nil
+	case 1:
+	default:
+		return "", refuse("invalid_dpop_proof", "send at most one DPoP proof")
+	}
+	proof, err := tenantMW.From(r.Context()).Verifier.VerifyProof(r.Context(), proofs[0], r.Method, httpkit.RequestURL(r), "")
+	if err != nil {
+		return "", refuse("invalid_dpop_proof", "invalid DPoP proof")
+	}
+	return proof.Thumbprint, nil
+}
+
+// impersonate lets a staff member act as requested_subject. The actor must
+// hold PermImpersonate and cannot already be acting for someone else. Users
+// with any role cannot be impersonated, and the token carries no roles, so
+// impersonation never reaches further than the customer's own account.
+func (h *Handler) impersonate(r *http.Request, req *grantRequest, client *clientStore.Client, actor *token.Claims, claims *token.Claims) (*refusal, error) {
+	ctx := r.Context()
+	t := tenantMW.From(ctx)
+	claims.Subject = req.RequestedSubject
+	if actor == nil {
+		return refuse("invalid_request", "impersonation needs an actor_token"), nil
+	}
+	claims.Actor = &token.Actor{Subject: actor.Subject}
+	if actor.Actor != nil {
+		return refuse("invalid_grant", "an actor cannot impersonate while acting for someone else"), nil
+	}
+
+	allowed := false
+	if _, err := uuid.Parse(actor.Subject); err == nil {
+		roles, err := h.roles.NamesForUser(ctx, t.ID, actor.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if allowed, err = h.roles.HasPermission(ctx, t.ID, roles, PermImpersonate); err != nil {
+			return nil, err
+		}
+	}
+	if !allowed {
+		return refuse("invalid_grant", "actor may not impersonate users"), nil
+	}
+
+	if _, err := uuid.Parse(req.RequestedSubject); err != nil {
+		return refuse("invalid_grant", "unknown requested_subject"), nil
+	}
+	if _, err := h.users.GetByID(ctx, t.ID, req.RequestedSubject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return refuse("invalid_grant", "unknown requested_subject"), nil
+		}
+		return nil, err
+	}
+	targetRoles, err := h.roles.NamesForUser(ctx, t.ID, req.RequestedSubject)
+	if err != nil {
+		return nil, err
+	}
+	if len(targetRoles) > 0 {
+		return refuse("invalid_grant", "users with roles cannot be impersonated"), nil
+	}
+
+	scopes, denied := exchangeScopes(req.Scope, client.Scopes)
+	if denied != nil {
+		return denied, nil
+	}
+	claims.Scopes = scopes
+	// The staff member signing out ends the impersonation too.
+	claims.Family = actor.Family
+	return nil, nil
+}
+
+// delegate issues client a token to call other services on behalf of the
+// subject token's user. The client is the actor; an actor_token, if sent,
+// must be the client's own. Scopes can only narrow, to those both the user
+// and the client hold; roles and session carry over, and an existing actor
+// chain is kept beneath the client. It returns the subject token's claims
+// once they are verified.
+func (h *Handler) delegate(r *http.Request, req *grantRequest, client *clientStore.Client, actor *token.Claims, claims *token.Claims) (*token.Claims, *refusal, error) {
+	claims.Actor = &token.Actor{Subject: client.ID}
+	if req.SubjectToken == "" {
+		return nil, refuse("invalid_request", "subject_token is required"), nil
+	}
+	if req.SubjectTokenType != tokenTypeAccessToken {
+		return nil, refuse("invalid_request", "subject_token must be an access token"), nil
+	}
+	if actor != nil && actor.Subject != client.ID {
+		return nil, refuse("invalid_grant", "actor_token does not belong to the client"), nil
+	}
+
+	subject, err := tenantMW.From(r.Context()).Verifier.Validate(r.Context(), req.SubjectToken)
+	if err != nil {
+		return nil, refuse("invalid_grant", "invalid subject_token"), nil
+	}
+	claims.Subject = subject.Subject
+	claims.Actor.Actor = subject.Actor
+	if subject.KeyThumbprint != "" && subject.KeyThumbprint != claims.KeyThumbprint {
+		return subject, refuse("invalid_grant", "subject_token is DPoP-bound; send a proof signed with its key"), nil
+	}
+
+	// A client passes on no more of the user's scopes than it is allowed
+	// itself, as with impersonation.
+	scopes, denied := exchangeScopes(req.Scope, token.GrantScopes(subject.Scopes, client.Scopes))
+	if denied != nil {
+		return subject, denied, nil
+	}
+	claims.Scopes = scopes
+	claims.Roles = subject.Roles
+	claims.Family = subject.Family
+	return subject, nil, nil
+}
+
+// exchangeScopes grants the requested scopes if all are allowed, or every
+// allowed scope if none were requested.
+func exchangeScopes(requested string, allowed []string) ([]string, *refusal) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return allowed, nil
+	}
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, refuse("invalid_scope", "scope exceeds what may be granted")
+		}
+	}
+	return token.GrantScopes(scopes, allowed), nil
+}
+
+// recordExchange writes the audit event for a token exchange.
+func (h *Handler) recordExchange(r *http.Request, kind, subject string, detail map[string]string) error {
+	return h.events.Record(r.Context(), eventStore.Event{
+		Kind:      kind,
+		Subject:   subject,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	})
+}
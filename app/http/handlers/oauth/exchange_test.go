@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"auth-as-a-service/app/async/tenants"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	"auth-as-a-service/sdk/token"
+
+	"github.com/google/uuid"
+)
+
+// tokenTenant returns a tenant that issues and verifies tokens with a
+// fresh key, its revocations kept in cache.
+func tokenTenant(t *testing.T, cache *memCache) *tenants.Tenant {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	k, err := token.NewKey(priv)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	k.State = token.KeyCurrent
+	ring, err := token.NewKeyRing(k)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	cfg := token.Config{
+		Keys:        ring,
+		Issuer:      "https://auth.test",
+		AccessTTL:   time.Hour,
+		RefreshTTL:  24 * time.Hour,
+		ExchangeTTL: 15 * time.Minute,
+	}
+	return &tenants.Tenant{
+		ID:       testTenant.ID,
+		Slug:     testTenant.Slug,
+		Issuer:   token.NewIssuer(cfg, cache),
+		Verifier: token.NewVerifier(cfg, cache),
+	}
+}
+
+func TestDelegateKeepsToClientScopes(t *testing.T) {
+	h, cache := newTestHandler()
+	tn := tokenTenant(t, cache)
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", nil)
+	r = r.WithContext(tenantMW.WithTenant(r.Context(), tn))
+
+	subjectTok, err := tn.Issuer.Generate(r.Context(), token.Claims{
+		Subject: uuid.NewString(),
+		Scopes:  []string{"orders:read", "orders:write", "billing:read"},
+	})
+	if err != nil {
+		t.Fatalf("generate subject token: %v", err)
+	}
+	client := &clientStore.Client{ID: "reporting", Scopes: clientStore.List{"orders:read"}}
+
+	exchange := func(scope string) (token.Claims, *refusal) {
+		t.Helper()
+		var claims token.Claims
+		_, denied, err := h.delegate(r, &grantRequest{
+			SubjectToken:     subjectTok,
+			SubjectTokenType: tokenTypeAccessToken,
+			Scope:            scope,
+		}, client, nil, &claims)
+		if err != nil {
+			t.Fatalf("delegate: %v", err)
+		}
+		return claims, denied
+	}
+
+	// Asking for nothing in particular gets what both hold.
+	claims, denied := exchange("")
+	if denied != nil || !slices.Equal(claims.Scopes, []string{"orders:read"}) {
+		t.Fatalf("expected orders:read alone, got %v, %+v", claims.Scopes, denied)
+	}
+	// The user's other scopes are beyond the client.
+	if _, denied := exchange("orders:write"); denied == nil || denied.code != "invalid_scope" {
+		t.Fatalf("expected invalid_scope for a scope the client lacks, got %+v", denied)
+	}
+}
@@ -0,0 +1,256 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/oidc"
+	"auth-as-a-service/sdk/pkce"
+	"auth-as-a-service/sdk/token"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// federatedTTL bounds how long the user may spend at the provider.
+const federatedTTL = 10 * time.Minute
+
+// federatedLogin is remembered under the state sent to the provider until
+// the user comes back. The authorization request it serves is finished
+// once the provider has vouched for the user.
+type federatedLogin struct {
+	TenantID     string           `json:"tenant_id"`
+	Provider     string           `json:"provider"`
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+	Request      authorizeRequest `json:"request"`
+}
+
+// providerLinks lists the sign-in buttons for the configured providers.
+func (h *Handler) providerLinks(req authorizeRequest) []providerLink {
+	links := make([]providerLink, 0, len(h.providers))
+	query := req.values().Encode()
+	for _, p := range h.providers {
+		links = append(links, providerLink{
+			Name: p.DisplayName(),
+			URL:  "/oauth/federated/" + p.Name() + "?" + query,
+		})
+	}
+	return links
+}
+
+func (h *Handler) provider(name string) (*oidc.Provider, bool) {
+	for _, p := range h.providers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// callbackURL is where the provider sends the user back to. It must be
+// registered with the provider for every host the service answers on.
+func callbackURL(r *http.Request, p *oidc.Provider) string {
+	return httpkit.BaseURL(r) + "/oauth/federated/" + p.Name() + "/callback"
+}
+
+// federatedStart sends the user to the provider to sign in, in place of the
+// password form, for the authorization request in the query.
+func (h *Handler) federatedStart(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(chi.URLParam(r, "provider"))
+	if !ok {
+		renderPage(w, http.StatusNotFound, errorPage, "Unknown sign-in provider.")
+		return
+	}
+	req := parseAuthorizeRequest(r)
+	if _, ok := h.checkAuthorizeRequest(w, r, req); !ok {
+		return
+	}
+
+	verifier, err := pkce.NewVerifier()
+	if err != nil {
+		log.Printf("federated: new verifier: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+	fl := federatedLogin{
+		TenantID:     tenantMW.From(r.Context()).ID,
+		Provider:     p.Name(),
+		Nonce:        rand.Text(),
+		CodeVerifier: verifier,
+		Request:      req,
+	}
+	state, err := h.saveFederatedLogin(r.Context(), fl)
+	if err != nil {
+		log.Printf("federated: save state: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	authURL, err := p.AuthCodeURL(r.Context(), callbackURL(r, p), state, fl.Nonce, pkce.Challenge(verifier))
+	if err != nil {
+		log.Printf("federated: %s: %v", p.Name(), err)
+		redirectError(w, r, req, "temporarily_unavailable", "the sign-in provider is unavailable")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// federatedCallback is where the provider returns the user. The code is
+// redeemed for a verified ID token, the user is found, linked or created,
+// and the original authorization request completes with our own code.
+func (h *Handler) federatedCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(chi.URLParam(r, "provider"))
+	if !ok {
+		renderPage(w, http.StatusNotFound, errorPage, "Unknown sign-in provider.")
+		return
+	}
+	t := tenantMW.From(r.Context())
+	q := r.URL.Query()
+
+	fl, ok := h.takeFederatedLogin(r.Context(), q.Get("state"))
+	if !ok || fl.Provider != p.Name() || fl.TenantID != t.ID {
+		renderPage(w, http.StatusBadRequest, errorPage, "This sign-in has expired. Please start again.")
+		return
+	}
+	req := fl.Request
+	client, ok := h.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+	if q.Get("error") != "" {
+		redirectError(w, r, req, "access_denied", "")
+		return
+	}
+
+	id, err := p.Exchange(r.Context(), q.Get("code"), fl.CodeVerifier, callbackURL(r, p), fl.Nonce)
+	if err != nil {
+		log.Printf("federated: %s: %v", p.Name(), err)
+		redirectError(w, r, req, "access_denied", "sign-in with the provider failed")
+		return
+	}
+
+	user, err := h.federatedUser(r, p.Name(), id)
+	switch {
+	case errors.Is(err, userStore.ErrNoEmail):
+		renderPage(w, http.StatusBadRequest, errorPage, "The sign-in provider did not share your email address.")
+		return
+	case errors.Is(err, userStore.ErrUnverifiedEmail):
+		renderPage(w, http.StatusConflict, errorPage, "An account with this email address already exists. Sign in with your password instead.")
+		return
+	case err != nil:
+		log.Printf("federated: find or create user: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	h.finishFederated(w, r, req, client, user.ID)
+}
+
+// finishFederated completes req for the user the provider signed in. The
+// provider vouches for who they are, not for our second factor, so a user
+// with MFA enabled gets the MFA form, which goes on to /oauth/authorize to
+// issue the code.
+func (h *Handler) finishFederated(w http.ResponseWriter, r *http.Request, req authorizeRequest, client clientStore.Client, userID string) {
+	challenged, err := h.requireMFA(w, r, userID, signin.PurposeAuthorize, "/oauth/authorize", req.values())
+	if err != nil {
+		log.Printf("federated: start MFA: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+	if challenged {
+		return
+	}
+
+	code, err := h.issueCode(r.Context(), authorizationCode{
+		TenantID: tenantMW.From(r.Context()).ID,
+		userGrant: userGrant{
+			ClientID: client.ID,
+			UserID:   userID,
+			Scopes:   token.GrantScopes(strings.Fields(req.Scope), allowedScopes(client)),
+			Nonce:    req.Nonce,
+			AuthTime: time.Now().Unix(),
+		},
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		log.Printf("federated: issue code: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{"code": {code}}, req.State)
+}
+
+// federatedUser returns the user id belongs to, finding, linking or
+// creating them. Linking an existing account is recorded.
+func (h *Handler) federatedUser(r *http.Request, provider string, id oidc.Identity) (userStore.User, error) {
+	user, linked, err := h.users.ResolveFederated(r.Context(), tenantMW.From(r.Context()).ID, userStore.Identity{
+		Provider:      provider,
+		Subject:       id.Subject,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+	})
+	if err != nil || !linked {
+		return user, err
+	}
+
+	err = h.events.Record(r.Context(), eventStore.Event{
+		Kind:      eventStore.KindIdentityLinked,
+		Subject:   user.ID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    map[string]string{"provider": provider, "provider_subject": id.Subject},
+	})
+	if err != nil {
+		log.Printf("record security event %s: %v", eventStore.KindIdentityLinked, err)
+	}
+	return user, nil
+}
+
+// saveFederatedLogin stores fl under a new random state and returns it.
+func (h *Handler) saveFederatedLogin(ctx context.Context, fl federatedLogin) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	data, err := json.Marshal(fl)
+	if err != nil {
+		return "", err
+	}
+	if err := h.cache.Set(ctx, codeKey("federated_state:", state), string(data), federatedTTL); err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// takeFederatedLogin consumes state, so each can complete one sign-in.
+func (h *Handler) takeFederatedLogin(ctx context.Context, state string) (federatedLogin, bool) {
+	var fl federatedLogin
+	if state == "" {
+		return fl, false
+	}
+	data, err := h.cache.GetDel(ctx, codeKey("federated_state:", state))
+	if err != nil || json.Unmarshal([]byte(data), &fl) != nil {
+		return fl, false
+	}
+	return fl, true
+}
@@ -0,0 +1,91 @@
+package oauth
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"auth-as-a-service/app/http/httpkit"
+	"auth-as-a-service/app/http/signin"
+)
+
+// mfaPage asks a user with MFA enabled for their second factor after a
+// correct password. What the sign-in was for rides along in hidden fields;
+// the password does not.
+var mfaPage = template.Must(template.New("mfa").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Two-step verification</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .25rem 0 1rem; padding: .5rem; }
+button { padding: .6rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Two-step verification</h1>
+<p>Enter the code from your authenticator app, or one of your recovery codes.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+{{range $name, $values := .Fields}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label for="code">Code</label>
+<input id="code" name="code" inputmode="numeric" autocomplete="one-time-code" autofocus>
+<label for="recovery_code">Recovery code</label>
+<input id="recovery_code" name="recovery_code" autocomplete="off">
+<button type="submit">Verify</button>
+</form>
+</body>
+</html>
+`))
+
+type mfaData struct {
+	// Action is where the form is posted, the page's own URL when empty.
+	Action string
+	// Fields are posted back with the code so the sign-in can resume.
+	Fields   url.Values
+	MFAToken string
+	Error    string
+}
+
+// requireMFA shows the MFA form in place of finishing the sign-in when
+// userID has MFA enabled, and reports whether it did. The form posts to
+// action, or back to the page when it is empty.
+func (h *Handler) requireMFA(w http.ResponseWriter, r *http.Request, userID, purpose, action string, fields url.Values) (bool, error) {
+	tok, ok, err := h.signin.StartMFA(r, userID, purpose, nil)
+	if err != nil || !ok {
+		return false, err
+	}
+	renderPage(w, http.StatusOK, mfaPage, mfaData{Action: action, Fields: fields, MFAToken: tok})
+	return true, nil
+}
+
+// secondFactor checks the code posted with the MFA form and returns the
+// user the challenge was started for. A wrong code shows the form again;
+// a challenge that cannot go on goes to restart with the status and
+// message to show with the sign-in form.
+func (h *Handler) secondFactor(w http.ResponseWriter, r *http.Request, purpose string, fields url.Values, restart func(status int, message string)) (string, bool) {
+	tok := r.PostFormValue("mfa_token")
+	c, err := h.signin.VerifyMFA(r, tok, purpose, r.PostFormValue("code"), r.PostFormValue("recovery_code"))
+	var refused httpkit.Error
+	switch {
+	case err == nil:
+		return c.UserID, true
+	case errors.Is(err, signin.ErrInvalidCode):
+		renderPage(w, http.StatusUnauthorized, mfaPage, mfaData{Fields: fields, MFAToken: tok, Error: "Invalid code."})
+	case errors.Is(err, signin.ErrInvalidMFAToken):
+		restart(http.StatusUnauthorized, "Your sign-in expired. Please sign in again.")
+	case errors.As(err, &refused):
+		restart(refused.Code, refused.Message+".")
+	default:
+		log.Printf("%s: verify second factor: %v", purpose, err)
+		renderPage(w, http.StatusInternalServerError, errorPage, "Something went wrong. Please try again.")
+	}
+	return "", false
+}
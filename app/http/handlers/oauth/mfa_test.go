@@ -0,0 +1,410 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-as-a-service/app/async/tenants"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/pkce"
+)
+
+const (
+	testPassword = "correct horse"
+	testCode     = "123456"
+	redirectURI  = "https://app.test/callback"
+)
+
+// memCache is an in-memory redis.Service.
+type memCache struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newMemCache() *memCache {
+	return &memCache{data: make(map[string]string)}
+}
+
+func (m *memCache) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func (m *memCache) Set(_ context.Context, key string, value any, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = fmt.Sprintf("%v", value)
+	return nil
+}
+
+func (m *memCache) SetNX(_ context.Context, key string, value any, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		return false, nil
+	}
+	m.data[key] = fmt.Sprintf("%v", value)
+	return true, nil
+}
+
+func (m *memCache) GetDel(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	delete(m.data, key)
+	return v, nil
+}
+
+func (m *memCache) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(m.data[key], 10, 64)
+	n++
+	m.data[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (m *memCache) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func (m *memCache) Health() map[string]string { return nil }
+func (m *memCache) Close() error              { return nil }
+
+// fakeAuthenticator knows one password for every user and one code for
+// those with MFA enabled.
+type fakeAuthenticator struct {
+	users map[string]userStore.User
+	mfa   map[string]bool
+
+	mu         sync.Mutex
+	challenges map[string]signin.Challenge
+}
+
+func (a *fakeAuthenticator) Authenticate(_ *http.Request, email, password string) (userStore.User, error) {
+	user, ok := a.users[email]
+	if !ok || password != testPassword {
+		return userStore.User{}, signin.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (a *fakeAuthenticator) StartMFA(_ *http.Request, userID, purpose string, data map[string]string) (string, bool, error) {
+	if !a.mfa[userID] {
+		return "", false, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tok := rand.Text()
+	a.challenges[tok] = signin.Challenge{UserID: userID, Purpose: purpose, Data: data}
+	return tok, true, nil
+}
+
+func (a *fakeAuthenticator) VerifyMFA(_ *http.Request, tok, purpose, code, _ string) (signin.Challenge, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.challenges[tok]
+	if !ok || c.Purpose != purpose {
+		return signin.Challenge{}, signin.ErrInvalidMFAToken
+	}
+	if code != testCode {
+		return signin.Challenge{}, signin.ErrInvalidCode
+	}
+	delete(a.challenges, tok)
+	return c, nil
+}
+
+type fakeClients map[string]clientStore.Client
+
+func (f fakeClients) Get(_ context.Context, _, id string) (clientStore.Client, error) {
+	c, ok := f[id]
+	if !ok {
+		return c, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+// fakeSessions tracks which sessions exist and which were revoked.
+type fakeSessions struct {
+	mu      sync.Mutex
+	live    map[string]string
+	revoked map[string]bool
+}
+
+func (f *fakeSessions) Create(_ context.Context, id, userID, _, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live[id] = userID
+	return nil
+}
+
+func (f *fakeSessions) Touch(context.Context, string, string) error { return nil }
+
+func (f *fakeSessions) Revoke(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked[id] = true
+	return nil
+}
+
+// fakeRoles gives every user the same roles and grants no permissions.
+type fakeRoles []string
+
+func (f fakeRoles) NamesForUser(context.Context, string, string) ([]string, error) { return f, nil }
+func (f fakeRoles) HasPermission(context.Context, string, []string, string) (bool, error) {
+	return false, nil
+}
+
+type discardEvents struct{}
+
+func (discardEvents) Record(context.Context, eventStore.Event) error { return nil }
+
+var testTenant = &tenants.Tenant{ID: "tenant-1", Slug: "default"}
+
+func newTestHandler() (*Handler, *memCache) {
+	cache := newMemCache()
+	h := &Handler{
+		clients: fakeClients{"app": {
+			ID:           "app",
+			TenantID:     testTenant.ID,
+			Name:         "App",
+			RedirectURIs: clientStore.List{redirectURI},
+			GrantTypes:   clientStore.List{clientStore.GrantAuthorizationCode, clientStore.GrantDeviceCode},
+		}},
+		signin: &fakeAuthenticator{
+			users: map[string]userStore.User{
+				"plain@example.com": {ID: "user-plain", TenantID: testTenant.ID, Email: "plain@example.com"},
+				"mfa@example.com":   {ID: "user-mfa", TenantID: testTenant.ID, Email: "mfa@example.com"},
+			},
+			mfa:        map[string]bool{"user-mfa": true},
+			challenges: make(map[string]signin.Challenge),
+		},
+		sessions: &fakeSessions{live: make(map[string]string), revoked: make(map[string]bool)},
+		roles:    fakeRoles{},
+		events:   discardEvents{},
+		cache:    cache,
+	}
+	return h, cache
+}
+
+func post(handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(tenantMW.WithTenant(r.Context(), testTenant))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+var mfaTokenField = regexp.MustCompile(`name="mfa_token" value="([^"]+)"`)
+
+// mfaToken returns the token of the MFA form in w's body.
+func mfaToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	m := mfaTokenField.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("expected the MFA form, got %d: %s", w.Code, w.Body.String())
+	}
+	return m[1]
+}
+
+func authorizeForm(email string) url.Values {
+	verifier, _ := pkce.NewVerifier()
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"app"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkce.Challenge(verifier)},
+		"code_challenge_method": {pkce.MethodS256},
+		"email":                 {email},
+		"password":              {testPassword},
+	}
+}
+
+// issuedCode returns the code w redirected to the client with, if any.
+func issuedCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse location: %v", err)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestAuthorizeWithoutMFA(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := post(h.authorizeSubmit, authorizeForm("plain@example.com"))
+	if w.Code != http.StatusFound || issuedCode(t, w) == "" {
+		t.Fatalf("expected a code for a user without MFA, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthorizeRequiresSecondFactor(t *testing.T) {
+	h, cache := newTestHandler()
+
+	// The password alone earns the MFA form, not a code.
+	form := authorizeForm("mfa@example.com")
+	w := post(h.authorizeSubmit, form)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Fatalf("expected the MFA form for the password alone, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if len(cache.data) != 0 {
+		t.Fatalf("expected no code stored for the password alone, got %v", cache.data)
+	}
+	tok := mfaToken(t, w)
+	if strings.Contains(w.Body.String(), testPassword) {
+		t.Fatal("expected the MFA form not to carry the password")
+	}
+
+	// Neither a wrong code nor a made-up token gets one.
+	for _, tt := range []struct{ tok, code string }{
+		{tok, "000000"},
+		{"made-up", testCode},
+	} {
+		form.Set("mfa_token", tt.tok)
+		form.Set("code", tt.code)
+		w = post(h.authorizeSubmit, form)
+		if w.Code == http.StatusFound || len(cache.data) != 0 {
+			t.Fatalf("token %q code %q: expected no code, got %d to %q", tt.tok, tt.code, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	form.Set("mfa_token", tok)
+	form.Set("code", testCode)
+	w = post(h.authorizeSubmit, form)
+	if w.Code != http.StatusFound || issuedCode(t, w) == "" {
+		t.Fatalf("expected a code after the second factor, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthorizeRefusesDeviceChallenge(t *testing.T) {
+	h, _ := newTestHandler()
+
+	tok, _, _ := h.signin.StartMFA(nil, "user-mfa", signin.PurposeDevice, nil)
+	form := authorizeForm("")
+	form.Set("mfa_token", tok)
+	form.Set("code", testCode)
+	if w := post(h.authorizeSubmit, form); w.Code == http.StatusFound {
+		t.Fatalf("expected a challenge for a device not to issue a code, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestDeviceRequiresSecondFactor(t *testing.T) {
+	h, _ := newTestHandler()
+	ctx := context.Background()
+
+	deviceCode, userCode, err := h.issueDeviceCode(ctx, deviceAuthorization{
+		TenantID:  testTenant.ID,
+		userGrant: userGrant{ClientID: "app"},
+		Status:    devicePending,
+		ExpiresAt: time.Now().Add(deviceCodeTTL).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("issue device code: %v", err)
+	}
+	status := func() deviceAuthorization {
+		t.Helper()
+		da, ok := h.loadDevice(ctx, codeKey("device_code:", deviceCode))
+		if !ok {
+			t.Fatal("expected the device authorization to be stored")
+		}
+		return da
+	}
+
+	// The password alone earns the MFA form, not an approval.
+	form := url.Values{
+		"user_code": {userCode},
+		"email":     {"mfa@example.com"},
+		"password":  {testPassword},
+		"action":    {"approve"},
+	}
+	w := post(h.deviceSubmit, form)
+	tok := mfaToken(t, w)
+	if da := status(); da.Status != devicePending || da.UserID != "" {
+		t.Fatalf("expected the device still pending after the password alone, got %+v", da)
+	}
+
+	// Neither a wrong code nor a made-up token approves it.
+	for _, tt := range []struct{ tok, code string }{
+		{tok, "000000"},
+		{"made-up", testCode},
+	} {
+		w = post(h.deviceSubmit, url.Values{"user_code": {userCode}, "action": {"approve"}, "mfa_token": {tt.tok}, "code": {tt.code}})
+		if da := status(); da.Status != devicePending {
+			t.Fatalf("token %q code %q: expected the device still pending, got %+v", tt.tok, tt.code, da)
+		}
+	}
+
+	w = post(h.deviceSubmit, url.Values{"user_code": {userCode}, "action": {"approve"}, "mfa_token": {tok}, "code": {testCode}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the device approved, got %d: %s", w.Code, w.Body.String())
+	}
+	if da := status(); da.Status != deviceApproved || da.UserID != "user-mfa" {
+		t.Fatalf("expected the device approved for user-mfa, got %+v", da)
+	}
+}
+
+func TestFederatedSignInRequiresSecondFactor(t *testing.T) {
+	h, cache := newTestHandler()
+	client, _ := h.clients.Get(context.Background(), testTenant.ID, "app")
+
+	// The provider vouches for the user, who still owes their second
+	// factor, given on the form that goes on to /oauth/authorize.
+	form := authorizeForm("")
+	form.Del("email")
+	form.Del("password")
+	r := httptest.NewRequest(http.MethodGet, "/oauth/federated/corp/callback?"+form.Encode(), nil)
+	r = r.WithContext(tenantMW.WithTenant(r.Context(), testTenant))
+	w := httptest.NewRecorder()
+	h.finishFederated(w, r, parseAuthorizeRequest(r), client, "user-mfa")
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" || len(cache.data) != 0 {
+		t.Fatalf("expected the MFA form and no code, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if !strings.Contains(w.Body.String(), `action="/oauth/authorize"`) {
+		t.Fatalf("expected the MFA form to post to /oauth/authorize, got %s", w.Body.String())
+	}
+
+	form.Set("mfa_token", mfaToken(t, w))
+	form.Set("code", testCode)
+	w = post(h.authorizeSubmit, form)
+	if w.Code != http.StatusFound || issuedCode(t, w) == "" {
+		t.Fatalf("expected a code after the second factor, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A user without MFA gets the code straight away.
+	w = httptest.NewRecorder()
+	h.finishFederated(w, r, parseAuthorizeRequest(r), client, "user-plain")
+	if w.Code != http.StatusFound || issuedCode(t, w) == "" {
+		t.Fatalf("expected a code for a user without MFA, got %d: %s", w.Code, w.Body.String())
+	}
+}
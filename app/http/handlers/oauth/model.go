@@ -0,0 +1,164 @@
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// tokenRequest is the form body shared by introspection and revocation.
+// The hint is accepted but not needed: the token's own type claim decides.
+type tokenRequest struct {
+	Token         string `validate:"required"`
+	TokenTypeHint string
+}
+
+func (r *tokenRequest) SetForm(field, value string) error {
+	switch field {
+	case "token":
+		r.Token = value
+	case "token_type_hint":
+		r.TokenTypeHint = value
+	}
+	return nil
+}
+
+// grantRequest is the token endpoint form. Which fields are required
+// depends on grant_type, so each grant checks its own.
+type grantRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+	Scope        string
+	DeviceCode   string
+	RefreshToken string
+	// Token exchange (RFC 8693 section 2.1). RequestedSubject names the
+	// user to impersonate.
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	RequestedTokenType string
+	RequestedSubject   string
+	Audience           string
+}
+
+func (r *grantRequest) SetForm(field, value string) error {
+	switch field {
+	case "grant_type":
+		r.GrantType = value
+	case "code":
+		r.Code = value
+	case "redirect_uri":
+		r.RedirectURI = value
+	case "client_id":
+		r.ClientID = value
+	case "client_secret":
+		r.ClientSecret = value
+	case "code_verifier":
+		r.CodeVerifier = value
+	case "scope":
+		r.Scope = value
+	case "device_code":
+		r.DeviceCode = value
+	case "refresh_token":
+		r.RefreshToken = value
+	case "subject_token":
+		r.SubjectToken = value
+	case "subject_token_type":
+		r.SubjectTokenType = value
+	case "actor_token":
+		r.ActorToken = value
+	case "actor_token_type":
+		r.ActorTokenType = value
+	case "requested_token_type":
+		r.RequestedTokenType = value
+	case "requested_subject":
+		r.RequestedSubject = value
+	case "audience":
+		r.Audience = value
+	}
+	return nil
+}
+
+// tokenResponse is the RFC 6749 section 5.1 success response.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// IssuedTokenType is set for token exchange (RFC 8693 section 2.2.1).
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+}
+
+// deviceAuthorizationResponse is the RFC 8628 section 3.2 response.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// errorResponse is the RFC 6749 section 5.2 error response.
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// authorizeRequest holds the authorization request parameters, read from
+// the query string on GET and echoed back through the login form on POST.
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// values encodes the request as query parameters again.
+func (a authorizeRequest) values() url.Values {
+	v := url.Values{}
+	for name, value := range map[string]string{
+		"response_type":         a.ResponseType,
+		"client_id":             a.ClientID,
+		"redirect_uri":          a.RedirectURI,
+		"scope":                 a.Scope,
+		"state":                 a.State,
+		"code_challenge":        a.CodeChallenge,
+		"code_challenge_method": a.CodeChallengeMethod,
+		"nonce":                 a.Nonce,
+	} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	return v
+}
+
+func parseAuthorizeRequest(r *http.Request) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Nonce:               r.FormValue("nonce"),
+	}
+}
+
+type userinfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/sdk/token"
+)
+
+func (h *Handler) introspect(r *http.Request) (*httpkit.Response, error) {
+	if err := h.authenticateResourceServer(r); err != nil {
+		return nil, err
+	}
+
+	req, err := httpkit.DecodeForm[*tokenRequest](r, "token", "token_type_hint")
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body:   tenantMW.From(r.Context()).Verifier.Introspect(r.Context(), req.Token),
+	}, nil
+}
+
+// revoke implements RFC 7009. Possession of a validly signed token is what
+// authorizes its revocation, so no client authentication is required.
+func (h *Handler) revoke(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeForm[*tokenRequest](r, "token", "token_type_hint")
+	if err != nil {
+		return nil, err
+	}
+
+	// Invalid, forged and unknown tokens still get a 200 (RFC 7009 section 2.2).
+	err = tenantMW.From(r.Context()).Verifier.RevokeGrant(r.Context(), req.Token)
+	if err != nil && !errors.Is(err, token.ErrInvalidToken) {
+		return nil, err
+	}
+
+	return &httpkit.Response{Status: http.StatusOK}, nil
+}
+
+// authenticateResourceServer checks HTTP Basic credentials against
+// INTROSPECTION_CLIENTS.
+func (h *Handler) authenticateResourceServer(r *http.Request) error {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return httpkit.ClientErr(http.StatusUnauthorized, "invalid client")
+	}
+
+	want, known := h.resourceServers[id]
+	if !known || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 {
+		return httpkit.ClientErr(http.StatusUnauthorized, "invalid client")
+	}
+	return nil
+}
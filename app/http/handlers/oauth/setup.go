@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	"auth-as-a-service/app/http/middleware/ratelimiter"
+	"auth-as-a-service/app/http/signin"
+	"auth-as-a-service/app/memory/redis"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	roleStore "auth-as-a-service/app/memory/store/role"
+	sessionStore "auth-as-a-service/app/memory/store/session"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/oidc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// authenticator checks what users post to the sign-in forms, passwords
+// and second factors alike. The signin service implements it.
+type authenticator interface {
+	Authenticate(r *http.Request, email, password string) (userStore.User, error)
+	StartMFA(r *http.Request, userID, purpose string, data map[string]string) (string, bool, error)
+	VerifyMFA(r *http.Request, tok, purpose, code, recoveryCode string) (signin.Challenge, error)
+}
+
+// clientFinder looks up a tenant's registered clients. The client store
+// implements it.
+type clientFinder interface {
+	Get(ctx context.Context, tenantID, id string) (clientStore.Client, error)
+}
+
+// sessionTracker keeps the sessions behind token families. The session
+// store implements it.
+type sessionTracker interface {
+	Create(ctx context.Context, id, userID, userAgent, ip string) error
+	Touch(ctx context.Context, id, ip string) error
+	Revoke(ctx context.Context, id string) error
+}
+
+// roleReader looks up users' roles in a tenant and what they grant. The
+// role store implements it.
+type roleReader interface {
+	NamesForUser(ctx context.Context, tenantID, userID string) ([]string, error)
+	HasPermission(ctx context.Context, tenantID string, roles []string, permission string) (bool, error)
+}
+
+// eventRecorder keeps the security event log. The event store implements
+// it.
+type eventRecorder interface {
+	Record(ctx context.Context, e eventStore.Event) error
+}
+
+type Handler struct {
+	users    *userStore.Store
+	sessions sessionTracker
+	roles    roleReader
+	clients  clientFinder
+	events   eventRecorder
+	// signin checks the passwords and second factors posted with the
+	// sign-in forms, as /auth/login and /auth/mfa/verify do.
+	signin authenticator
+	// cache holds authorization and device codes until they are exchanged.
+	cache redis.Service
+	// polls throttles devices polling the token endpoint, one bucket per
+	// device code.
+	polls *ratelimiter.RateLimiter
+	// providers are the upstream OpenID Connect providers users may sign
+	// in with, in the order their buttons are shown.
+	providers []*oidc.Provider
+	// resourceServers maps client IDs allowed to introspect to their secrets.
+	resourceServers map[string]string
+}
+
+func New(users *userStore.Store, sessions *sessionStore.Store, roles *roleStore.Store, clients *clientStore.Store, events *eventStore.Store, signin *signin.Service, cache redis.Service, polls *ratelimiter.RateLimiter, providers []*oidc.Provider) *Handler {
+	return &Handler{
+		users:           users,
+		sessions:        sessions,
+		roles:           roles,
+		clients:         clients,
+		events:          events,
+		signin:          signin,
+		cache:           cache,
+		polls:           polls,
+		providers:       providers,
+		resourceServers: parseClients(os.Getenv("INTROSPECTION_CLIENTS")),
+	}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Route("/oauth", func(r chi.Router) {
+		r.Get("/authorize", h.authorizeForm)
+		r.Post("/authorize", h.authorizeSubmit)
+		r.Post("/device_authorization", httpkit.Handle(h.deviceAuthorization))
+		r.Get("/device", h.deviceForm)
+		r.Post("/device", h.deviceSubmit)
+		r.Get("/federated/{provider}", h.federatedStart)
+		r.Get("/federated/{provider}/callback", h.federatedCallback)
+		r.Post("/token", httpkit.Handle(h.token))
+		r.Post("/introspect", httpkit.Handle(h.introspect))
+		r.Post("/revoke", httpkit.Handle(h.revoke))
+	})
+	r.With(authMW.RequireAuth(), authMW.RequireScope("openid")).Get("/userinfo", httpkit.Handle(h.userinfo))
+}
+
+// parseClients reads a comma-separated list of id:secret pairs.
+func parseClients(s string) map[string]string {
+	clients := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && id != "" && secret != "" {
+			clients[id] = secret
+		}
+	}
+	return clients
+}
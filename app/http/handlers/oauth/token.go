@@ -0,0 +1,401 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	clientStore "auth-as-a-service/app/memory/store/client"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	"auth-as-a-service/sdk/crypto"
+	"auth-as-a-service/sdk/pkce"
+	"auth-as-a-service/sdk/token"
+)
+
+// token is the RFC 6749 token endpoint.
+func (h *Handler) token(r *http.Request) (*httpkit.Response, error) {
+	req, err := httpkit.DecodeForm[*grantRequest](r,
+		"grant_type", "code", "redirect_uri", "client_id", "client_secret", "code_verifier", "scope", "device_code",
+		"refresh_token", "subject_token", "subject_token_type", "actor_token", "actor_token_type",
+		"requested_token_type", "requested_subject", "audience")
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case clientStore.GrantAuthorizationCode:
+		return h.authorizationCodeGrant(r, req)
+	case clientStore.GrantClientCredentials:
+		return h.clientCredentialsGrant(r, req)
+	case clientStore.GrantRefreshToken:
+		return h.refreshTokenGrant(r, req)
+	case clientStore.GrantDeviceCode:
+		return h.deviceCodeGrant(r, req)
+	case clientStore.GrantTokenExchange:
+		return h.tokenExchangeGrant(r, req)
+	case "":
+		return tokenError(http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		return tokenError(http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// authorizationCodeGrant exchanges a code from /oauth/authorize for tokens
+// (RFC 6749 section 4.1.3), checking the PKCE verifier against the
+// challenge the code was issued for.
+func (h *Handler) authorizationCodeGrant(r *http.Request, req *grantRequest) (*httpkit.Response, error) {
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if !client.AllowsGrant(clientStore.GrantAuthorizationCode) {
+		return tokenError(http.StatusBadRequest, "unauthorized_client", "")
+	}
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		return tokenError(http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+	}
+
+	t := tenantMW.From(r.Context())
+	ac, ok := h.redeemCode(r.Context(), req.Code)
+	if !ok {
+		// A code presented twice may have been stolen, so the tokens it
+		// was first exchanged for are revoked (RFC 6749 section 4.1.2).
+		if family, redeemed := h.redeemedFamily(r.Context(), req.Code); redeemed {
+			if err := t.Verifier.RevokeFamily(r.Context(), family); err != nil {
+				log.Printf("revoke family of replayed code: %v", err)
+			}
+			if err := h.sessions.Revoke(r.Context(), family); err != nil {
+				log.Printf("revoke session of replayed code: %v", err)
+			}
+		}
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+	if ac.TenantID != t.ID || ac.ClientID != client.ID || ac.RedirectURI != req.RedirectURI ||
+		!pkce.Verify(req.CodeVerifier, ac.CodeChallenge) {
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+
+	resp, family, err := h.issueUserTokens(r, ac.userGrant)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.markRedeemed(r.Context(), req.Code, family); err != nil {
+		log.Printf("remember redeemed code: %v", err)
+	}
+	return resp, nil
+}
+
+// issueUserTokens starts a session for g and issues its access and refresh
+// tokens, plus an ID token when openid was granted. It returns the response
+// and the new token family.
+func (h *Handler) issueUserTokens(r *http.Request, g userGrant) (*httpkit.Response, string, error) {
+	t := tenantMW.From(r.Context())
+	roles, err := h.roles.NamesForUser(r.Context(), t.ID, g.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	family := token.NewFamily()
+	if err := h.sessions.Create(r.Context(), family, g.UserID, r.UserAgent(), httpkit.ClientIP(r)); err != nil {
+		return nil, "", err
+	}
+
+	claims := token.Claims{
+		Subject: g.UserID,
+		Family:  family,
+		Scopes:  g.Scopes,
+		Roles:   roles,
+		Custom:  map[string]any{"client_id": g.ClientID},
+	}
+	accessTok, err := t.Issuer.Generate(r.Context(), claims)
+	if err != nil {
+		return nil, "", err
+	}
+	refreshTok, err := t.Issuer.GenerateRefresh(r.Context(), claims)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var idTok string
+	if slices.Contains(g.Scopes, "openid") {
+		if idTok, err = h.idToken(r, g); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body: tokenResponse{
+			AccessToken:  accessTok,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(t.Issuer.Config().AccessTTL.Seconds()),
+			RefreshToken: refreshTok,
+			Scope:        strings.Join(g.Scopes, " "),
+			IDToken:      idTok,
+		},
+	}, family, nil
+}
+
+// idToken issues the OpenID Connect ID token for g. The email claims are
+// only included when the email scope was granted.
+func (h *Handler) idToken(r *http.Request, g userGrant) (string, error) {
+	t := tenantMW.From(r.Context())
+	claims := token.IDClaims{
+		Subject:  g.UserID,
+		ClientID: g.ClientID,
+		Nonce:    g.Nonce,
+		AuthTime: time.Unix(g.AuthTime, 0),
+	}
+	if slices.Contains(g.Scopes, "email") {
+		user, err := h.users.GetByID(r.Context(), t.ID, g.UserID)
+		if err != nil {
+			return "", err
+		}
+		claims.Email = user.Email
+		claims.EmailVerified = user.EmailVerified
+	}
+	return t.Issuer.GenerateIDToken(claims)
+}
+
+// refreshTokenGrant rotates a refresh token the client was issued for a new
+// pair (RFC 6749 section 6), as /auth/refresh does for first-party logins.
+// The scope may only narrow, and roles are read afresh.
+func (h *Handler) refreshTokenGrant(r *http.Request, req *grantRequest) (*httpkit.Response, error) {
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if req.RefreshToken == "" {
+		return tokenError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+
+	t := tenantMW.From(r.Context())
+	grant, err := t.Verifier.ValidateRefresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		var reuse *token.ReuseError
+		if errors.As(err, &reuse) {
+			h.recordReuse(r, reuse)
+		}
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+	// Only the client the token was issued to may redeem it. Tokens from
+	// /auth/login carry no client and stay with /auth/refresh.
+	if clientID, _ := grant.Custom["client_id"].(string); clientID != client.ID {
+		return tokenError(http.StatusBadRequest, "invalid_grant", "")
+	}
+	// A bound token is only redeemed with a proof signed by its key, so
+	// the binding carries over to the new pair.
+	jkt, denied := exchangeProof(r)
+	if denied != nil {
+		return tokenError(denied.status, denied.code, denied.description)
+	}
+	if grant.KeyThumbprint != "" && jkt != grant.KeyThumbprint {
+		return tokenError(http.StatusBadRequest, "invalid_grant", "refresh_token is DPoP-bound; send a proof signed with its key")
+	}
+
+	scopes := grant.Scopes
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !slices.Contains(grant.Scopes, s) {
+				return tokenError(http.StatusBadRequest, "invalid_scope", "scope exceeds the scope originally granted")
+			}
+		}
+		scopes = token.GrantScopes(requested, grant.Scopes)
+	}
+
+	// Spending the token before issuing the next pair makes concurrent
+	// refreshes with it count as reuse rather than all succeeding.
+	if err := t.Verifier.Rotate(r.Context(), req.RefreshToken, grant); err != nil {
+		var reuse *token.ReuseError
+		if errors.As(err, &reuse) {
+			h.recordReuse(r, reuse)
+			return tokenError(http.StatusBadRequest, "invalid_grant", "")
+		}
+		return nil, err
+	}
+
+	if err := h.sessions.Touch(r.Context(), grant.Family, httpkit.ClientIP(r)); err != nil {
+		return nil, err
+	}
+	roles, err := h.roles.NamesForUser(r.Context(), t.ID, grant.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims{
+		Subject:       grant.Subject,
+		Family:        grant.Family,
+		Audience:      grant.Audience,
+		Scopes:        scopes,
+		Roles:         roles,
+		KeyThumbprint: grant.KeyThumbprint,
+		Custom:        map[string]any{"client_id": client.ID},
+	}
+	accessTok, err := t.Issuer.Generate(r.Context(), claims)
+	if err != nil {
+		return nil, err
+	}
+	refreshTok, err := t.Issuer.GenerateRefresh(r.Context(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenType := "Bearer"
+	if claims.KeyThumbprint != "" {
+		tokenType = "DPoP"
+	}
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body: tokenResponse{
+			AccessToken:  accessTok,
+			TokenType:    tokenType,
+			ExpiresIn:    int(t.Issuer.Config().AccessTTL.Seconds()),
+			RefreshToken: refreshTok,
+			Scope:        strings.Join(scopes, " "),
+		},
+	}, nil
+}
+
+// recordReuse revokes the session of a refresh token family found replayed
+// and records the event, as /auth/refresh does.
+func (h *Handler) recordReuse(r *http.Request, reuse *token.ReuseError) {
+	log.Printf("security: refresh token reuse for user %s, family %s revoked", reuse.UserID, reuse.Family)
+
+	if err := h.sessions.Revoke(r.Context(), reuse.Family); err != nil {
+		log.Printf("revoke session %s: %v", reuse.Family, err)
+	}
+	err := h.events.Record(r.Context(), eventStore.Event{
+		Kind:      eventStore.KindRefreshReuse,
+		Subject:   reuse.UserID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    map[string]string{"family": reuse.Family, "jti": reuse.TokenID},
+	})
+	if err != nil {
+		log.Printf("record security event: %v", err)
+	}
+}
+
+// clientCredentialsGrant issues an access token to a confidential client
+// acting on its own behalf (RFC 6749 section 4.4). The token's subject is
+// the client ID and no refresh token is issued.
+func (h *Handler) clientCredentialsGrant(r *http.Request, req *grantRequest) (*httpkit.Response, error) {
+	client, err := h.authenticateClient(r, req)
+	if err != nil {
+		return nil, err
+	}
+	// A public client cannot authenticate, so it cannot act on its own behalf.
+	if client == nil || client.Public() {
+		return tokenError(http.StatusUnauthorized, "invalid_client", "")
+	}
+	if !client.AllowsGrant(clientStore.GrantClientCredentials) {
+		return tokenError(http.StatusBadRequest, "unauthorized_client", "")
+	}
+
+	// No scope requested means every scope the client is allowed.
+	scopes := []string(client.Scopes)
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !slices.Contains(client.Scopes, s) {
+				return tokenError(http.StatusBadRequest, "invalid_scope", "scope exceeds what the client is allowed")
+			}
+		}
+		scopes = token.GrantScopes(requested, client.Scopes)
+	}
+
+	t := tenantMW.From(r.Context())
+	accessTok, err := t.Issuer.Generate(r.Context(), token.Claims{
+		Subject: client.ID,
+		Scopes:  scopes,
+		Custom:  map[string]any{"client_id": client.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body: tokenResponse{
+			AccessToken: accessTok,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(t.Issuer.Config().AccessTTL.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		},
+	}, nil
+}
+
+// authenticateClient identifies the client by HTTP Basic credentials or the
+// client_id form field. Confidential clients must present their secret;
+// public clients are identified only. It returns nil for unknown clients
+// and bad secrets.
+func (h *Handler) authenticateClient(r *http.Request, req *grantRequest) (*clientStore.Client, error) {
+	id, secret := req.ClientID, req.ClientSecret
+	if basicID, basicSecret, ok := r.BasicAuth(); ok {
+		id, secret = basicID, basicSecret
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	client, err := h.clients.Get(r.Context(), tenantMW.From(r.Context()).ID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if client.Public() {
+		return &client, nil
+	}
+	if secret == "" {
+		return nil, nil
+	}
+	ok, err := secretMatches(client, secret, time.Now())
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// secretMatches checks secret against the client's current secret and,
+// during the overlap after a rotation, its previous one.
+func secretMatches(client clientStore.Client, secret string, now time.Time) (bool, error) {
+	ok, err := crypto.VerifyPassword(secret, *client.SecretHash)
+	if err != nil || ok {
+		return ok, err
+	}
+	if client.PreviousSecretHash == nil || client.PreviousSecretExpiresAt == nil || !now.Before(*client.PreviousSecretExpiresAt) {
+		return false, nil
+	}
+	return crypto.VerifyPassword(secret, *client.PreviousSecretHash)
+}
+
+// tokenError writes an RFC 6749 section 5.2 error.
+func tokenError(status int, code, description string) (*httpkit.Response, error) {
+	return &httpkit.Response{
+		Status: status,
+		Header: noStore(),
+		Body:   errorResponse{Error: code, Description: description},
+	}, nil
+}
+
+// noStore is required on every token endpoint response (RFC 6749 section 5.1).
+func noStore() http.Header {
+	return http.Header{"Cache-Control": {"no-store"}}
+}
@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	clientStore "auth-as-a-service/app/memory/store/client"
+)
+
+func TestRefreshTokenGrant(t *testing.T) {
+	h, cache := newTestHandler()
+	h.clients.(fakeClients)["other"] = clientStore.Client{ID: "other", TenantID: testTenant.ID}
+	tn := tokenTenant(t, cache)
+
+	redeem := func(form url.Values) (int, tokenResponse, errorResponse) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(tenantMW.WithTenant(r.Context(), tn))
+		resp, err := h.token(r)
+		if err != nil {
+			t.Fatalf("token: %v", err)
+		}
+		body, _ := json.Marshal(resp.Body)
+		var ok tokenResponse
+		var failed errorResponse
+		json.Unmarshal(body, &ok)
+		json.Unmarshal(body, &failed)
+		return resp.Status, ok, failed
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", nil)
+	r = r.WithContext(tenantMW.WithTenant(r.Context(), tn))
+	resp, family, err := h.issueUserTokens(r, userGrant{ClientID: "app", UserID: "user-plain", Scopes: []string{"orders:read", "orders:write"}})
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+	first := resp.Body.(tokenResponse).RefreshToken
+
+	// Another client cannot redeem it, and cannot widen it.
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {first}, "client_id": {"other"}}
+	if status, _, failed := redeem(form); status != http.StatusBadRequest || failed.Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for another client, got %d %q", status, failed.Error)
+	}
+	form.Set("client_id", "app")
+	form.Set("scope", "orders:read billing:read")
+	if status, _, failed := redeem(form); status != http.StatusBadRequest || failed.Error != "invalid_scope" {
+		t.Fatalf("expected invalid_scope for a wider scope, got %d %q", status, failed.Error)
+	}
+
+	// The client it was issued to gets a new pair, narrowed if it asks.
+	form.Set("scope", "orders:read")
+	status, pair, _ := redeem(form)
+	if status != http.StatusOK || pair.AccessToken == "" || pair.RefreshToken == "" || pair.Scope != "orders:read" {
+		t.Fatalf("expected a new pair for orders:read, got %d %+v", status, pair)
+	}
+	claims, err := tn.Verifier.ValidateRefresh(r.Context(), pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("validate rotated refresh token: %v", err)
+	}
+	if claims.Family != family || claims.Custom["client_id"] != "app" {
+		t.Fatalf("expected the rotated token in family %s for app, got %s for %v", family, claims.Family, claims.Custom["client_id"])
+	}
+
+	// Spent, the first token is reuse: it fails and ends the session.
+	form.Del("scope")
+	if status, _, failed := redeem(form); status != http.StatusBadRequest || failed.Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for a spent token, got %d %q", status, failed.Error)
+	}
+	if !h.sessions.(*fakeSessions).revoked[family] {
+		t.Fatal("expected the session revoked after reuse")
+	}
+	form.Set("refresh_token", pair.RefreshToken)
+	if status, _, _ := redeem(form); status == http.StatusOK {
+		t.Fatal("expected the family revoked after reuse")
+	}
+}
@@ -0,0 +1,51 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"auth-as-a-service/app/http/httpkit"
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+)
+
+// userinfo is the OpenID Connect UserInfo endpoint. Email claims are only
+// released to tokens granted the email scope.
+func (h *Handler) userinfo(r *http.Request) (*httpkit.Response, error) {
+	claims := authMW.ClaimsFrom(r.Context())
+
+	// Client credentials tokens name a client, not a user in this tenant.
+	if !authMW.IsUser(claims) {
+		return invalidToken()
+	}
+	user, err := h.users.GetByID(r.Context(), tenantMW.From(r.Context()).ID, claims.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return invalidToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body := userinfoResponse{Subject: user.ID}
+	if claims.HasScope("email") {
+		body.Email = user.Email
+		body.EmailVerified = &user.EmailVerified
+	}
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Header: noStore(),
+		Body:   body,
+	}, nil
+}
+
+// invalidToken answers a token that names no user (RFC 6750 section 3.1).
+func invalidToken() (*httpkit.Response, error) {
+	header := http.Header{}
+	header.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return &httpkit.Response{
+		Status: http.StatusUnauthorized,
+		Header: header,
+		Body:   errorResponse{Error: "invalid_token"},
+	}, nil
+}
@@ -0,0 +1,37 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authMW "auth-as-a-service/app/http/middleware/auth"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/sdk/token"
+)
+
+func TestUserinfoRefusesClientToken(t *testing.T) {
+	h, _ := newTestHandler()
+
+	// What clientCredentialsGrant issues: the client is the subject.
+	claims := &token.Claims{
+		Subject: "k3J9x2QpL0aZ7mWc",
+		Scopes:  []string{"openid", "email"},
+		Custom:  map[string]any{"client_id": "k3J9x2QpL0aZ7mWc"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	ctx := tenantMW.WithTenant(r.Context(), testTenant)
+	r = r.WithContext(context.WithValue(ctx, authMW.ClaimsKey, claims))
+
+	resp, err := h.userinfo(r)
+	if err != nil {
+		t.Fatalf("expected a token error, got %v", err)
+	}
+	if resp.Status != http.StatusUnauthorized || resp.Body.(errorResponse).Error != "invalid_token" {
+		t.Fatalf("expected 401 invalid_token, got %d %+v", resp.Status, resp.Body)
+	}
+	if got := resp.Header.Get("WWW-Authenticate"); got != `Bearer error="invalid_token"` {
+		t.Errorf("unexpected WWW-Authenticate %q", got)
+	}
+}
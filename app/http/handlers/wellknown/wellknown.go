@@ -0,0 +1,94 @@
+package wellknown
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	clientStore "auth-as-a-service/app/memory/store/client"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	// scopes are advertised in the discovery document.
+	scopes []string
+}
+
+func New() *Handler {
+	return &Handler{
+		scopes: append([]string{"openid", "email"}, strings.Fields(os.Getenv("USER_SCOPES"))...),
+	}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Get("/.well-known/jwks.json", httpkit.Handle(h.jwks))
+	r.Get("/.well-known/openid-configuration", httpkit.Handle(h.openidConfiguration))
+}
+
+// jwks publishes the request's tenant's verification keys.
+func (h *Handler) jwks(r *http.Request) (*httpkit.Response, error) {
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body:   tenantMW.From(r.Context()).Keys.JWKS(),
+	}, nil
+}
+
+// openidConfiguration serves the OpenID Connect discovery document for the
+// request's tenant. Endpoint URLs are built from the host the request
+// reached, so each tenant's document points at its own host.
+func (h *Handler) openidConfiguration(r *http.Request) (*httpkit.Response, error) {
+	t := tenantMW.From(r.Context())
+	base := httpkit.BaseURL(r)
+
+	var algs []string
+	for _, k := range t.Keys.JWKS().Keys {
+		if !slices.Contains(algs, k.Alg) {
+			algs = append(algs, k.Alg)
+		}
+	}
+
+	return &httpkit.Response{
+		Status: http.StatusOK,
+		Body: discovery{
+			Issuer:                           t.Issuer.Config().Issuer,
+			AuthorizationEndpoint:            base + "/oauth/authorize",
+			TokenEndpoint:                    base + "/oauth/token",
+			UserinfoEndpoint:                 base + "/userinfo",
+			JWKSURI:                          base + "/.well-known/jwks.json",
+			DeviceAuthorizationEndpoint:      base + "/oauth/device_authorization",
+			IntrospectionEndpoint:            base + "/oauth/introspect",
+			RevocationEndpoint:               base + "/oauth/revoke",
+			ScopesSupported:                  h.scopes,
+			ResponseTypesSupported:           []string{"code"},
+			GrantTypesSupported:              []string{clientStore.GrantAuthorizationCode, clientStore.GrantClientCredentials, clientStore.GrantRefreshToken, clientStore.GrantDeviceCode, clientStore.GrantTokenExchange},
+			SubjectTypesSupported:            []string{"public"},
+			IDTokenSigningAlgValuesSupported: algs,
+			TokenEndpointAuthMethods:         []string{"client_secret_basic", "client_secret_post", "none"},
+			CodeChallengeMethodsSupported:    []string{"S256"},
+			ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+		},
+	}, nil
+}
+
+type discovery struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint      string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
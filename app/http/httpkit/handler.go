@@ -15,6 +15,8 @@ var validate = validator.New()
 type Response struct {
 	Status int
 	Body   any
+	// Header holds extra response headers, e.g. Cache-Control.
+	Header http.Header
 }
 
 // Func is the handler signature every endpoint uses.
@@ -45,6 +47,9 @@ func Handle(fn Func) http.HandlerFunc {
 		}
 
 		// Handle response
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
 		if resp.Body != nil {
 			writeJSON(w, resp.Status, resp.Body)
 		} else {
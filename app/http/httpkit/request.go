@@ -0,0 +1,31 @@
+package httpkit
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the caller's address without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestURL returns the absolute URL the client requested, without the
+// query. The scheme comes from the connection itself.
+func RequestURL(r *http.Request) string {
+	return BaseURL(r) + r.URL.EscapedPath()
+}
+
+// BaseURL returns the scheme and host the client addressed, e.g.
+// https://auth.example. The scheme comes from the connection itself.
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -110,6 +110,43 @@ func DecodeQuery[T QuerySetter](r *http.Request, queryParams ...string) (T, erro
 	return req, nil
 }
 
+// FormSetter allows a request struct to receive URL-encoded form fields.
+// Implement this on the pointer receiver of your request type.
+type FormSetter interface {
+	SetForm(field, value string) error
+}
+
+// DecodeForm extracts application/x-www-form-urlencoded fields into T and validates the result.
+// Absent fields are skipped; mark mandatory ones with a required validator tag.
+// T must be a pointer type that implements FormSetter (e.g. *MyRequest).
+func DecodeForm[T FormSetter](r *http.Request, formFields ...string) (T, error) {
+	var req T
+
+	// Allocate if T is a nil pointer.
+	rv := reflect.ValueOf(&req).Elem()
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return req, ClientErr(http.StatusBadRequest, "invalid request body")
+	}
+	for _, key := range formFields {
+		value := r.PostForm.Get(key)
+		if value == "" {
+			continue
+		}
+		if err := req.SetForm(key, value); err != nil {
+			return req, ClientErr(http.StatusBadRequest, "invalid form field: "+key)
+		}
+	}
+
+	if err := validateStruct(req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
 // validateStruct runs validator tags and converts failures into a ValidationError.
 func validateStruct(v any) error {
 	if err := validate.Struct(v); err != nil {
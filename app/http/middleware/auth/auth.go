@@ -5,36 +5,122 @@ import (
 	"net/http"
 	"strings"
 
-	"auth-as-a-service/app/memory/redis"
+	"auth-as-a-service/app/http/httpkit"
+	"auth-as-a-service/app/http/middleware/tenant"
 	"auth-as-a-service/sdk/token"
+
+	"github.com/google/uuid"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const ClaimsKey contextKey = "claims"
+
+// ClaimsFrom returns the claims RequireAuth verified for the request.
+func ClaimsFrom(ctx context.Context) *token.Claims {
+	claims, _ := ctx.Value(ClaimsKey).(*token.Claims)
+	return claims
+}
+
+// Credentials splits the Authorization header into its scheme, Bearer or
+// DPoP, and the token. Both are empty if the header is missing or uses
+// another scheme.
+func Credentials(r *http.Request) (scheme, tok string) {
+	scheme, tok, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || tok == "" {
+		return "", ""
+	}
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return "Bearer", tok
+	case strings.EqualFold(scheme, "DPoP"):
+		return "DPoP", tok
+	default:
+		return "", ""
+	}
+}
 
-func RequireAuth(cache redis.Service) func(http.Handler) http.Handler {
+// RequireAuth accepts unbound tokens with the Bearer scheme and DPoP-bound
+// tokens with the DPoP scheme and a proof signed by the bound key. Tokens
+// are checked with the verifier of the request's tenant, so it must run
+// after tenant.Resolve.
+func RequireAuth() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"unauthorized"}`))
+			scheme, tokenString := Credentials(r)
+			t := tenant.From(r.Context())
+			if tokenString == "" || t == nil {
+				unauthorized(w)
 				return
 			}
+			verifier := t.Verifier
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			userID, err := token.Validate(r.Context(), tokenString, cache)
+			claims, err := verifier.Validate(r.Context(), tokenString)
 			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"unauthorized"}`))
+				unauthorized(w)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			switch {
+			case scheme == "Bearer" && claims.KeyThumbprint == "":
+			case scheme == "DPoP" && claims.KeyThumbprint != "":
+				proofs := r.Header.Values("DPoP")
+				if len(proofs) != 1 {
+					invalidProof(w)
+					return
+				}
+				proof, err := verifier.VerifyProof(r.Context(), proofs[0], r.Method, httpkit.RequestURL(r), tokenString)
+				if err != nil || proof.Thumbprint != claims.KeyThumbprint {
+					invalidProof(w)
+					return
+				}
+			default:
+				unauthorized(w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireUser rejects requests whose token was not issued for a user with
+// 403. A client credentials token names the client as its subject, and user
+// routes look the subject up as a user ID, which is always a UUID. It must
+// run after RequireAuth.
+func RequireUser() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+			if !IsUser(claims) {
+				forbidden(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsUser reports whether claims name a user rather than a client.
+func IsUser(claims *token.Claims) bool {
+	_, err := uuid.Parse(claims.Subject)
+	return err == nil
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"unauthorized"}`))
+}
+
+func invalidProof(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"invalid_dpop_proof"}`))
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-as-a-service/app/async/tenants"
+	"auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/sdk/token"
+
+	"github.com/google/uuid"
+)
+
+// emptyCache is a redis.Service holding nothing: no token is revoked.
+type emptyCache struct{}
+
+func (emptyCache) Get(context.Context, string) (string, error) { return "", errors.New("not found") }
+func (emptyCache) Set(context.Context, string, any, time.Duration) error {
+	return nil
+}
+func (emptyCache) SetNX(context.Context, string, any, time.Duration) (bool, error) {
+	return true, nil
+}
+func (emptyCache) GetDel(context.Context, string) (string, error) { return "", errors.New("not found") }
+func (emptyCache) Incr(context.Context, string, time.Duration) (int64, error) {
+	return 1, nil
+}
+func (emptyCache) Delete(context.Context, string) error { return nil }
+func (emptyCache) Health() map[string]string            { return nil }
+func (emptyCache) Close() error                         { return nil }
+
+func testTenant(t *testing.T) *tenants.Tenant {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	k, err := token.NewKey(priv)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	k.State = token.KeyCurrent
+	ring, err := token.NewKeyRing(k)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	cfg := token.Config{Keys: ring, Issuer: "https://auth.test", AccessTTL: time.Hour, RefreshTTL: 24 * time.Hour}
+	return &tenants.Tenant{
+		ID:       "tenant-1",
+		Slug:     "default",
+		Issuer:   token.NewIssuer(cfg, emptyCache{}),
+		Verifier: token.NewVerifier(cfg, emptyCache{}),
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	tn := testTenant(t)
+	h := RequireAuth()(RequireUser()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	userTok, err := tn.Issuer.Generate(context.Background(), token.Claims{Subject: uuid.NewString()})
+	if err != nil {
+		t.Fatalf("generate user token: %v", err)
+	}
+	// What clientCredentialsGrant issues: the client is the subject.
+	clientTok, err := tn.Issuer.Generate(context.Background(), token.Claims{
+		Subject: "k3J9x2QpL0aZ7mWc",
+		Custom:  map[string]any{"client_id": "k3J9x2QpL0aZ7mWc"},
+	})
+	if err != nil {
+		t.Fatalf("generate client token: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		tok  string
+		want int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"client token", clientTok, http.StatusForbidden},
+		{"user token", userTok, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/sessions", nil)
+			req = req.WithContext(tenant.WithTenant(req.Context(), tn))
+			if tc.tok != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.tok)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"auth-as-a-service/app/http/middleware/tenant"
+)
+
+// PermissionChecker resolves the permissions granted by a set of a
+// tenant's roles. The role store implements it.
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, tenantID string, roles []string, permission string) (bool, error)
+}
+
+// RequireRole rejects requests whose token does not carry role with 403.
+// It must run after RequireAuth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+			if !claims.HasRole(role) {
+				forbidden(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission rejects requests unless one of the token's roles grants
+// permission in the request's tenant. Permissions are looked up on every
+// request, so changes to a role's permissions apply immediately; changes to
+// a user's roles apply once their token is refreshed. It must run after
+// RequireAuth.
+func RequirePermission(perms PermissionChecker, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+			ok, err := perms.HasPermission(r.Context(), tenant.From(r.Context()).ID, claims.Roles, permission)
+			if err != nil {
+				log.Printf("check permission %s: %v", permission, err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"error":"internal error"}`))
+				return
+			}
+			if !ok {
+				forbidden(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(`{"error":"forbidden"}`))
+}
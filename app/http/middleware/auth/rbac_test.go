@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"auth-as-a-service/app/async/tenants"
+	"auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/sdk/token"
+)
+
+// rolePermissions is a PermissionChecker backed by a fixed role table per
+// tenant.
+type rolePermissions map[string]map[string][]string
+
+func (p rolePermissions) HasPermission(_ context.Context, tenantID string, roles []string, permission string) (bool, error) {
+	for _, r := range roles {
+		if slices.Contains(p[tenantID][r], permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var (
+	tenantA = &tenants.Tenant{ID: "tenant-a", Slug: "a"}
+	tenantB = &tenants.Tenant{ID: "tenant-b", Slug: "b"}
+)
+
+func serveWithClaims(h http.Handler, claims *token.Claims) int {
+	return serveInTenant(h, tenantA, claims)
+}
+
+func serveInTenant(h http.Handler, t *tenants.Tenant, claims *token.Claims) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(tenant.WithTenant(req.Context(), t))
+	if claims != nil {
+		req = req.WithContext(context.WithValue(req.Context(), ClaimsKey, claims))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRequireRole(t *testing.T) {
+	h := RequireRole("admin")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	if got := serveWithClaims(h, nil); got != http.StatusUnauthorized {
+		t.Errorf("no claims: expected 401, got %d", got)
+	}
+	if got := serveWithClaims(h, &token.Claims{Roles: []string{"support"}}); got != http.StatusForbidden {
+		t.Errorf("other role: expected 403, got %d", got)
+	}
+	if got := serveWithClaims(h, &token.Claims{Roles: []string{"support", "admin"}}); got != http.StatusOK {
+		t.Errorf("admin role: expected 200, got %d", got)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	perms := rolePermissions{
+		tenantA.ID: {
+			"admin":   {"roles:manage", "users:read"},
+			"support": {"users:read"},
+		},
+		tenantB.ID: {
+			"admin": {"users:read"},
+		},
+	}
+	h := RequirePermission(perms, "roles:manage")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	if got := serveWithClaims(h, nil); got != http.StatusUnauthorized {
+		t.Errorf("no claims: expected 401, got %d", got)
+	}
+	if got := serveWithClaims(h, &token.Claims{}); got != http.StatusForbidden {
+		t.Errorf("no roles: expected 403, got %d", got)
+	}
+	if got := serveWithClaims(h, &token.Claims{Roles: []string{"support"}}); got != http.StatusForbidden {
+		t.Errorf("role without permission: expected 403, got %d", got)
+	}
+	if got := serveWithClaims(h, &token.Claims{Roles: []string{"support", "admin"}}); got != http.StatusOK {
+		t.Errorf("role with permission: expected 200, got %d", got)
+	}
+	// Another tenant's role of the same name grants what it grants there.
+	if got := serveInTenant(h, tenantB, &token.Claims{Roles: []string{"admin"}}); got != http.StatusForbidden {
+		t.Errorf("role without permission in the tenant: expected 403, got %d", got)
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequireScope rejects requests whose token lacks any of scopes with 403
+// insufficient_scope (RFC 6750 section 3.1). It must run after RequireAuth.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+
+			for _, s := range scopes {
+				if !claims.HasScope(s) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("WWW-Authenticate",
+						`Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(`{"error":"insufficient_scope"}`))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
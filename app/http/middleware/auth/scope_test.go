@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestRequireScope(t *testing.T) {
+	h := RequireScope("orders:read", "orders:write")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	cases := []struct {
+		name   string
+		claims *token.Claims
+		want   int
+	}{
+		{"no claims", nil, http.StatusUnauthorized},
+		{"missing one scope", &token.Claims{Scopes: []string{"orders:read"}}, http.StatusForbidden},
+		{"all scopes", &token.Claims{Scopes: []string{"orders:write", "profile", "orders:read"}}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.claims != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ClaimsKey, tc.claims))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, rec.Code)
+			}
+			if tc.want == http.StatusForbidden && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header on 403")
+			}
+		})
+	}
+}
@@ -20,7 +20,8 @@ type bucket struct {
 	lastSeen time.Time
 }
 
-// RateLimiter enforces per-IP token bucket rate limits with a background sweeper.
+// RateLimiter enforces per-key token bucket rate limits with a background
+// sweeper. Its middleware keys buckets by client IP.
 type RateLimiter struct {
 	buckets       sync.Map
 	rps           float64
@@ -60,26 +61,7 @@ func (rl *RateLimiter) Stop() {
 func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := extractIP(r)
-
-			val, _ := rl.buckets.LoadOrStore(ip, &bucket{
-				tokens:   rl.burst,
-				lastSeen: time.Now(),
-			})
-			b := val.(*bucket)
-
-			b.mu.Lock()
-			now := time.Now()
-			elapsed := now.Sub(b.lastSeen).Seconds()
-			b.tokens = min(rl.burst, b.tokens+elapsed*rl.rps)
-			b.lastSeen = now
-
-			if b.tokens < 1 {
-				retryAfter := int(math.Ceil((1 - b.tokens) / rl.rps))
-				if retryAfter < 1 {
-					retryAfter = 1
-				}
-				b.mu.Unlock()
+			if ok, retryAfter := rl.Allow(extractIP(r)); !ok {
 				w.Header().Set("Content-Type", "application/json")
 				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 				w.WriteHeader(http.StatusTooManyRequests)
@@ -87,14 +69,39 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			b.tokens--
-			b.mu.Unlock()
-
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// Allow takes a token from key's bucket. When the bucket is empty it
+// returns false and the number of seconds until a token is available.
+func (rl *RateLimiter) Allow(key string) (bool, int) {
+	val, _ := rl.buckets.LoadOrStore(key, &bucket{
+		tokens:   rl.burst,
+		lastSeen: time.Now(),
+	})
+	b := val.(*bucket)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.tokens = min(rl.burst, b.tokens+elapsed*rl.rps)
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		retryAfter := int(math.Ceil((1 - b.tokens) / rl.rps))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		return false, retryAfter
+	}
+
+	b.tokens--
+	return true, 0
+}
+
 func (rl *RateLimiter) sweep() {
 	ticker := time.NewTicker(rl.sweepInterval)
 	defer ticker.Stop()
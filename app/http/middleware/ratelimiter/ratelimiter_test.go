@@ -91,3 +91,22 @@ func TestRateLimiter_SweeperRemovesStaleEntries(t *testing.T) {
 		t.Fatal("expected sweeper to remove the stale bucket entry")
 	}
 }
+
+func TestRateLimiter_AllowKeepsKeysApart(t *testing.T) {
+	t.Parallel()
+	rl := newWithConfig(0.1, 1, time.Hour, time.Hour)
+
+	if ok, _ := rl.Allow("device-a"); !ok {
+		t.Fatal("expected first call for device-a to be allowed")
+	}
+	ok, retryAfter := rl.Allow("device-a")
+	if ok {
+		t.Fatal("expected second call for device-a to be limited")
+	}
+	if retryAfter < 1 {
+		t.Fatalf("expected a positive retry-after, got %d", retryAfter)
+	}
+	if ok, _ := rl.Allow("device-b"); !ok {
+		t.Fatal("expected device-b to have its own bucket")
+	}
+}
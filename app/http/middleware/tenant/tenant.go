@@ -0,0 +1,72 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"auth-as-a-service/app/async/tenants"
+)
+
+// Header selects a tenant by slug. It takes precedence over the host.
+const Header = "X-Tenant"
+
+// Directory finds tenants by slug or host. *tenants.Directory implements it.
+type Directory interface {
+	BySlug(slug string) (*tenants.Tenant, bool)
+	ByHost(host string) (*tenants.Tenant, bool)
+}
+
+type contextKey string
+
+const tenantKey contextKey = "tenant"
+
+// From returns the tenant Resolve found for the request.
+func From(ctx context.Context) *tenants.Tenant {
+	t, _ := ctx.Value(tenantKey).(*tenants.Tenant)
+	return t
+}
+
+// WithTenant returns a copy of ctx carrying t.
+func WithTenant(ctx context.Context, t *tenants.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey, t)
+}
+
+// Resolve finds the request's tenant from the X-Tenant header, then the
+// Host header, then falls back to fallback if it is not empty. Requests for
+// an unknown tenant get 404.
+func Resolve(dir Directory, fallback string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, ok := lookup(dir, r, fallback)
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"unknown tenant"}`))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), t)))
+		})
+	}
+}
+
+func lookup(dir Directory, r *http.Request, fallback string) (*tenants.Tenant, bool) {
+	// A header naming a tenant that does not exist is an error, not a
+	// reason to fall through to another tenant.
+	if slug := r.Header.Get(Header); slug != "" {
+		return dir.BySlug(slug)
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if t, ok := dir.ByHost(host); ok {
+		return t, true
+	}
+
+	if fallback == "" {
+		return nil, false
+	}
+	return dir.BySlug(fallback)
+}
@@ -0,0 +1,74 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-as-a-service/app/async/tenants"
+)
+
+type fakeDirectory struct {
+	bySlug map[string]*tenants.Tenant
+	byHost map[string]*tenants.Tenant
+}
+
+func (d fakeDirectory) BySlug(slug string) (*tenants.Tenant, bool) {
+	t, ok := d.bySlug[slug]
+	return t, ok
+}
+
+func (d fakeDirectory) ByHost(host string) (*tenants.Tenant, bool) {
+	t, ok := d.byHost[host]
+	return t, ok
+}
+
+func TestResolve(t *testing.T) {
+	def := &tenants.Tenant{Slug: "default"}
+	acme := &tenants.Tenant{Slug: "acme"}
+	dir := fakeDirectory{
+		bySlug: map[string]*tenants.Tenant{"default": def, "acme": acme},
+		byHost: map[string]*tenants.Tenant{"auth.acme.test": acme},
+	}
+
+	cases := []struct {
+		name     string
+		host     string
+		header   string
+		fallback string
+		want     *tenants.Tenant
+	}{
+		{"header", "localhost", "acme", "default", acme},
+		{"host with port", "auth.acme.test:8080", "", "default", acme},
+		{"header wins over host", "auth.acme.test", "default", "", def},
+		{"fallback", "localhost", "", "default", def},
+		{"no fallback", "localhost", "", "", nil},
+		{"unknown header does not fall back", "auth.acme.test", "globex", "default", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *tenants.Tenant
+			h := Resolve(dir, tc.fallback)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = From(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tc.host
+			if tc.header != "" {
+				req.Header.Set(Header, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if tc.want == nil {
+				if rec.Code != http.StatusNotFound {
+					t.Fatalf("expected 404, got %d", rec.Code)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Fatalf("expected tenant %s, got %v", tc.want.Slug, got)
+			}
+		})
+	}
+}
@@ -5,8 +5,13 @@ import (
 	"os"
 	"strings"
 
+	"auth-as-a-service/app/http/handlers/admin"
 	authHandler "auth-as-a-service/app/http/handlers/auth"
 	"auth-as-a-service/app/http/handlers/health"
+	"auth-as-a-service/app/http/handlers/oauth"
+	"auth-as-a-service/app/http/handlers/wellknown"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/http/signin"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -24,7 +29,7 @@ func (s *Server) Setup() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "DPoP", "X-Tenant"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -32,8 +37,25 @@ func (s *Server) Setup() http.Handler {
 	// Setup health endpoint
 	health.New(s.db, s.redis).RegisterRoutes(r)
 
-	// Setup auth handler
-	authHandler.New(s.store.Users, s.redis).RegisterRoutes(r)
+	// Everything else belongs to a tenant
+	r.Group(func(r chi.Router) {
+		r.Use(tenantMW.Resolve(s.tenants, s.defaultTenant))
+
+		// Setup JWKS endpoint
+		wellknown.New().RegisterRoutes(r)
+
+		// The API and the OAuth pages check passwords the same way
+		signIn := signin.New(s.store.Users, s.store.Roles, s.store.Events, s.store.MFA, s.redis, s.directories)
+
+		// Setup auth handler
+		authHandler.New(s.store.Users, s.store.Sessions, s.store.Events, s.store.Roles, s.store.MFA, s.redis, s.idps, signIn).RegisterRoutes(r)
+
+		// Setup admin endpoints
+		admin.New(s.store.Users, s.store.Roles, s.store.Events).RegisterRoutes(r)
+
+		// Setup OAuth endpoints
+		oauth.New(s.store.Users, s.store.Sessions, s.store.Roles, s.store.Clients, s.store.Events, signIn, s.redis, s.devicePolls, s.providers).RegisterRoutes(r)
+	})
 
 	return r
 }
@@ -1,16 +1,25 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"time"
 
+	"auth-as-a-service/app/async/tenants"
+	"auth-as-a-service/app/http/handlers/oauth"
 	"auth-as-a-service/app/http/middleware/ratelimiter"
 	"auth-as-a-service/app/memory/database"
 	"auth-as-a-service/app/memory/redis"
 	"auth-as-a-service/app/memory/store"
+	"auth-as-a-service/app/memory/store/tenant"
+	"auth-as-a-service/sdk/ldap"
+	"auth-as-a-service/sdk/oidc"
+	"auth-as-a-service/sdk/saml"
+	"auth-as-a-service/sdk/token"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -20,6 +29,18 @@ type Server struct {
 	redis       redis.Service
 	store       *store.Registry
 	rateLimiter *ratelimiter.RateLimiter
+	// devicePolls holds one bucket per device code polling for tokens.
+	devicePolls *ratelimiter.RateLimiter
+	tenants     *tenants.Directory
+	// providers are the upstream OpenID Connect providers for federated login.
+	providers []*oidc.Provider
+	// idps are the enterprise SAML identity providers.
+	idps []*saml.IdP
+	// directories are the LDAP directories staff sign in against.
+	directories []*ldap.Directory
+	// defaultTenant serves requests that name no known tenant. Empty
+	// rejects them instead.
+	defaultTenant string
 }
 
 func NewServer() *http.Server {
@@ -37,12 +58,84 @@ func NewServer() *http.Server {
 	burst := parseFloat(os.Getenv("RATE_LIMIT_BURST"), 20)
 	rl := ratelimiter.New(rps, burst)
 	rl.Start()
+	polls := ratelimiter.New(1/oauth.DevicePollInterval.Seconds(), 1)
+	polls.Start()
+
+	registry := store.New(db.DB())
+
+	// Setup tenants, each with its own signing key ring
+	dir, err := tenants.Load(context.Background(), registry.Tenants, registry.SigningKeys, redis, token.ConfigFromEnv())
+	if err != nil {
+		panic(fmt.Sprintf("load tenants: %s", err))
+	}
+	dir.Start()
+
+	// Setup federated login providers
+	var providers []*oidc.Provider
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); path != "" {
+		configs, err := oidc.ReadConfigs(path)
+		if err != nil {
+			panic(fmt.Sprintf("read OIDC providers: %s", err))
+		}
+		for _, c := range configs {
+			providers = append(providers, oidc.NewProvider(c, nil))
+		}
+	}
+
+	// Setup SAML identity providers. They share linked identities with the
+	// OIDC providers, so names must not clash.
+	var idps []*saml.IdP
+	if path := os.Getenv("SAML_IDPS_FILE"); path != "" {
+		configs, err := saml.ReadConfigs(path)
+		if err != nil {
+			panic(fmt.Sprintf("read SAML IdPs: %s", err))
+		}
+		for _, c := range configs {
+			if slices.ContainsFunc(providers, func(p *oidc.Provider) bool { return p.Name() == c.Name }) {
+				panic(fmt.Sprintf("SAML IdP %s has the name of an OIDC provider", c.Name))
+			}
+			idp, err := saml.NewIdP(c)
+			if err != nil {
+				panic(fmt.Sprintf("read SAML IdPs: %s", err))
+			}
+			idps = append(idps, idp)
+		}
+	}
+
+	// Setup LDAP directories. Their users are linked like federated ones,
+	// so names must not clash either.
+	var directories []*ldap.Directory
+	if path := os.Getenv("LDAP_DIRECTORIES_FILE"); path != "" {
+		configs, err := ldap.ReadConfigs(path)
+		if err != nil {
+			panic(fmt.Sprintf("read LDAP directories: %s", err))
+		}
+		for _, c := range configs {
+			clash := slices.ContainsFunc(providers, func(p *oidc.Provider) bool { return p.Name() == c.Name }) ||
+				slices.ContainsFunc(idps, func(p *saml.IdP) bool { return p.Name() == c.Name })
+			if clash {
+				panic(fmt.Sprintf("LDAP directory %s has the name of a sign-in provider", c.Name))
+			}
+			directories = append(directories, ldap.New(c, nil))
+		}
+	}
+
+	defaultTenant := tenant.DefaultSlug
+	if v, ok := os.LookupEnv("DEFAULT_TENANT"); ok {
+		defaultTenant = v
+	}
 
 	handler := &Server{
-		db:          db,
-		redis:       redis,
-		store:       store.New(db.DB()),
-		rateLimiter: rl,
+		db:            db,
+		redis:         redis,
+		store:         registry,
+		rateLimiter:   rl,
+		devicePolls:   polls,
+		tenants:       dir,
+		providers:     providers,
+		idps:          idps,
+		directories:   directories,
+		defaultTenant: defaultTenant,
 	}
 
 	server := &http.Server{
@@ -53,6 +146,8 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 	server.RegisterOnShutdown(rl.Stop)
+	server.RegisterOnShutdown(polls.Stop)
+	server.RegisterOnShutdown(dir.Stop)
 
 	return server
 }
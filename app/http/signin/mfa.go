@@ -0,0 +1,246 @@
+package signin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	mfaStore "auth-as-a-service/app/memory/store/mfa"
+	"auth-as-a-service/sdk/totp"
+)
+
+const (
+	// ChallengeTTL bounds how long the user may take to enter a code after
+	// their password.
+	ChallengeTTL = 5 * time.Minute
+	// maxAttempts is how many wrong codes one challenge survives. After
+	// that the user starts again with their password.
+	maxAttempts = 5
+	// maxFailures is how many wrong codes a user may enter across all
+	// their challenges in failureWindow. Past it every code is refused
+	// until the window ends; otherwise each new challenge would bring
+	// maxAttempts more guesses.
+	maxFailures   = 10
+	failureWindow = 15 * time.Minute
+	// recoveryCodeCount is how many recovery codes an enrollment issues.
+	recoveryCodeCount = 10
+	// usedStepTTL covers every step Verify would accept a code for, so a
+	// code stays refused for as long as it would otherwise be valid.
+	usedStepTTL = (2*totp.Skew + 1) * totp.Period
+)
+
+// What a challenge is started for. A challenge completes only the kind of
+// sign-in that started it.
+const (
+	PurposeLogin     = "login"
+	PurposeAuthorize = "authorize"
+	PurposeDevice    = "device"
+)
+
+var (
+	ErrInvalidMFAToken = httpkit.ClientErr(http.StatusUnauthorized, "Invalid or expired MFA token")
+	ErrInvalidCode     = httpkit.ClientErr(http.StatusUnauthorized, "Invalid code")
+	ErrMFALocked       = httpkit.ClientErr(http.StatusTooManyRequests, "Too many invalid codes, try again later")
+)
+
+// Challenge is remembered under the hash of an MFA token between a correct
+// password and a correct code.
+type Challenge struct {
+	TenantID string `json:"tenant_id"`
+	UserID   string `json:"user_id"`
+	Purpose  string `json:"purpose"`
+	// Data is what the sign-in completes with, such as the audience and
+	// scope /auth/login was asked for.
+	Data      map[string]string `json:"data,omitempty"`
+	Attempts  int               `json:"attempts"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// challengeKey stores challenges by hash so a cache dump yields no tokens.
+func challengeKey(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return "mfa_challenge:" + hex.EncodeToString(sum[:])
+}
+
+// failuresKey counts a user's wrong codes across their challenges.
+func failuresKey(userID string) string {
+	return "mfa_failures:" + userID
+}
+
+// StartMFA starts a challenge for purpose when userID has MFA enabled and
+// returns its token, or false when they do not.
+func (s *Service) StartMFA(r *http.Request, userID, purpose string, data map[string]string) (string, bool, error) {
+	enabled, err := s.mfa.Enabled(r.Context(), userID)
+	if err != nil || !enabled {
+		return "", false, err
+	}
+
+	tok := rand.Text()
+	b, err := json.Marshal(Challenge{
+		TenantID:  tenantMW.From(r.Context()).ID,
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      data,
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if err := s.cache.Set(r.Context(), challengeKey(tok), string(b), ChallengeTTL); err != nil {
+		return "", false, err
+	}
+	return tok, true, nil
+}
+
+// VerifyMFA checks code, or recoveryCode when given, against the challenge
+// tok stands for and returns the challenge when it is correct. A wrong code
+// returns ErrInvalidCode and leaves the challenge for another try while it
+// has attempts left.
+func (s *Service) VerifyMFA(r *http.Request, tok, purpose, code, recoveryCode string) (Challenge, error) {
+	// Taking the challenge lets only one attempt at a time use it.
+	var c Challenge
+	data, err := s.cache.GetDel(r.Context(), challengeKey(tok))
+	if err != nil || json.Unmarshal([]byte(data), &c) != nil || c.TenantID != tenantMW.From(r.Context()).ID || c.Purpose != purpose {
+		return Challenge{}, ErrInvalidMFAToken
+	}
+
+	// A locked user's codes are refused right or wrong, so guessing
+	// gains nothing until the window ends.
+	if s.locked(r.Context(), c.UserID) {
+		return Challenge{}, ErrMFALocked
+	}
+
+	var ok bool
+	if recoveryCode != "" {
+		ok, err = s.useRecoveryCode(r, c.UserID, recoveryCode)
+	} else {
+		ok, err = s.checkTOTP(r.Context(), c.UserID, code)
+	}
+	if err != nil {
+		return Challenge{}, err
+	}
+	if ok {
+		if err := s.cache.Delete(r.Context(), failuresKey(c.UserID)); err != nil {
+			log.Printf("mfa: reset failures: %v", err)
+		}
+		return c, nil
+	}
+
+	failures, err := s.cache.Incr(r.Context(), failuresKey(c.UserID), failureWindow)
+	if err != nil {
+		return Challenge{}, err
+	}
+	if failures >= maxFailures {
+		if failures == maxFailures {
+			s.record(r, eventStore.KindMFALocked, c.UserID, nil)
+		}
+		return Challenge{}, ErrMFALocked
+	}
+
+	c.Attempts++
+	if ttl := time.Until(c.ExpiresAt); c.Attempts < maxAttempts && ttl > 0 {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return Challenge{}, err
+		}
+		if err := s.cache.Set(r.Context(), challengeKey(tok), string(data), ttl); err != nil {
+			return Challenge{}, err
+		}
+	}
+	return Challenge{}, ErrInvalidCode
+}
+
+// locked reports whether userID has used up their wrong codes for the
+// current window.
+func (s *Service) locked(ctx context.Context, userID string) bool {
+	v, err := s.cache.Get(ctx, failuresKey(userID))
+	if err != nil {
+		return false
+	}
+	n, _ := strconv.Atoi(v)
+	return n >= maxFailures
+}
+
+// checkTOTP reports whether code is the user's current code and its time
+// step has not been used before.
+func (s *Service) checkTOTP(ctx context.Context, userID, code string) (bool, error) {
+	t, err := s.mfa.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil || !t.Enabled() {
+		return false, err
+	}
+	return s.AcceptTOTP(ctx, t, code)
+}
+
+// AcceptTOTP reports whether code is t's code for the current time step,
+// marking the step used. A used step is remembered in the cache, so a code
+// overheard or replayed while still valid is refused.
+func (s *Service) AcceptTOTP(ctx context.Context, t mfaStore.TOTP, code string) (bool, error) {
+	step, ok := totp.Verify(t.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.cache.SetNX(ctx, fmt.Sprintf("totp_used:%s:%d", t.UserID, step), 1, usedStepTTL)
+}
+
+// useRecoveryCode spends code if it is one of the user's unused recovery
+// codes.
+func (s *Service) useRecoveryCode(r *http.Request, userID, code string) (bool, error) {
+	err := s.mfa.UseRecoveryCode(r.Context(), userID, hashRecoveryCode(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	left, err := s.mfa.RecoveryCodesLeft(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	s.record(r, eventStore.KindMFARecoveryCodeUsed, userID, map[string]string{"remaining": fmt.Sprint(left)})
+	return true, nil
+}
+
+// NewRecoveryCodes returns a fresh set of recovery codes to show the user
+// and the hashes to store.
+func NewRecoveryCodes() (codes, hashes []string) {
+	codes = make([]string, recoveryCodeCount)
+	hashes = make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = newRecoveryCode()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes
+}
+
+// newRecoveryCode returns a code of 80 random bits, as sixteen base32
+// characters in groups of four.
+func newRecoveryCode() string {
+	s := strings.ToLower(rand.Text()[:16])
+	return s[:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:]
+}
+
+// hashRecoveryCode hashes code after dropping the case, spaces and dashes
+// a user may type it with. The codes are random enough that a fast hash
+// leaves nothing to brute-force.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
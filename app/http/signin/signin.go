@@ -0,0 +1,212 @@
+// Package signin checks the credentials users sign in with, passwords and
+// second factors, for the auth API and the OAuth sign-in pages alike, so
+// both hold every user to the same checks.
+package signin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"auth-as-a-service/app/http/httpkit"
+	tenantMW "auth-as-a-service/app/http/middleware/tenant"
+	"auth-as-a-service/app/memory/redis"
+	eventStore "auth-as-a-service/app/memory/store/event"
+	mfaStore "auth-as-a-service/app/memory/store/mfa"
+	roleStore "auth-as-a-service/app/memory/store/role"
+	userStore "auth-as-a-service/app/memory/store/user"
+	"auth-as-a-service/sdk/crypto"
+	"auth-as-a-service/sdk/ldap"
+)
+
+var (
+	// ErrInvalidCredentials answers an unknown user and a wrong password
+	// alike.
+	ErrInvalidCredentials = httpkit.ClientErr(http.StatusUnauthorized, "Invalid credentials")
+	// ErrAccountExists refuses a directory user whose address belongs to
+	// an account with a local password. Linking it would hand the
+	// directory's roles to whoever registered the address.
+	ErrAccountExists = httpkit.ClientErr(http.StatusConflict, "An account with this email address already exists")
+)
+
+type Service struct {
+	users  *userStore.Store
+	roles  *roleStore.Store
+	events *eventStore.Store
+	mfa    *mfaStore.Store
+	// cache holds MFA challenges, used TOTP steps and wrong-code counts.
+	cache redis.Service
+	// directories check the passwords of the users they serve in place of
+	// the users table.
+	directories []*ldap.Directory
+}
+
+func New(users *userStore.Store, roles *roleStore.Store, events *eventStore.Store, mfa *mfaStore.Store, cache redis.Service, directories []*ldap.Directory) *Service {
+	return &Service{
+		users:       users,
+		roles:       roles,
+		events:      events,
+		mfa:         mfa,
+		cache:       cache,
+		directories: directories,
+	}
+}
+
+// Authenticate checks email and password for the request's tenant and
+// returns the user they belong to, or an httpkit.Error the user may see,
+// usually ErrInvalidCredentials.
+func (s *Service) Authenticate(r *http.Request, email, password string) (userStore.User, error) {
+	return s.backendFor(r, email).authenticate(r, email, password)
+}
+
+// Directory returns the directory serving email in the request's tenant.
+// A user it serves never has a local password.
+func (s *Service) Directory(r *http.Request, email string) (*ldap.Directory, bool) {
+	slug := tenantMW.From(r.Context()).Slug
+	for _, d := range s.directories {
+		if d.Serves(slug, email) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// credentialBackend checks an email and password for the request's tenant
+// and returns the user they belong to, or ErrInvalidCredentials.
+type credentialBackend interface {
+	authenticate(r *http.Request, email, password string) (userStore.User, error)
+}
+
+// backendFor picks the backend that checks email's password: the first
+// directory serving it in the request's tenant, else the users table.
+func (s *Service) backendFor(r *http.Request, email string) credentialBackend {
+	if d, ok := s.Directory(r, email); ok {
+		return directoryBackend{s: s, dir: d}
+	}
+	return passwordBackend{users: s.users}
+}
+
+// passwordBackend checks the Argon2 hash in the users table.
+type passwordBackend struct {
+	users *userStore.Store
+}
+
+func (b passwordBackend) authenticate(r *http.Request, email, password string) (userStore.User, error) {
+	user, err := b.users.GetByEmail(r.Context(), tenantMW.From(r.Context()).ID, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, ErrInvalidCredentials
+		}
+		return user, err
+	}
+
+	// Users created through federated login have no password to match.
+	if !user.HasPassword() {
+		return user, ErrInvalidCredentials
+	}
+
+	doesMatch, err := crypto.VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return user, err
+	}
+	if !doesMatch {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// directoryBackend binds to an LDAP directory as the user. Directory users
+// get a passwordless row in the users table on first sign-in, linked to
+// their DN, so sessions and tokens have a subject; the directory stays the
+// source of truth for their password and the roles it maps.
+type directoryBackend struct {
+	s   *Service
+	dir *ldap.Directory
+}
+
+func (b directoryBackend) authenticate(r *http.Request, email, password string) (userStore.User, error) {
+	du, err := b.dir.Authenticate(r.Context(), email, password)
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		return userStore.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		log.Printf("ldap %s: %v", b.dir.Name(), err)
+		return userStore.User{}, err
+	}
+	if du.Email == "" {
+		du.Email = email
+	}
+
+	// The directory vouches for its users' addresses, but not for an
+	// account someone else registered with one.
+	user, linked, err := b.s.users.ResolveFederated(r.Context(), tenantMW.From(r.Context()).ID, userStore.Identity{
+		Provider:      b.dir.Name(),
+		Subject:       du.DN,
+		Email:         du.Email,
+		EmailVerified: true,
+		Exclusive:     true,
+	})
+	if errors.Is(err, userStore.ErrHasPassword) {
+		log.Printf("ldap %s: %s matches an account with a local password; not linking", b.dir.Name(), du.DN)
+		return user, ErrAccountExists
+	}
+	if err != nil {
+		return user, err
+	}
+	if linked {
+		b.s.record(r, eventStore.KindIdentityLinked, user.ID, map[string]string{"provider": b.dir.Name(), "provider_subject": du.DN})
+	}
+
+	return user, b.syncRoles(r, user.ID, du.Groups)
+}
+
+// syncRoles makes the user's roles among those the directory maps match
+// their groups, recording each change as the admin endpoints do.
+func (b directoryBackend) syncRoles(r *http.Request, userID string, groups []string) error {
+	tenantID := tenantMW.From(r.Context()).ID
+	current, err := b.s.roles.NamesForUser(r.Context(), tenantID, userID)
+	if err != nil {
+		return err
+	}
+	want := b.dir.Roles(groups)
+	by := "directory:" + b.dir.Name()
+
+	for _, role := range b.dir.ManagedRoles() {
+		has, should := slices.Contains(current, role), slices.Contains(want, role)
+		switch {
+		case should && !has:
+			err := b.s.roles.Assign(r.Context(), tenantID, userID, role)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Printf("ldap %s: group mapping names unknown role %s", b.dir.Name(), role)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			b.s.record(r, eventStore.KindRoleAssigned, userID, map[string]string{"role": role, "by": by})
+		case has && !should:
+			if err := b.s.roles.Remove(r.Context(), tenantID, userID, role); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			b.s.record(r, eventStore.KindRoleRemoved, userID, map[string]string{"role": role, "by": by})
+		}
+	}
+	return nil
+}
+
+// record logs a security event. A failure to record does not fail the
+// sign-in.
+func (s *Service) record(r *http.Request, kind, userID string, detail map[string]string) {
+	err := s.events.Record(r.Context(), eventStore.Event{
+		Kind:      kind,
+		Subject:   userID,
+		IP:        httpkit.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	})
+	if err != nil {
+		log.Printf("record security event %s: %v", kind, err)
+	}
+}
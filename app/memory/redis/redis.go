@@ -16,6 +16,15 @@ import (
 type Service interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value any, ttl time.Duration) error
+	// SetNX sets key only if it does not exist and reports whether it did.
+	SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error)
+	// GetDel returns the value of key and deletes it in one step, so at most
+	// one caller ever sees the value.
+	GetDel(ctx context.Context, key string) (string, error)
+	// Incr adds one to the counter at key and returns its new value. The
+	// counter expires ttl after its first increment, however often it is
+	// incremented since.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
 	Delete(ctx context.Context, key string) error
 	Health() map[string]string
 	Close() error
@@ -69,6 +78,27 @@ func (s *service) Set(ctx context.Context, key string, value any, ttl time.Durat
 	return s.client.Set(ctx, key, value, ttl).Err()
 }
 
+func (s *service) SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *service) GetDel(ctx context.Context, key string) (string, error) {
+	return s.client.GetDel(ctx, key).Result()
+}
+
+func (s *service) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.ExpireNX(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
 func (s *service) Delete(ctx context.Context, key string) error {
 	return s.client.Del(ctx, key).Err()
 }
@@ -104,6 +104,64 @@ func TestGetMissing(t *testing.T) {
 	}
 }
 
+func TestSetNX(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	set, err := srv.SetNX(ctx, "once-key", "first", time.Minute)
+	if err != nil || !set {
+		t.Fatalf("SetNX on a new key: set=%v err=%v", set, err)
+	}
+
+	set, err = srv.SetNX(ctx, "once-key", "second", time.Minute)
+	if err != nil || set {
+		t.Fatalf("SetNX on an existing key: set=%v err=%v", set, err)
+	}
+
+	val, err := srv.Get(ctx, "once-key")
+	if err != nil || val != "first" {
+		t.Fatalf("expected first, got %s (%v)", val, err)
+	}
+}
+
+func TestGetDel(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.Set(ctx, "single-use", "value", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	val, err := srv.GetDel(ctx, "single-use")
+	if err != nil || val != "value" {
+		t.Fatalf("expected value, got %s (%v)", val, err)
+	}
+
+	if _, err := srv.GetDel(ctx, "single-use"); err == nil {
+		t.Fatal("expected error on second GetDel, got nil")
+	}
+}
+
+func TestIncr(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := srv.Incr(ctx, "counter", 200*time.Millisecond)
+		if err != nil || n != want {
+			t.Fatalf("expected %d, got %d (%v)", want, n, err)
+		}
+	}
+
+	// The window runs from the first increment, not the last.
+	time.Sleep(300 * time.Millisecond)
+
+	n, err := srv.Incr(ctx, "counter", time.Minute)
+	if err != nil || n != 1 {
+		t.Fatalf("expected the counter to have expired, got %d (%v)", n, err)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	srv := New()
 	ctx := context.Background()
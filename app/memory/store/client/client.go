@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = `id, tenant_id, name, secret_hash, previous_secret_hash, previous_secret_expires_at,
+	redirect_uris, scope, grant_types, created_at`
+
+// Store is scoped by tenant, like the user store.
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Create(ctx context.Context, c Client) (Client, error) {
+	var created Client
+	err := s.db.GetContext(ctx, &created, `
+		INSERT INTO oauth_clients (id, tenant_id, name, secret_hash, redirect_uris, scope, grant_types)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+columns,
+		c.ID, c.TenantID, c.Name, c.SecretHash, c.RedirectURIs, c.Scopes, c.GrantTypes)
+	return created, err
+}
+
+func (s *Store) Get(ctx context.Context, tenantID, id string) (Client, error) {
+	var c Client
+	err := s.db.GetContext(ctx, &c,
+		"SELECT "+columns+" FROM oauth_clients WHERE tenant_id = $1 AND id = $2", tenantID, id)
+	return c, err
+}
+
+func (s *Store) List(ctx context.Context, tenantID string) ([]Client, error) {
+	clients := []Client{}
+	err := s.db.SelectContext(ctx, &clients,
+		"SELECT "+columns+" FROM oauth_clients WHERE tenant_id = $1 ORDER BY created_at", tenantID)
+	return clients, err
+}
+
+// RotateSecret replaces a confidential client's secret. The old secret stays
+// valid until previousExpiresAt; any secret it had replaced stops working now.
+func (s *Store) RotateSecret(ctx context.Context, tenantID, id, secretHash string, previousExpiresAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE oauth_clients
+		SET previous_secret_hash = secret_hash, previous_secret_expires_at = $4, secret_hash = $3
+		WHERE tenant_id = $1 AND id = $2 AND secret_hash IS NOT NULL`, tenantID, id, secretHash, previousExpiresAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
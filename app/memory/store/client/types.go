@@ -0,0 +1,73 @@
+package client
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	ID       string `db:"id" json:"id"`
+	TenantID string `db:"tenant_id" json:"tenant_id"`
+	Name     string `db:"name" json:"name"`
+	// SecretHash is nil for public clients.
+	SecretHash *string `db:"secret_hash" json:"-"`
+	// PreviousSecretHash is the secret replaced by the last rotation. It is
+	// accepted until PreviousSecretExpiresAt.
+	PreviousSecretHash      *string    `db:"previous_secret_hash" json:"-"`
+	PreviousSecretExpiresAt *time.Time `db:"previous_secret_expires_at" json:"-"`
+	RedirectURIs            List       `db:"redirect_uris" json:"redirect_uris"`
+	Scopes                  List       `db:"scope" json:"scopes"`
+	GrantTypes              List       `db:"grant_types" json:"grant_types"`
+	CreatedAt               time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Grant types a client may be registered for.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// GrantRefreshToken needs no registration: a client may redeem any
+	// refresh token it was issued.
+	GrantRefreshToken = "refresh_token"
+)
+
+// Public reports whether the client has no secret.
+func (c Client) Public() bool {
+	return c.SecretHash == nil
+}
+
+// AllowsGrant reports whether the client is registered for grantType.
+func (c Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect
+// URI. No prefix or wildcard matching is done.
+func (c Client) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// List is a space-separated list of values stored in a TEXT column.
+type List []string
+
+func (l *List) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*l = strings.Fields(v)
+	case []byte:
+		*l = strings.Fields(string(v))
+	case nil:
+		*l = nil
+	default:
+		return fmt.Errorf("cannot scan %T into client.List", src)
+	}
+	return nil
+}
+
+func (l List) Value() (driver.Value, error) {
+	return strings.Join(l, " "), nil
+}
@@ -0,0 +1,32 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Record(ctx context.Context, e Event) error {
+	detail, err := json.Marshal(e.Detail)
+	if err != nil {
+		return fmt.Errorf("marshal detail: %w", err)
+	}
+	if e.Detail == nil {
+		detail = []byte("{}")
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO security_events (kind, subject, ip, user_agent, detail) VALUES ($1, $2, $3, $4, $5)",
+		e.Kind, e.Subject, e.IP, e.UserAgent, detail)
+	return err
+}
@@ -0,0 +1,31 @@
+package event
+
+// Kinds of security event.
+const (
+	KindRefreshReuse = "refresh_token_reuse"
+	KindLogoutAll    = "logout_all"
+	KindRoleAssigned = "role_assigned"
+	KindRoleRemoved  = "role_removed"
+	// KindTokenExchange records a token issued for one party to act as
+	// another; KindTokenExchangeDenied records an exchange refused.
+	KindTokenExchange       = "token_exchange"
+	KindTokenExchangeDenied = "token_exchange_denied"
+	// KindIdentityLinked records an existing account linked to a
+	// federated identity on first sign-in through the provider.
+	KindIdentityLinked = "identity_linked"
+	// KindMFAEnabled records a confirmed TOTP enrollment;
+	// KindMFARecoveryCodeUsed records a login completed with a recovery
+	// code in place of the authenticator; KindMFALocked records a user
+	// whose codes are refused after too many wrong ones.
+	KindMFAEnabled          = "mfa_enabled"
+	KindMFARecoveryCodeUsed = "mfa_recovery_code_used"
+	KindMFALocked           = "mfa_locked"
+)
+
+type Event struct {
+	Kind      string
+	Subject   string
+	IP        string
+	UserAgent string
+	Detail    map[string]string
+}
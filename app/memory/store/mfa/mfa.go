@@ -0,0 +1,121 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrEnabled is returned for enrolling a user whose authenticator is
+// already confirmed.
+var ErrEnabled = errors.New("multi-factor authentication is already enabled")
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+// Get returns the user's authenticator, confirmed or not.
+func (s *Store) Get(ctx context.Context, userID string) (TOTP, error) {
+	var t TOTP
+	err := s.db.GetContext(ctx, &t,
+		"SELECT user_id, secret, confirmed_at, created_at FROM mfa_totp WHERE user_id = $1", userID)
+	return t, err
+}
+
+// Enabled reports whether the user has a confirmed authenticator.
+func (s *Store) Enabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	err := s.db.GetContext(ctx, &enabled,
+		"SELECT EXISTS (SELECT 1 FROM mfa_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)", userID)
+	return enabled, err
+}
+
+// Enroll stores a pending authenticator with secret, replacing any pending
+// one. It returns ErrEnabled if the user already has a confirmed one.
+func (s *Store) Enroll(ctx context.Context, userID, secret string) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO mfa_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+		WHERE mfa_totp.confirmed_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEnabled
+	}
+	return nil
+}
+
+// Confirm enables the user's pending authenticator and replaces their
+// recovery codes with codeHashes, in one transaction. It returns
+// sql.ErrNoRows if there is no pending authenticator.
+func (s *Store) Confirm(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE mfa_totp SET confirmed_at = NOW() WHERE user_id = $1 AND confirmed_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, h)
+		if err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode spends the user's unused recovery code with codeHash. It
+// succeeds at most once per code and returns sql.ErrNoRows otherwise.
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecoveryCodesLeft counts the user's unused recovery codes.
+func (s *Store) RecoveryCodesLeft(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.GetContext(ctx, &n,
+		"SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID)
+	return n, err
+}
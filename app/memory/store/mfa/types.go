@@ -0,0 +1,17 @@
+package mfa
+
+import "time"
+
+// TOTP is a user's authenticator. ConfirmedAt is nil until the user proves
+// they have it with a first code.
+type TOTP struct {
+	UserID      string     `db:"user_id" json:"user_id"`
+	Secret      string     `db:"secret" json:"-"`
+	ConfirmedAt *time.Time `db:"confirmed_at" json:"confirmed_at"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Enabled reports whether the authenticator is asked for at login.
+func (t TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
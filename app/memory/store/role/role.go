@@ -0,0 +1,124 @@
+package role
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetByName(ctx context.Context, tenantID, name string) (Role, error) {
+	var r Role
+	err := s.db.GetContext(ctx, &r,
+		"SELECT id, tenant_id, name, description FROM roles WHERE tenant_id = $1 AND name = $2", tenantID, name)
+	return r, err
+}
+
+// NamesForUser returns the names of the user's roles in the tenant, sorted.
+func (s *Store) NamesForUser(ctx context.Context, tenantID, userID string) ([]string, error) {
+	names := []string{}
+	err := s.db.SelectContext(ctx, &names, `
+		SELECT r.name
+		FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE r.tenant_id = $1 AND ur.user_id = $2
+		ORDER BY r.name`, tenantID, userID)
+	return names, err
+}
+
+// Assign grants the tenant's named role to the user. It returns
+// sql.ErrNoRows if the role does not exist; assigning a role the user
+// already has is a no-op.
+func (s *Store) Assign(ctx context.Context, tenantID, userID, name string) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $2, id FROM roles WHERE tenant_id = $1 AND name = $3
+		ON CONFLICT DO NOTHING`, tenantID, userID, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// Nothing was inserted: either the user already has the role or it does not exist.
+	_, err = s.GetByName(ctx, tenantID, name)
+	return err
+}
+
+// Remove takes the tenant's named role away from the user. It returns
+// sql.ErrNoRows if the user did not have it.
+func (s *Store) Remove(ctx context.Context, tenantID, userID, name string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM user_roles
+		WHERE user_id = $2 AND role_id = (SELECT id FROM roles WHERE tenant_id = $1 AND name = $3)`,
+		tenantID, userID, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// HasPermission reports whether any of the tenant's named roles grants
+// permission. Roles of the same name in other tenants do not count.
+func (s *Store) HasPermission(ctx context.Context, tenantID string, roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+	query, args, err := sqlx.In(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM roles r
+			JOIN role_permissions rp ON rp.tenant_id = r.tenant_id AND rp.role_id = r.id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE r.tenant_id = ? AND r.name IN (?) AND p.name = ?
+		)`, tenantID, roles, permission)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	err = s.db.GetContext(ctx, &ok, s.db.Rebind(query), args...)
+	return ok, err
+}
+
+// Copy gives tenant to the roles of tenant from and the permissions they
+// grant, in one transaction. New tenants start with the default tenant's.
+func (s *Store) Copy(ctx context.Context, from, to string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO roles (tenant_id, name, description)
+		SELECT $2, name, description FROM roles WHERE tenant_id = $1`, from, to)
+	if err != nil {
+		return fmt.Errorf("copy roles: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO role_permissions (tenant_id, role_id, permission_id)
+		SELECT copy.tenant_id, copy.id, rp.permission_id
+		FROM role_permissions rp
+		JOIN roles orig ON orig.id = rp.role_id
+		JOIN roles copy ON copy.tenant_id = $2 AND copy.name = orig.name
+		WHERE rp.tenant_id = $1`, from, to)
+	if err != nil {
+		return fmt.Errorf("copy role permissions: %w", err)
+	}
+	return tx.Commit()
+}
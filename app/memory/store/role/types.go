@@ -0,0 +1,8 @@
+package role
+
+type Role struct {
+	ID          string `db:"id" json:"id"`
+	TenantID    string `db:"tenant_id" json:"tenant_id"`
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Create(ctx context.Context, id, userID, userAgent, ip string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (id, user_id, user_agent, ip) VALUES ($1, $2, $3, $4)",
+		id, userID, userAgent, ip)
+	return err
+}
+
+// Touch records a refresh against the session.
+func (s *Store) Touch(ctx context.Context, id, ip string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET last_used_at = NOW(), ip = $2 WHERE id = $1", id, ip)
+	return err
+}
+
+// Get returns an unrevoked session.
+func (s *Store) Get(ctx context.Context, id string) (Session, error) {
+	var sess Session
+	err := s.db.GetContext(ctx, &sess, `
+		SELECT id, user_id, user_agent, ip, created_at, last_used_at
+		FROM sessions WHERE id = $1 AND revoked_at IS NULL`, id)
+	return sess, err
+}
+
+// ListActive returns the user's unrevoked sessions used since the given time.
+func (s *Store) ListActive(ctx context.Context, userID string, usedSince time.Time) ([]Session, error) {
+	sessions := []Session{}
+	err := s.db.SelectContext(ctx, &sessions, `
+		SELECT id, user_id, user_agent, ip, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_used_at > $2
+		ORDER BY last_used_at DESC`, userID, usedSince)
+	return sessions, err
+}
+
+func (s *Store) Revoke(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	return err
+}
+
+func (s *Store) RevokeAllForUser(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
@@ -0,0 +1,61 @@
+package signingkey
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+// List returns the tenant's keys, oldest first.
+func (s *Store) List(ctx context.Context, tenantID string) ([]SigningKey, error) {
+	var keys []SigningKey
+	err := s.db.SelectContext(ctx, &keys, `
+		SELECT kid, tenant_id, algorithm, private_key, state, created_at, retires_at
+		FROM signing_keys WHERE tenant_id = $1 ORDER BY created_at`, tenantID)
+	return keys, err
+}
+
+// Save upserts the tenant's keys in one transaction. Demotions are written
+// before the new current key so the one-current index is never violated
+// mid-rotation.
+func (s *Store) Save(ctx context.Context, tenantID string, keys []SigningKey) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ordered := make([]SigningKey, 0, len(keys))
+	var current []SigningKey
+	for _, k := range keys {
+		if k.State == "current" {
+			current = append(current, k)
+			continue
+		}
+		ordered = append(ordered, k)
+	}
+	ordered = append(ordered, current...)
+
+	for _, k := range ordered {
+		k.TenantID = tenantID
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO signing_keys (kid, tenant_id, algorithm, private_key, state, created_at, retires_at)
+			VALUES (:kid, :tenant_id, :algorithm, :private_key, :state, :created_at, :retires_at)
+			ON CONFLICT (kid) DO UPDATE SET state = EXCLUDED.state, retires_at = EXCLUDED.retires_at
+			WHERE signing_keys.tenant_id = EXCLUDED.tenant_id`, k)
+		if err != nil {
+			return fmt.Errorf("save key %s: %w", k.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,13 @@
+package signingkey
+
+import "time"
+
+type SigningKey struct {
+	ID         string     `db:"kid"`
+	TenantID   string     `db:"tenant_id"`
+	Algorithm  string     `db:"algorithm"`
+	PrivateKey string     `db:"private_key"`
+	State      string     `db:"state"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RetiresAt  *time.Time `db:"retires_at"`
+}
@@ -1,18 +1,41 @@
 package store
 
 import (
+	"auth-as-a-service/app/memory/store/client"
+	"auth-as-a-service/app/memory/store/event"
+	"auth-as-a-service/app/memory/store/mfa"
+	"auth-as-a-service/app/memory/store/role"
+	"auth-as-a-service/app/memory/store/session"
+	"auth-as-a-service/app/memory/store/signingkey"
+	"auth-as-a-service/app/memory/store/tenant"
 	"auth-as-a-service/app/memory/store/user"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// Registry holds every domain store. Add new stores here — server.go never changes.
+// Registry holds every domain store, built once over the database for the
+// server and cmd/admin. A new store is added here and in New, and handed to
+// the handlers that need it in routes.go.
 type Registry struct {
-	Users *user.Store
+	Users       *user.Store
+	SigningKeys *signingkey.Store
+	Events      *event.Store
+	Sessions    *session.Store
+	Roles       *role.Store
+	Tenants     *tenant.Store
+	Clients     *client.Store
+	MFA         *mfa.Store
 }
 
 func New(db *sqlx.DB) *Registry {
 	return &Registry{
-		Users: user.NewStore(db),
+		Users:       user.NewStore(db),
+		SigningKeys: signingkey.NewStore(db),
+		Events:      event.NewStore(db),
+		Sessions:    session.NewStore(db),
+		Roles:       role.NewStore(db),
+		Tenants:     tenant.NewStore(db),
+		Clients:     client.NewStore(db),
+		MFA:         mfa.NewStore(db),
 	}
 }
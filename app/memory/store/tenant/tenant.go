@@ -0,0 +1,41 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+const columns = `id, slug, name, host, issuer, access_ttl_seconds, refresh_ttl_seconds,
+	password_min_length, password_check_breached, created_at`
+
+func (s *Store) List(ctx context.Context) ([]Tenant, error) {
+	tenants := []Tenant{}
+	err := s.db.SelectContext(ctx, &tenants, "SELECT "+columns+" FROM tenants ORDER BY created_at")
+	return tenants, err
+}
+
+func (s *Store) GetBySlug(ctx context.Context, slug string) (Tenant, error) {
+	var t Tenant
+	err := s.db.GetContext(ctx, &t, "SELECT "+columns+" FROM tenants WHERE slug = $1", slug)
+	return t, err
+}
+
+// Create adds a tenant with the default lifetimes and password policy. host
+// may be empty for tenants resolved only by header, and issuer empty to
+// use the default.
+func (s *Store) Create(ctx context.Context, slug, name, host, issuer string) (Tenant, error) {
+	var t Tenant
+	err := s.db.GetContext(ctx, &t,
+		"INSERT INTO tenants (slug, name, host, issuer) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, '')) RETURNING "+columns,
+		slug, name, host, issuer)
+	return t, err
+}
@@ -0,0 +1,20 @@
+package tenant
+
+import "time"
+
+// DefaultSlug names the tenant that existing users and keys were moved to
+// when tenancy was introduced.
+const DefaultSlug = "default"
+
+type Tenant struct {
+	ID                    string    `db:"id" json:"id"`
+	Slug                  string    `db:"slug" json:"slug"`
+	Name                  string    `db:"name" json:"name"`
+	Host                  *string   `db:"host" json:"host,omitempty"`
+	Issuer                *string   `db:"issuer" json:"issuer,omitempty"`
+	AccessTTLSeconds      *int      `db:"access_ttl_seconds" json:"access_ttl_seconds,omitempty"`
+	RefreshTTLSeconds     *int      `db:"refresh_ttl_seconds" json:"refresh_ttl_seconds,omitempty"`
+	PasswordMinLength     int       `db:"password_min_length" json:"password_min_length"`
+	PasswordCheckBreached bool      `db:"password_check_breached" json:"password_check_breached"`
+	CreatedAt             time.Time `db:"created_at" json:"created_at"`
+}
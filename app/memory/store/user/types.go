@@ -1,7 +1,31 @@
 package user
 
 type User struct {
-	ID           string `db:"id" json:"id"`
-	Email        string `db:"email" json:"email"`
+	ID            string `db:"id" json:"id"`
+	TenantID      string `db:"tenant_id" json:"tenant_id"`
+	Email         string `db:"email" json:"email"`
+	EmailVerified bool   `db:"email_verified" json:"email_verified"`
+	// PasswordHash is empty for users who only sign in through a provider.
 	PasswordHash string `db:"password_hash" json:"-"`
 }
+
+// HasPassword reports whether the user can sign in with a password. Users
+// created through federated login have none until they set one.
+func (u User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// Identity is a user as an upstream identity provider knows them.
+type Identity struct {
+	// Provider names the configured provider, Subject is its identifier
+	// for the user.
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Exclusive marks a provider that owns its users' addresses, such as a
+	// directory checking their passwords. Its identities are never linked
+	// to a user with a password, who may have registered the address
+	// first to inherit what the provider grants.
+	Exclusive bool
+}
@@ -2,10 +2,27 @@ package user
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	// ErrNoEmail is returned for a new identity the provider sent no email
+	// address for.
+	ErrNoEmail = errors.New("identity has no email address")
+	// ErrUnverifiedEmail is returned for a new identity whose email address
+	// belongs to an existing user but was not verified by the provider.
+	ErrUnverifiedEmail = errors.New("identity's email address is not verified")
+	// ErrHasPassword is returned for a new exclusive identity whose email
+	// address belongs to an existing user with a password.
+	ErrHasPassword = errors.New("identity's email address belongs to a user with a password")
+)
+
+// Store is scoped by tenant: every query takes the tenant ID, so a user in
+// one tenant can never be found through another.
 type Store struct {
 	db *sqlx.DB
 }
@@ -14,15 +31,102 @@ func NewStore(db *sqlx.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) Create(ctx context.Context, email, passwordHash string) (User, error) {
+func (s *Store) Create(ctx context.Context, tenantID, email, passwordHash string) (User, error) {
 	var u User
 	err := s.db.GetContext(ctx, &u,
-		"INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id, email", email, passwordHash)
+		"INSERT INTO users (tenant_id, email, password_hash) VALUES ($1, $2, $3) RETURNING id, tenant_id, email, email_verified",
+		tenantID, email, passwordHash)
 	return u, err
 }
 
-func (s *Store) GetByEmail(ctx context.Context, email string) (User, error) {
+func (s *Store) GetByEmail(ctx context.Context, tenantID, email string) (User, error) {
 	var u User
-	err := s.db.GetContext(ctx, &u, "SELECT id, email, password_hash FROM users WHERE email = $1", email)
+	err := s.db.GetContext(ctx, &u,
+		"SELECT id, tenant_id, email, email_verified, password_hash FROM users WHERE tenant_id = $1 AND email = $2", tenantID, email)
 	return u, err
 }
+
+func (s *Store) GetByID(ctx context.Context, tenantID, id string) (User, error) {
+	var u User
+	err := s.db.GetContext(ctx, &u,
+		"SELECT id, tenant_id, email, email_verified, password_hash FROM users WHERE tenant_id = $1 AND id = $2", tenantID, id)
+	return u, err
+}
+
+// GetByIdentity returns the user linked to subject at provider.
+func (s *Store) GetByIdentity(ctx context.Context, tenantID, provider, subject string) (User, error) {
+	var u User
+	err := s.db.GetContext(ctx, &u, `
+		SELECT u.id, u.tenant_id, u.email, u.email_verified, u.password_hash
+		FROM users u JOIN federated_identities f ON f.user_id = u.id
+		WHERE f.tenant_id = $1 AND f.provider = $2 AND f.subject = $3`, tenantID, provider, subject)
+	return u, err
+}
+
+// LinkIdentity links an existing user to subject at provider.
+func (s *Store) LinkIdentity(ctx context.Context, tenantID, userID, provider, subject string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO federated_identities (tenant_id, provider, subject, user_id) VALUES ($1, $2, $3, $4)",
+		tenantID, provider, subject, userID)
+	return err
+}
+
+// CreateFederated creates a user without a password, linked to subject at
+// provider, in one transaction.
+func (s *Store) CreateFederated(ctx context.Context, tenantID, email string, emailVerified bool, provider, subject string) (User, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var u User
+	err = tx.GetContext(ctx, &u, `
+		INSERT INTO users (tenant_id, email, email_verified, password_hash) VALUES ($1, $2, $3, '')
+		RETURNING id, tenant_id, email, email_verified`, tenantID, email, emailVerified)
+	if err != nil {
+		return User{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO federated_identities (tenant_id, provider, subject, user_id) VALUES ($1, $2, $3, $4)",
+		tenantID, provider, subject, u.ID)
+	if err != nil {
+		return User{}, fmt.Errorf("link identity: %w", err)
+	}
+	return u, tx.Commit()
+}
+
+// ResolveFederated returns the user id belongs to, just in time. A known
+// identity returns its user. Otherwise an existing user with the same
+// email is linked, and linked is true, but only if the provider verified
+// the address, since anyone can claim an unverified one, and, for an
+// exclusive identity, only if the user has no password. Failing both, a
+// new user without a password is created.
+func (s *Store) ResolveFederated(ctx context.Context, tenantID string, id Identity) (u User, linked bool, err error) {
+	u, err = s.GetByIdentity(ctx, tenantID, id.Provider, id.Subject)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return u, false, err
+	}
+	if id.Email == "" {
+		return u, false, ErrNoEmail
+	}
+
+	u, err = s.GetByEmail(ctx, tenantID, id.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		u, err = s.CreateFederated(ctx, tenantID, id.Email, id.EmailVerified, id.Provider, id.Subject)
+		return u, false, err
+	}
+	if err != nil {
+		return u, false, err
+	}
+	if !id.EmailVerified {
+		return u, false, ErrUnverifiedEmail
+	}
+	if id.Exclusive && u.HasPassword() {
+		return u, false, ErrHasPassword
+	}
+	if err := s.LinkIdentity(ctx, tenantID, u.ID, id.Provider, id.Subject); err != nil {
+		return u, false, err
+	}
+	return u, true, nil
+}
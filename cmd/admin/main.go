@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+
+	"auth-as-a-service/app/async/keyring"
+	"auth-as-a-service/app/async/tenants"
+	"auth-as-a-service/app/memory/database"
+	"auth-as-a-service/app/memory/redis"
+	"auth-as-a-service/app/memory/store"
+	"auth-as-a-service/app/memory/store/client"
+	"auth-as-a-service/app/memory/store/event"
+	"auth-as-a-service/app/memory/store/tenant"
+	"auth-as-a-service/sdk/crypto"
+	"auth-as-a-service/sdk/token"
+)
+
+const usage = `usage: go run ./cmd/admin <command>
+
+Commands act on the tenant whose slug is in TENANT (default: default).
+
+commands:
+  tenants list           list tenants
+  tenants create <slug> [host]
+                         add a tenant, optionally served on its own host
+  keys list              list signing keys and their states
+  keys rotate [alg]      make a new key current (RS256, ES256 or EdDSA; default EdDSA)
+  keys retire <kid>      stop a previous key from verifying immediately
+  users logout-all <id>  invalidate every token issued to a user
+  sessions list <user>   list a user's active sessions
+  sessions revoke <id>   sign a single session out
+  roles list <user>      list a user's roles
+  roles assign <user> <role>
+                         grant a role, e.g. admin to the first operator
+  roles remove <user> <role>
+                         take a role away
+  clients list           list OAuth clients
+  clients create <name> <redirect-uri>[,<redirect-uri>...] [scope]
+                         register a confidential client and print its secret
+  clients create-public <name> <redirect-uri>[,<redirect-uri>...] [scope]
+                         register a public client, e.g. a mobile app
+  clients create-service <name> [scope]
+                         register a backend client for the client_credentials grant
+  clients create-device <name> [scope]
+                         register a public client for the device grant, e.g. a CLI
+  clients create-exchange <name> [scope]
+                         register a backend client that may exchange tokens to
+                         delegate or, for its support staff, impersonate
+  clients rotate-secret <id> [overlap]
+                         replace a client's secret; the old one works for overlap (default 24h)`
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+
+	db := database.New()
+	defer db.Close()
+	registry := store.New(db.DB())
+	ctx := context.Background()
+
+	var err error
+	switch os.Args[1] + " " + os.Args[2] {
+	case "tenants list":
+		err = listTenants(ctx, registry)
+	case "tenants create":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		host := ""
+		if len(os.Args) > 4 {
+			host = os.Args[4]
+		}
+		err = createTenant(ctx, registry, os.Args[3], host)
+	case "keys list":
+		err = listKeys(ctx, registry)
+	case "keys rotate":
+		alg := token.AlgEdDSA
+		if len(os.Args) > 3 {
+			alg = os.Args[3]
+		}
+		err = rotateKeys(ctx, registry, alg)
+	case "keys retire":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		err = retireKey(ctx, registry, os.Args[3])
+	case "users logout-all":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		err = logoutAll(ctx, registry, os.Args[3])
+	case "sessions list":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		err = listSessions(ctx, registry, os.Args[3])
+	case "sessions revoke":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		err = revokeSession(ctx, registry, os.Args[3])
+	case "roles list":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		err = listRoles(ctx, registry, os.Args[3])
+	case "roles assign":
+		if len(os.Args) < 5 {
+			log.Fatal(usage)
+		}
+		err = assignRole(ctx, registry, os.Args[3], os.Args[4])
+	case "roles remove":
+		if len(os.Args) < 5 {
+			log.Fatal(usage)
+		}
+		err = removeRole(ctx, registry, os.Args[3], os.Args[4])
+	case "clients list":
+		err = listClients(ctx, registry)
+	case "clients create", "clients create-public":
+		if len(os.Args) < 5 {
+			log.Fatal(usage)
+		}
+		c := client.Client{
+			Name:         os.Args[3],
+			RedirectURIs: strings.Split(os.Args[4], ","),
+			GrantTypes:   client.List{client.GrantAuthorizationCode},
+		}
+		if len(os.Args) > 5 {
+			c.Scopes = strings.Fields(os.Args[5])
+		}
+		err = createClient(ctx, registry, c, os.Args[2] == "create-public")
+	case "clients create-service":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		c := client.Client{
+			Name:       os.Args[3],
+			GrantTypes: client.List{client.GrantClientCredentials},
+		}
+		if len(os.Args) > 4 {
+			c.Scopes = strings.Fields(os.Args[4])
+		}
+		err = createClient(ctx, registry, c, false)
+	case "clients create-device":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		c := client.Client{
+			Name:       os.Args[3],
+			GrantTypes: client.List{client.GrantDeviceCode},
+		}
+		if len(os.Args) > 4 {
+			c.Scopes = strings.Fields(os.Args[4])
+		}
+		err = createClient(ctx, registry, c, true)
+	case "clients create-exchange":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		// Client credentials let the client get its own actor token.
+		c := client.Client{
+			Name:       os.Args[3],
+			GrantTypes: client.List{client.GrantTokenExchange, client.GrantClientCredentials},
+		}
+		if len(os.Args) > 4 {
+			c.Scopes = strings.Fields(os.Args[4])
+		}
+		err = createClient(ctx, registry, c, false)
+	case "clients rotate-secret":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		overlap := 24 * time.Hour
+		if len(os.Args) > 4 {
+			if overlap, err = time.ParseDuration(os.Args[4]); err != nil {
+				log.Fatal(usage)
+			}
+		}
+		err = rotateClientSecret(ctx, registry, os.Args[3], overlap)
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatalf("%s %s: %v", os.Args[1], os.Args[2], err)
+	}
+}
+
+func listTenants(ctx context.Context, registry *store.Registry) error {
+	list, err := registry.Tenants.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range list {
+		host := "-"
+		if t.Host != nil {
+			host = *t.Host
+		}
+		fmt.Printf("%s %-16s host=%s created=%s\n", t.ID, t.Slug, host, t.CreatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func createTenant(ctx context.Context, registry *store.Registry, slug, host string) error {
+	// A tenant on its own host is its own OpenID Connect issuer.
+	issuer := ""
+	if host != "" {
+		issuer = "https://" + host
+	}
+	t, err := registry.Tenants.Create(ctx, slug, slug, host, issuer)
+	if err != nil {
+		return err
+	}
+	// Give the tenant its first signing key now rather than on first load.
+	if _, err := keyring.Load(ctx, registry.SigningKeys, t); err != nil {
+		return err
+	}
+	// Roles are per tenant; start from the default tenant's, admin and
+	// support among them.
+	base, err := registry.Tenants.GetBySlug(ctx, tenant.DefaultSlug)
+	if err != nil {
+		return fmt.Errorf("tenant %s: %w", tenant.DefaultSlug, err)
+	}
+	if err := registry.Roles.Copy(ctx, base.ID, t.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("created tenant: %s (%s)\n", t.Slug, t.ID)
+	return nil
+}
+
+// currentTenant returns the tenant named by TENANT.
+func currentTenant(ctx context.Context, registry *store.Registry) (tenant.Tenant, error) {
+	slug := os.Getenv("TENANT")
+	if slug == "" {
+		slug = tenant.DefaultSlug
+	}
+	t, err := registry.Tenants.GetBySlug(ctx, slug)
+	if err != nil {
+		return tenant.Tenant{}, fmt.Errorf("tenant %s: %w", slug, err)
+	}
+	return t, nil
+}
+
+func listKeys(ctx context.Context, registry *store.Registry) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	ring, err := keyring.Load(ctx, registry.SigningKeys, t)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range ring.Keys() {
+		retires := "-"
+		if !k.RetiresAt.IsZero() {
+			retires = k.RetiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%-44s %-6s %-8s created=%s retires=%s\n",
+			k.ID, k.Algorithm, k.State, k.CreatedAt.Format(time.RFC3339), retires)
+	}
+	return nil
+}
+
+func rotateKeys(ctx context.Context, registry *store.Registry, alg string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	ring, err := keyring.Load(ctx, registry.SigningKeys, t)
+	if err != nil {
+		return err
+	}
+
+	next, err := token.GenerateKey(alg)
+	if err != nil {
+		return err
+	}
+	ring.Rotate(next, time.Now(), tenants.Config(token.ConfigFromEnv(), t).MaxLifetime())
+
+	if err := keyring.Save(ctx, registry.SigningKeys, t.ID, ring.Keys()); err != nil {
+		return err
+	}
+	fmt.Printf("rotated: %s (%s) is now current\n", next.ID, next.Algorithm)
+	return nil
+}
+
+func retireKey(ctx context.Context, registry *store.Registry, kid string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	ring, err := keyring.Load(ctx, registry.SigningKeys, t)
+	if err != nil {
+		return err
+	}
+
+	if err := ring.Retire(kid, time.Now()); err != nil {
+		return err
+	}
+
+	if err := keyring.Save(ctx, registry.SigningKeys, t.ID, ring.Keys()); err != nil {
+		return err
+	}
+	fmt.Printf("retired: %s\n", kid)
+	return nil
+}
+
+func logoutAll(ctx context.Context, registry *store.Registry, userID string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, userID); err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
+	}
+
+	cache := redis.New()
+	defer cache.Close()
+
+	// Revoking users and families needs no keys, only the lifetimes, which
+	// are the tenant's so the markers outlive its longest tokens.
+	verifier := token.NewVerifier(tenants.Config(token.ConfigFromEnv(), t), cache)
+	if err := verifier.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := registry.Sessions.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	err = registry.Events.Record(ctx, event.Event{
+		Kind:    event.KindLogoutAll,
+		Subject: userID,
+		Detail:  map[string]string{"by": "admin"},
+	})
+	if err != nil {
+		return fmt.Errorf("record security event: %w", err)
+	}
+
+	fmt.Printf("signed out everywhere: %s\n", userID)
+	return nil
+}
+
+func listSessions(ctx context.Context, registry *store.Registry, userID string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, userID); err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
+	}
+	maxLifetime := tenants.Config(token.ConfigFromEnv(), t).MaxLifetime()
+	sessions, err := registry.Sessions.ListActive(ctx, userID, time.Now().Add(-maxLifetime))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		fmt.Printf("%s ip=%s created=%s last_used=%s ua=%q\n",
+			s.ID, s.IP, s.CreatedAt.Format(time.RFC3339), s.LastUsedAt.Format(time.RFC3339), s.UserAgent)
+	}
+	return nil
+}
+
+func revokeSession(ctx context.Context, registry *store.Registry, id string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	sess, err := registry.Sessions.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("session %s: %w", id, err)
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, sess.UserID); err != nil {
+		return fmt.Errorf("session %s: user %s: %w", id, sess.UserID, err)
+	}
+
+	cache := redis.New()
+	defer cache.Close()
+
+	verifier := token.NewVerifier(tenants.Config(token.ConfigFromEnv(), t), cache)
+	if err := verifier.RevokeFamily(ctx, id); err != nil {
+		return err
+	}
+	if err := registry.Sessions.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked session: %s\n", id)
+	return nil
+}
+
+func listRoles(ctx context.Context, registry *store.Registry, userID string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, userID); err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
+	}
+	roles, err := registry.Roles.NamesForUser(ctx, t.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range roles {
+		fmt.Println(r)
+	}
+	return nil
+}
+
+func assignRole(ctx context.Context, registry *store.Registry, userID, role string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, userID); err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
+	}
+	if err := registry.Roles.Assign(ctx, t.ID, userID, role); err != nil {
+		return fmt.Errorf("role %s: %w", role, err)
+	}
+
+	err = registry.Events.Record(ctx, event.Event{
+		Kind:    event.KindRoleAssigned,
+		Subject: userID,
+		Detail:  map[string]string{"role": role, "by": "admin"},
+	})
+	if err != nil {
+		return fmt.Errorf("record security event: %w", err)
+	}
+
+	fmt.Printf("assigned %s to %s; it applies from their next login or refresh\n", role, userID)
+	return nil
+}
+
+func removeRole(ctx context.Context, registry *store.Registry, userID, role string) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Users.GetByID(ctx, t.ID, userID); err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
+	}
+	if err := registry.Roles.Remove(ctx, t.ID, userID, role); err != nil {
+		return fmt.Errorf("role %s: %w", role, err)
+	}
+
+	err = registry.Events.Record(ctx, event.Event{
+		Kind:    event.KindRoleRemoved,
+		Subject: userID,
+		Detail:  map[string]string{"role": role, "by": "admin"},
+	})
+	if err != nil {
+		return fmt.Errorf("record security event: %w", err)
+	}
+
+	fmt.Printf("removed %s from %s; it applies from their next login or refresh\n", role, userID)
+	return nil
+}
+
+func listClients(ctx context.Context, registry *store.Registry) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+	clients, err := registry.Clients.List(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range clients {
+		kind := "confidential"
+		if c.Public() {
+			kind = "public"
+		}
+		fmt.Printf("%s %-12s name=%q grant_types=%q redirect_uris=%q scope=%q\n",
+			c.ID, kind, c.Name, strings.Join(c.GrantTypes, " "), strings.Join(c.RedirectURIs, " "), strings.Join(c.Scopes, " "))
+	}
+	return nil
+}
+
+// createClient registers c in the current tenant, generating its ID and,
+// unless it is public, its secret.
+func createClient(ctx context.Context, registry *store.Registry, c client.Client, public bool) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+
+	c.ID = randomString(16)
+	c.TenantID = t.ID
+	for _, uri := range c.RedirectURIs {
+		if u, err := url.Parse(uri); err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("redirect URI %q must be absolute and have no fragment", uri)
+		}
+	}
+
+	var secret string
+	if !public {
+		secret = randomString(32)
+		hash, err := crypto.HashPassword(secret)
+		if err != nil {
+			return err
+		}
+		c.SecretHash = &hash
+	}
+
+	created, err := registry.Clients.Create(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_id:     %s\n", created.ID)
+	if secret != "" {
+		fmt.Printf("client_secret: %s\n", secret)
+		fmt.Println("The secret is shown only once; store it now.")
+	}
+	return nil
+}
+
+func rotateClientSecret(ctx context.Context, registry *store.Registry, id string, overlap time.Duration) error {
+	t, err := currentTenant(ctx, registry)
+	if err != nil {
+		return err
+	}
+
+	secret := randomString(32)
+	hash, err := crypto.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+	until := time.Now().Add(overlap)
+	if err := registry.Clients.RotateSecret(ctx, t.ID, id, hash, until); err != nil {
+		return fmt.Errorf("client %s: %w", id, err)
+	}
+
+	fmt.Printf("client_secret: %s\n", secret)
+	fmt.Printf("The previous secret keeps working until %s.\n", until.Format(time.RFC3339))
+	return nil
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
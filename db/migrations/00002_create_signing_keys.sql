@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE signing_keys (
+    kid          TEXT PRIMARY KEY,
+    algorithm    TEXT NOT NULL,
+    private_key  TEXT NOT NULL,
+    state        TEXT NOT NULL CHECK (state IN ('current', 'previous', 'retired')),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retires_at   TIMESTAMPTZ
+);
+
+-- Only one key may sign at a time.
+CREATE UNIQUE INDEX signing_keys_one_current ON signing_keys (state) WHERE state = 'current';
+
+-- +goose Down
+DROP TABLE signing_keys;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE security_events (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind        TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    ip          TEXT NOT NULL DEFAULT '',
+    user_agent  TEXT NOT NULL DEFAULT '',
+    detail      JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX security_events_subject_idx ON security_events (subject, created_at DESC);
+
+-- +goose Down
+DROP TABLE security_events;
@@ -0,0 +1,45 @@
+-- +goose Up
+-- A tenant is an isolated user pool with its own signing keys, token
+-- lifetimes and password policy. NULL lifetimes fall back to the defaults
+-- set in the environment.
+CREATE TABLE tenants (
+    id                  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug                TEXT NOT NULL UNIQUE,
+    name                TEXT NOT NULL DEFAULT '',
+    host                TEXT UNIQUE,
+    access_ttl_seconds  INTEGER CHECK (access_ttl_seconds > 0),
+    refresh_ttl_seconds INTEGER CHECK (refresh_ttl_seconds > 0),
+    password_min_length INTEGER NOT NULL DEFAULT 8 CHECK (password_min_length BETWEEN 8 AND 64),
+    password_check_breached BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Existing users and keys move to the default tenant.
+INSERT INTO tenants (slug, name) VALUES ('default', 'Default');
+
+ALTER TABLE users ADD COLUMN tenant_id UUID REFERENCES tenants (id) ON DELETE CASCADE;
+UPDATE users SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default');
+ALTER TABLE users ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_email_key UNIQUE (tenant_id, email);
+
+ALTER TABLE signing_keys ADD COLUMN tenant_id UUID REFERENCES tenants (id) ON DELETE CASCADE;
+UPDATE signing_keys SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default');
+ALTER TABLE signing_keys ALTER COLUMN tenant_id SET NOT NULL;
+
+-- Only one key per tenant may sign at a time.
+DROP INDEX signing_keys_one_current;
+CREATE UNIQUE INDEX signing_keys_one_current ON signing_keys (tenant_id) WHERE state = 'current';
+
+-- +goose Down
+DROP INDEX signing_keys_one_current;
+DELETE FROM signing_keys WHERE tenant_id <> (SELECT id FROM tenants WHERE slug = 'default');
+ALTER TABLE signing_keys DROP COLUMN tenant_id;
+CREATE UNIQUE INDEX signing_keys_one_current ON signing_keys (state) WHERE state = 'current';
+
+DELETE FROM users WHERE tenant_id <> (SELECT id FROM tenants WHERE slug = 'default');
+ALTER TABLE users DROP CONSTRAINT users_tenant_email_key;
+ALTER TABLE users DROP COLUMN tenant_id;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+DROP TABLE tenants;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Applications that sign users in through /oauth/authorize. Public clients
+-- (mobile and single-page apps) have no secret and rely on PKCE alone.
+-- redirect_uris and scope are space-separated lists.
+CREATE TABLE oauth_clients (
+    id            TEXT PRIMARY KEY,
+    tenant_id     UUID NOT NULL REFERENCES tenants (id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    secret_hash   TEXT,
+    redirect_uris TEXT NOT NULL,
+    scope         TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX oauth_clients_tenant_id_idx ON oauth_clients (tenant_id);
+
+-- +goose Down
+DROP TABLE oauth_clients;
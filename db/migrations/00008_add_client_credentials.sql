@@ -0,0 +1,14 @@
+-- +goose Up
+-- grant_types is a space-separated list. Existing clients were registered
+-- for the authorization code flow.
+ALTER TABLE oauth_clients ADD COLUMN grant_types TEXT NOT NULL DEFAULT 'authorization_code';
+
+-- After a rotation the previous secret keeps working until it expires, so
+-- deployments can pick up the new one without downtime.
+ALTER TABLE oauth_clients ADD COLUMN previous_secret_hash TEXT;
+ALTER TABLE oauth_clients ADD COLUMN previous_secret_expires_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE oauth_clients DROP COLUMN previous_secret_expires_at;
+ALTER TABLE oauth_clients DROP COLUMN previous_secret_hash;
+ALTER TABLE oauth_clients DROP COLUMN grant_types;
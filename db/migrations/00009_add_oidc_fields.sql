@@ -0,0 +1,12 @@
+-- +goose Up
+-- Nothing verifies addresses yet, so every user starts unverified.
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- OpenID Connect relying parties require the issuer to be the URL the
+-- discovery document is served from. A tenant on its own host sets it;
+-- NULL falls back to JWT_ISSUER.
+ALTER TABLE tenants ADD COLUMN issuer TEXT;
+
+-- +goose Down
+ALTER TABLE tenants DROP COLUMN issuer;
+ALTER TABLE users DROP COLUMN email_verified;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Support staff impersonate customers through token exchange. Grant the
+-- role with: go run ./cmd/admin roles assign <user> support
+INSERT INTO roles (name, description) VALUES ('support', 'Acts as customers while debugging');
+INSERT INTO permissions (name, description) VALUES ('users:impersonate', 'Exchange tokens to act as another user');
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'support' AND p.name = 'users:impersonate';
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'users:impersonate';
+DELETE FROM roles WHERE name = 'support';
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Links a user to their account at an upstream OpenID Connect provider.
+-- provider is the name in OIDC_PROVIDERS_FILE; subject is the provider's
+-- sub claim, which is only unique per provider.
+CREATE TABLE federated_identities (
+    tenant_id  UUID NOT NULL REFERENCES tenants (id) ON DELETE CASCADE,
+    provider   TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, provider, subject)
+);
+
+CREATE INDEX federated_identities_user_id_idx ON federated_identities (user_id);
+
+-- +goose Down
+DROP TABLE federated_identities;
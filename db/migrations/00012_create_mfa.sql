@@ -0,0 +1,23 @@
+-- +goose Up
+-- A user's TOTP authenticator. It is pending until confirmed_at is set by
+-- the first code the user enters, and only a confirmed one is asked for at
+-- login. The secret is kept as the base32 the authenticator app was given.
+CREATE TABLE mfa_totp (
+    user_id      UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret       TEXT NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One-time codes that stand in for a lost authenticator. Only SHA-256
+-- hashes are kept; used_at is set when a code is spent.
+CREATE TABLE mfa_recovery_codes (
+    user_id   UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at   TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+DROP TABLE mfa_totp;
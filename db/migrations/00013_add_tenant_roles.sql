@@ -0,0 +1,53 @@
+-- +goose Up
+-- Roles belong to a tenant, so what a role grants in one tenant says
+-- nothing about another. Permissions stay global: they are the names the
+-- code checks for.
+ALTER TABLE roles ADD COLUMN tenant_id UUID REFERENCES tenants (id) ON DELETE CASCADE;
+UPDATE roles SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default');
+ALTER TABLE roles ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE roles DROP CONSTRAINT roles_name_key;
+ALTER TABLE roles ADD CONSTRAINT roles_tenant_name_key UNIQUE (tenant_id, name);
+-- Lets role_permissions refer to a role together with its tenant.
+ALTER TABLE roles ADD CONSTRAINT roles_tenant_id_key UNIQUE (tenant_id, id);
+
+-- Every other tenant gets its own copy of the roles so far.
+INSERT INTO roles (tenant_id, name, description)
+SELECT t.id, r.name, r.description
+FROM tenants t CROSS JOIN roles r
+WHERE t.slug <> 'default';
+
+ALTER TABLE role_permissions ADD COLUMN tenant_id UUID;
+UPDATE role_permissions rp SET tenant_id = r.tenant_id FROM roles r WHERE r.id = rp.role_id;
+INSERT INTO role_permissions (tenant_id, role_id, permission_id)
+SELECT copy.tenant_id, copy.id, rp.permission_id
+FROM role_permissions rp
+JOIN roles orig ON orig.id = rp.role_id
+JOIN roles copy ON copy.name = orig.name AND copy.tenant_id <> orig.tenant_id;
+ALTER TABLE role_permissions ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_role_id_fkey;
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_role_fkey
+    FOREIGN KEY (tenant_id, role_id) REFERENCES roles (tenant_id, id) ON DELETE CASCADE;
+
+-- Users of other tenants keep their roles, now their own tenant's.
+UPDATE user_roles ur SET role_id = copy.id
+FROM users u, roles orig, roles copy
+WHERE u.id = ur.user_id AND orig.id = ur.role_id
+  AND copy.tenant_id = u.tenant_id AND copy.name = orig.name AND orig.tenant_id <> u.tenant_id;
+
+-- +goose Down
+UPDATE user_roles ur SET role_id = orig.id
+FROM roles copy, roles orig
+WHERE copy.id = ur.role_id AND orig.name = copy.name
+  AND copy.tenant_id <> (SELECT id FROM tenants WHERE slug = 'default')
+  AND orig.tenant_id = (SELECT id FROM tenants WHERE slug = 'default');
+DELETE FROM roles WHERE tenant_id <> (SELECT id FROM tenants WHERE slug = 'default');
+
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_role_fkey;
+ALTER TABLE role_permissions DROP COLUMN tenant_id;
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_role_id_fkey
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE;
+
+ALTER TABLE roles DROP CONSTRAINT roles_tenant_id_key;
+ALTER TABLE roles DROP CONSTRAINT roles_tenant_name_key;
+ALTER TABLE roles DROP COLUMN tenant_id;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
@@ -0,0 +1,118 @@
+// Package dpop verifies RFC 9449 DPoP proofs: short-lived JWTs, signed with a
+// key the client holds, that tie each request to that key.
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/jwk"
+)
+
+const headerType = "dpop+jwt"
+
+// ErrInvalidProof wraps every reason a proof is rejected.
+var ErrInvalidProof = errors.New("invalid DPoP proof")
+
+// Proof is a verified DPoP proof.
+type Proof struct {
+	ID string
+	// Thumbprint is the RFC 7638 thumbprint of the proof key, the value
+	// tokens are bound to through their cnf.jkt claim.
+	Thumbprint string
+	IssuedAt   time.Time
+}
+
+// Verify checks a proof for a request with the given method and URL.
+// accessToken is the token the proof must carry a hash of, or "" when the
+// proof is presented to obtain tokens. Proofs issued more than maxAge ago,
+// or more than leeway in the future, are rejected. Replay is the caller's
+// concern: remember Proof.ID for maxAge plus leeway.
+func Verify(proof, method, requestURL, accessToken string, maxAge, leeway time.Duration) (*Proof, error) {
+	var key jwk.JWK
+	t, err := jwt.Parse(proof, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != headerType {
+			return nil, fmt.Errorf("typ must be %s", headerType)
+		}
+		raw, ok := t.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		if _, private := raw["d"]; private {
+			return nil, fmt.Errorf("jwk header must not contain a private key")
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &key); err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	}, jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidProof)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("%w: missing jti claim", ErrInvalidProof)
+	}
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, fmt.Errorf("%w: htm does not match the request method", ErrInvalidProof)
+	}
+	if htu, _ := claims["htu"].(string); !sameURL(htu, requestURL) {
+		return nil, fmt.Errorf("%w: htu does not match the request URL", ErrInvalidProof)
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return nil, fmt.Errorf("%w: missing iat claim", ErrInvalidProof)
+	}
+	now := time.Now()
+	if iat.Before(now.Add(-maxAge)) || iat.After(now.Add(leeway)) {
+		return nil, fmt.Errorf("%w: iat outside the acceptable window", ErrInvalidProof)
+	}
+
+	ath, _ := claims["ath"].(string)
+	if accessToken != "" && ath != AccessTokenHash(accessToken) {
+		return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+	}
+
+	return &Proof{ID: jti, Thumbprint: jwk.Thumbprint(key), IssuedAt: iat.Time}, nil
+}
+
+// AccessTokenHash is the ath value for a token: the base64url SHA-256 of it.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sameURL compares two URLs ignoring query and fragment, as RFC 9449
+// section 4.3 requires, with case-insensitive scheme and host.
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || a == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.EscapedPath() == ub.EscapedPath()
+}
@@ -0,0 +1,103 @@
+package dpop
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/jwk"
+)
+
+func newProof(t *testing.T, priv ed25519.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	pub, err := jwk.FromPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	var header map[string]any
+	b, _ := json.Marshal(pub)
+	json.Unmarshal(b, &header)
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["typ"] = "dpop+jwt"
+	tok.Header["jwk"] = header
+	signed, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatalf("sign proof: %v", err)
+	}
+	return signed
+}
+
+func proofClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": "GET",
+		"htu": "https://api.test/resource",
+		"iat": time.Now().Unix(),
+		"ath": AccessTokenHash("access-token"),
+	}
+}
+
+func TestVerifyAcceptsValidProof(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pub, _ := jwk.FromPublicKey(priv.Public())
+
+	p, err := Verify(newProof(t, priv, proofClaims()), "GET", "https://API.test/resource?page=2", "access-token", time.Minute, 5*time.Second)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.ID != "proof-1" || p.Thumbprint != jwk.Thumbprint(pub) {
+		t.Errorf("unexpected proof: %+v", p)
+	}
+}
+
+func TestVerifyRejectsMismatches(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	cases := map[string]func(jwt.MapClaims){
+		"method":       func(c jwt.MapClaims) { c["htm"] = "POST" },
+		"url":          func(c jwt.MapClaims) { c["htu"] = "https://api.test/other" },
+		"stale":        func(c jwt.MapClaims) { c["iat"] = time.Now().Add(-time.Hour).Unix() },
+		"future":       func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"token hash":   func(c jwt.MapClaims) { c["ath"] = AccessTokenHash("other-token") },
+		"missing jti":  func(c jwt.MapClaims) { delete(c, "jti") },
+		"missing hash": func(c jwt.MapClaims) { delete(c, "ath") },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := proofClaims()
+			mutate(claims)
+			_, err := Verify(newProof(t, priv, claims), "GET", "https://api.test/resource", "access-token", time.Minute, 5*time.Second)
+			if !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("expected ErrInvalidProof, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsWrongType(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, proofClaims())
+	signed, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := Verify(signed, "GET", "https://api.test/resource", "access-token", time.Minute, 0); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a plain JWT, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestThumbprintRFC7638Example(t *testing.T) {
+	// Example key from RFC 7638 section 3.1.
+	j := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+		Alg: "RS256",
+		Kid: "2011-04-29",
+	}
+
+	if got := Thumbprint(j); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint: %s", got)
+	}
+}
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa key: %v", err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519 key: %v", err)
+	}
+
+	for name, pub := range map[string]interface {
+		Equal(x crypto.PublicKey) bool
+	}{
+		"RSA":     &rsaKey.PublicKey,
+		"EC":      &ecKey.PublicKey,
+		"Ed25519": edPub,
+	} {
+		t.Run(name, func(t *testing.T) {
+			j, err := FromPublicKey(pub)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			decoded, err := j.PublicKey()
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !pub.Equal(decoded) {
+				t.Fatal("decoded key does not match original")
+			}
+		})
+	}
+}
+
+func TestUnsupportedCurveRejected(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa key: %v", err)
+	}
+	if _, err := FromPublicKey(&k.PublicKey); err == nil {
+		t.Fatal("expected error for P-384 key, got nil")
+	}
+}
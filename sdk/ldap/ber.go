@@ -0,0 +1,201 @@
+package ldap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifiers used by the LDAPv3 messages this package speaks
+// (RFC 4511). Application tags are constructed unless noted.
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	appBindRequest     = 0x60
+	appBindResponse    = 0x61
+	appUnbindRequest   = 0x42 // primitive
+	appSearchRequest   = 0x63
+	appSearchEntry     = 0x64
+	appSearchDone      = 0x65
+	appSearchReference = 0x73
+	ctxSimpleAuth      = 0x80 // primitive
+	ctxFilterAnd       = 0xa0
+	ctxFilterOr        = 0xa1
+	ctxFilterNot       = 0xa2
+	ctxFilterEquality  = 0xa3
+	ctxFilterPresent   = 0x87 // primitive
+
+	constructed   = 0x20
+	highTagNumber = 0x1f
+)
+
+// maxPacketSize bounds what is read from the server in one message.
+const maxPacketSize = 4 << 20
+
+// packet is a decoded BER element. Constructed elements have children;
+// primitive ones have value.
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+// tlv encodes one element from its identifier and contents.
+func tlv(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := append([]byte{tag}, encodeLength(n)...)
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berInt(tag byte, v int64) []byte {
+	// Two's complement, minimal length.
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return tlv(tag, b)
+}
+
+func berString(s string) []byte {
+	return tlv(tagOctetString, []byte(s))
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return tlv(tagBoolean, []byte{0xff})
+	}
+	return tlv(tagBoolean, []byte{0x00})
+}
+
+type reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readPacket reads one element from r. It returns io.EOF only if r ends
+// before the element starts.
+func readPacket(r reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&highTagNumber == highTagNumber {
+		return nil, errors.New("ldap: unsupported BER tag")
+	}
+	n, err := readLength(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return decode(tag, content)
+}
+
+func readLength(r reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int(b), nil
+	}
+	count := int(b & 0x7f)
+	if count == 0 || count > 4 {
+		return 0, errors.New("ldap: unsupported BER length")
+	}
+	n := 0
+	for range count {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		n = n<<8 | int(b)
+	}
+	if n > maxPacketSize {
+		return 0, fmt.Errorf("ldap: message of %d bytes is too large", n)
+	}
+	return n, nil
+}
+
+// decode parses the contents of an element already read.
+func decode(tag byte, content []byte) (*packet, error) {
+	p := &packet{tag: tag}
+	if tag&constructed == 0 {
+		p.value = content
+		return p, nil
+	}
+	r := bytes.NewReader(content)
+	for {
+		child, err := readPacket(r)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+	}
+}
+
+// child returns the i-th child, or nil if there is none.
+func (p *packet) child(i int) *packet {
+	if p == nil || i >= len(p.children) {
+		return nil
+	}
+	return p.children[i]
+}
+
+// list returns the children, or nil for a missing packet.
+func (p *packet) list() []*packet {
+	if p == nil {
+		return nil
+	}
+	return p.children
+}
+
+func (p *packet) str() string {
+	if p == nil {
+		return ""
+	}
+	return string(p.value)
+}
+
+// int decodes an INTEGER or ENUMERATED value.
+func (p *packet) int() (int64, error) {
+	if p == nil || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errors.New("ldap: malformed integer")
+	}
+	v := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
@@ -0,0 +1,67 @@
+package ldap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// validName keeps directory names in the same form as provider names.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Config connects to a directory and says whose passwords it checks.
+type Config struct {
+	// Name identifies the directory in linked identities, e.g. corp.
+	Name string `json:"name"`
+	// URL is the server, ldap://host:389 or ldaps://host:636.
+	URL string `json:"url"`
+	// BindDN and BindPassword are the service account users are searched
+	// for with. Both empty searches anonymously.
+	BindDN       string `json:"bind_dn,omitempty"`
+	BindPassword string `json:"bind_password,omitempty"`
+	// BaseDN is where users are searched for, e.g. ou=staff,dc=corp,dc=example.
+	BaseDN string `json:"base_dn"`
+	// EmailAttribute defaults to mail, ObjectClass to person and
+	// GroupAttribute to memberOf, as in Active Directory.
+	EmailAttribute string `json:"email_attribute,omitempty"`
+	ObjectClass    string `json:"object_class,omitempty"`
+	GroupAttribute string `json:"group_attribute,omitempty"`
+	// GroupRoles maps group DNs to the roles their members get.
+	GroupRoles map[string][]string `json:"group_roles,omitempty"`
+	// Domains and Tenants select the users who sign in against the
+	// directory: those with an email address in one of Domains, in one of
+	// the tenants with slugs in Tenants. At least one must be set.
+	Domains []string `json:"domains,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// ReadConfigs reads a JSON array of directory configurations from path.
+func ReadConfigs(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if !validName.MatchString(c.Name) {
+			return nil, fmt.Errorf("directory name %q must be lowercase letters, digits, - and _", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("directory %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.URL == "" || c.BaseDN == "" {
+			return nil, fmt.Errorf("directory %s needs a url and base_dn", c.Name)
+		}
+		if len(c.Domains) == 0 && len(c.Tenants) == 0 {
+			return nil, fmt.Errorf("directory %s needs domains or tenants", c.Name)
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,256 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP result codes (RFC 4511 section 4.1.9) this package tells apart.
+const (
+	resultSuccess            = 0
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+)
+
+// Filter is a search filter. Values are sent as they are, so a filter
+// built from user input cannot be widened by it the way a filter string
+// can.
+type Filter []byte
+
+// Equal matches entries whose attr has value.
+func Equal(attr, value string) Filter {
+	return tlv(ctxFilterEquality, berString(attr), berString(value))
+}
+
+// Present matches entries that have attr.
+func Present(attr string) Filter {
+	return tlv(ctxFilterPresent, []byte(attr))
+}
+
+// And matches entries every filter matches.
+func And(filters ...Filter) Filter {
+	return tlv(ctxFilterAnd, join(filters)...)
+}
+
+// Or matches entries any filter matches.
+func Or(filters ...Filter) Filter {
+	return tlv(ctxFilterOr, join(filters)...)
+}
+
+// Not matches entries f does not.
+func Not(f Filter) Filter {
+	return tlv(ctxFilterNot, f)
+}
+
+func join(filters []Filter) [][]byte {
+	out := make([][]byte, len(filters))
+	for i, f := range filters {
+		out[i] = f
+	}
+	return out
+}
+
+// Entry is a search result.
+type Entry struct {
+	DN string
+	// Attributes holds values by attribute name, lower-cased since names
+	// are case-insensitive.
+	Attributes map[string][]string
+}
+
+// Get returns the first value of attr, or "".
+func (e Entry) Get(attr string) string {
+	if v := e.Attributes[strings.ToLower(attr)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// ResultError is an operation the server refused.
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// conn is a connection to a directory server. Operations are sent one at
+// a time and wait for their result.
+type conn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	id int64
+}
+
+// dial connects to rawURL, an ldap:// or ldaps:// URL. The context's
+// deadline, if any, covers every operation on the connection.
+func dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: parse url: %w", err)
+	}
+	host := u.Host
+	var d interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		d = &net.Dialer{}
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		cfg := tlsConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		d = &tls.Dialer{Config: cfg}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+
+	c, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	return &conn{c: c, r: bufio.NewReader(c)}, nil
+}
+
+// send writes op as the next message and returns its ID.
+func (c *conn) send(op []byte) (int64, error) {
+	c.id++
+	_, err := c.c.Write(tlv(tagSequence, berInt(tagInteger, c.id), op))
+	return c.id, err
+}
+
+// receive reads the next message for id and returns its protocol op.
+// Messages for other IDs, such as a notice of disconnection, are errors.
+func (c *conn) receive(id int64) (*packet, error) {
+	msg, err := readPacket(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: read response: %w", err)
+	}
+	got, err := msg.child(0).int()
+	if err != nil || msg.tag != tagSequence || msg.child(1) == nil {
+		return nil, errors.New("ldap: malformed message")
+	}
+	if got != id {
+		return nil, fmt.Errorf("ldap: unexpected message %d", got)
+	}
+	return msg.child(1), nil
+}
+
+// result checks an LDAPResult.
+func result(op *packet) error {
+	code, err := op.child(0).int()
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: op.child(2).str()}
+	}
+	return nil
+}
+
+// bind authenticates the connection as dn with a simple bind.
+func (c *conn) bind(dn, password string) error {
+	id, err := c.send(tlv(appBindRequest,
+		berInt(tagInteger, 3),
+		berString(dn),
+		tlv(ctxSimpleAuth, []byte(password)),
+	))
+	if err != nil {
+		return fmt.Errorf("ldap: bind: %w", err)
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != appBindResponse {
+		return errors.New("ldap: unexpected response to bind")
+	}
+	return result(op)
+}
+
+// search runs a subtree search under base and returns the entries found,
+// with attrs. It fails if there are more than limit.
+func (c *conn) search(base string, filter Filter, attrs []string, limit int) ([]Entry, error) {
+	attrList := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		attrList[i] = berString(a)
+	}
+	id, err := c.send(tlv(appSearchRequest,
+		berString(base),
+		berInt(tagEnumerated, 2), // wholeSubtree
+		berInt(tagEnumerated, 0), // neverDerefAliases
+		berInt(tagInteger, int64(limit)),
+		berInt(tagInteger, 0),
+		berBool(false),
+		filter,
+		tlv(tagSequence, attrList...),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: search: %w", err)
+	}
+
+	var entries []Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case appSearchEntry:
+			entries = append(entries, readEntry(op))
+		case appSearchReference:
+			// Referrals to other servers are not followed.
+		case appSearchDone:
+			if err := result(op); err != nil {
+				var re *ResultError
+				if errors.As(err, &re) && re.Code == resultNoSuchObject {
+					return nil, nil
+				}
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errors.New("ldap: unexpected response to search")
+		}
+	}
+}
+
+func readEntry(op *packet) Entry {
+	e := Entry{DN: op.child(0).str(), Attributes: map[string][]string{}}
+	for _, a := range op.child(1).list() {
+		name := strings.ToLower(a.child(0).str())
+		for _, v := range a.child(1).list() {
+			e.Attributes[name] = append(e.Attributes[name], v.str())
+		}
+	}
+	return e
+}
+
+// close unbinds and closes the connection.
+func (c *conn) close() {
+	c.c.SetWriteDeadline(time.Now().Add(time.Second))
+	c.send(tlv(appUnbindRequest))
+	c.c.Close()
+}
@@ -0,0 +1,143 @@
+// Package ldap checks passwords against an LDAP directory such as Active
+// Directory. It speaks just enough LDAPv3 for that: simple binds and
+// subtree searches, over ldap:// or ldaps://.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredentials is returned for an unknown user or wrong password.
+var ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// timeout bounds one authentication, connection included.
+const timeout = 10 * time.Second
+
+// User is a directory user who signed in.
+type User struct {
+	DN    string
+	Email string
+	// Groups are the DNs of the groups the user is a member of.
+	Groups []string
+}
+
+// Directory is a directory server users sign in against. It is safe for
+// concurrent use; each authentication uses a connection of its own.
+type Directory struct {
+	cfg Config
+	tls *tls.Config
+}
+
+// New returns a Directory for cfg. tlsConfig is used for ldaps:// and may
+// be nil for the system roots.
+func New(cfg Config, tlsConfig *tls.Config) *Directory {
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.ObjectClass == "" {
+		cfg.ObjectClass = "person"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return &Directory{cfg: cfg, tls: tlsConfig}
+}
+
+// Name identifies the directory in linked identities.
+func (d *Directory) Name() string {
+	return d.cfg.Name
+}
+
+// Serves reports whether users of tenant with email sign in against d.
+func (d *Directory) Serves(tenant, email string) bool {
+	if len(d.cfg.Tenants) > 0 && !slices.Contains(d.cfg.Tenants, tenant) {
+		return false
+	}
+	if len(d.cfg.Domains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(email, "@")
+	return ok && slices.ContainsFunc(d.cfg.Domains, func(dom string) bool {
+		return strings.EqualFold(dom, domain)
+	})
+}
+
+// Authenticate finds the user with email, searching as the configured
+// service account, and binds as them with password.
+func (d *Directory) Authenticate(ctx context.Context, email, password string) (User, error) {
+	// A simple bind with an empty password is an unauthenticated bind,
+	// which many servers accept for any DN.
+	if email == "" || password == "" {
+		return User{}, ErrInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c, err := dial(ctx, d.cfg.URL, d.tls)
+	if err != nil {
+		return User{}, err
+	}
+	defer c.close()
+
+	if err := c.bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+		return User{}, fmt.Errorf("ldap: bind service account: %w", err)
+	}
+	entries, err := c.search(d.cfg.BaseDN,
+		And(Equal("objectClass", d.cfg.ObjectClass), Equal(d.cfg.EmailAttribute, email)),
+		[]string{d.cfg.EmailAttribute, d.cfg.GroupAttribute}, 2)
+	if err != nil {
+		return User{}, err
+	}
+	switch len(entries) {
+	case 0:
+		return User{}, ErrInvalidCredentials
+	case 1:
+	default:
+		return User{}, fmt.Errorf("ldap: more than one entry has %s %s", d.cfg.EmailAttribute, email)
+	}
+	entry := entries[0]
+
+	if err := c.bind(entry.DN, password); err != nil {
+		var re *ResultError
+		if errors.As(err, &re) && re.Code == resultInvalidCredentials {
+			return User{}, ErrInvalidCredentials
+		}
+		return User{}, err
+	}
+
+	return User{
+		DN:     entry.DN,
+		Email:  entry.Get(d.cfg.EmailAttribute),
+		Groups: entry.Attributes[strings.ToLower(d.cfg.GroupAttribute)],
+	}, nil
+}
+
+// Roles returns the roles groups map to, sorted and without duplicates.
+// Group DNs compare case-insensitively.
+func (d *Directory) Roles(groups []string) []string {
+	var roles []string
+	for group, mapped := range d.cfg.GroupRoles {
+		if slices.ContainsFunc(groups, func(g string) bool { return strings.EqualFold(g, group) }) {
+			roles = append(roles, mapped...)
+		}
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
+
+// ManagedRoles returns every role the group mapping can grant. Membership
+// of these follows the directory; other roles are left alone.
+func (d *Directory) ManagedRoles() []string {
+	var roles []string
+	for _, mapped := range d.cfg.GroupRoles {
+		roles = append(roles, mapped...)
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
@@ -0,0 +1,287 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	serviceDN       = "cn=svc,dc=corp,dc=example"
+	servicePassword = "svc-secret"
+	engineersDN     = "cn=Engineers,ou=groups,dc=corp,dc=example"
+	adminsDN        = "cn=Admins,ou=groups,dc=corp,dc=example"
+)
+
+// dirEntry is an entry in the stand-in directory.
+type dirEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// server is an in-process LDAP stand-in. It answers simple binds and
+// subtree searches with equality, presence, and, or and not filters, and
+// only lets the service account search.
+type server struct {
+	ln      net.Listener
+	entries []dirEntry
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newServer(t *testing.T, entries ...dirEntry) *server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &server{ln: ln, entries: entries}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *server) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *server) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	bound := ""
+	for {
+		msg, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		id, _ := msg.child(0).int()
+		op := msg.child(1)
+		reply := func(op []byte) { c.Write(tlv(tagSequence, berInt(tagInteger, id), op)) }
+		done := func(tag byte, code int64) {
+			reply(tlv(tag, berInt(tagEnumerated, code), berString(""), berString("")))
+		}
+
+		switch op.tag {
+		case appBindRequest:
+			dn, password := op.child(1).str(), op.child(2).str()
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+			bound = ""
+			code := int64(resultInvalidCredentials)
+			if s.checkPassword(dn, password) {
+				bound, code = dn, resultSuccess
+			}
+			done(appBindResponse, code)
+		case appSearchRequest:
+			if bound != serviceDN {
+				done(appSearchDone, 50) // insufficientAccessRights
+				continue
+			}
+			base, filter := strings.ToLower(op.child(0).str()), op.child(6)
+			limit, _ := op.child(3).int()
+			var found []dirEntry
+			for _, e := range s.entries {
+				if strings.HasSuffix(strings.ToLower(e.dn), base) && match(filter, e) {
+					found = append(found, e)
+				}
+			}
+			if limit > 0 && int64(len(found)) > limit {
+				done(appSearchDone, 4) // sizeLimitExceeded
+				continue
+			}
+			for _, e := range found {
+				var attrs [][]byte
+				for name, values := range e.attrs {
+					var vals [][]byte
+					for _, v := range values {
+						vals = append(vals, berString(v))
+					}
+					attrs = append(attrs, tlv(tagSequence, berString(name), tlv(tagSet, vals...)))
+				}
+				reply(tlv(appSearchEntry, berString(e.dn), tlv(tagSequence, attrs...)))
+			}
+			done(appSearchDone, resultSuccess)
+		case appUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *server) checkPassword(dn, password string) bool {
+	if dn == serviceDN {
+		return password == servicePassword
+	}
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) {
+			return e.password != "" && e.password == password
+		}
+	}
+	return false
+}
+
+func (s *server) userBinds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.DeleteFunc(slices.Clone(s.binds), func(dn string) bool { return dn == serviceDN })
+}
+
+func match(f *packet, e dirEntry) bool {
+	values := func(attr string) []string {
+		for name, v := range e.attrs {
+			if strings.EqualFold(name, attr) {
+				return v
+			}
+		}
+		return nil
+	}
+	switch f.tag {
+	case ctxFilterAnd:
+		for _, c := range f.children {
+			if !match(c, e) {
+				return false
+			}
+		}
+		return true
+	case ctxFilterOr:
+		return slices.ContainsFunc(f.children, func(c *packet) bool { return match(c, e) })
+	case ctxFilterNot:
+		return !match(f.child(0), e)
+	case ctxFilterEquality:
+		want := f.child(1).str()
+		return slices.ContainsFunc(values(f.child(0).str()), func(v string) bool { return strings.EqualFold(v, want) })
+	case ctxFilterPresent:
+		return len(values(string(f.value))) > 0
+	}
+	return false
+}
+
+var jane = dirEntry{
+	dn:       "uid=jane,ou=staff,dc=corp,dc=example",
+	password: "correct horse",
+	attrs: map[string][]string{
+		"objectClass": {"top", "person"},
+		"mail":        {"jane@corp.example"},
+		"memberOf":    {strings.ToUpper(engineersDN), "cn=Lunch Club,ou=groups,dc=corp,dc=example"},
+		// Long enough to need BER's long length form.
+		"description": {strings.Repeat("x", 300)},
+	},
+}
+
+func directory(s *server) *Directory {
+	return New(Config{
+		Name:         "corp",
+		URL:          s.url(),
+		BindDN:       serviceDN,
+		BindPassword: servicePassword,
+		BaseDN:       "ou=staff,dc=corp,dc=example",
+		GroupRoles: map[string][]string{
+			engineersDN: {"developer"},
+			adminsDN:    {"admin", "developer"},
+		},
+		Domains: []string{"corp.example"},
+	}, nil)
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := newServer(t, jane)
+	d := directory(s)
+
+	u, err := d.Authenticate(context.Background(), "jane@corp.example", "correct horse")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if u.DN != jane.dn || u.Email != "jane@corp.example" || len(u.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+	if roles := d.Roles(u.Groups); !slices.Equal(roles, []string{"developer"}) {
+		t.Errorf("expected [developer], got %v", roles)
+	}
+	if binds := s.userBinds(); !slices.Equal(binds, []string{jane.dn}) {
+		t.Errorf("expected one bind as the user, got %v", binds)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	s := newServer(t, jane)
+	d := directory(s)
+
+	for name, creds := range map[string][2]string{
+		"wrong password": {"jane@corp.example", "wrong"},
+		"unknown user":   {"john@corp.example", "correct horse"},
+		"empty password": {"jane@corp.example", ""},
+		"wildcard email": {"*", "correct horse"},
+	} {
+		if _, err := d.Authenticate(context.Background(), creds[0], creds[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+	}
+	// Only the wrong password gets as far as binding as the user.
+	if binds := s.userBinds(); !slices.Equal(binds, []string{jane.dn}) {
+		t.Errorf("expected one bind as the user, got %v", binds)
+	}
+}
+
+func TestAuthenticateServiceAccountFailure(t *testing.T) {
+	s := newServer(t, jane)
+	cfg := directory(s).cfg
+	cfg.BindPassword = "wrong"
+	d := New(cfg, nil)
+
+	_, err := d.Authenticate(context.Background(), "jane@corp.example", "correct horse")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected a service account error, got %v", err)
+	}
+}
+
+func TestAuthenticateAmbiguousEmail(t *testing.T) {
+	twin := jane
+	twin.dn = "uid=jane2,ou=staff,dc=corp,dc=example"
+	d := directory(newServer(t, jane, twin))
+
+	_, err := d.Authenticate(context.Background(), "jane@corp.example", "correct horse")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected an error for two entries with one email, got %v", err)
+	}
+}
+
+func TestServes(t *testing.T) {
+	d := New(Config{Domains: []string{"corp.example"}, Tenants: []string{"staff"}}, nil)
+	tests := []struct {
+		tenant, email string
+		want          bool
+	}{
+		{"staff", "jane@corp.example", true},
+		{"staff", "jane@CORP.example", true},
+		{"staff", "jane@gmail.com", false},
+		{"default", "jane@corp.example", false},
+		{"staff", "corp.example", false},
+	}
+	for _, tt := range tests {
+		if got := d.Serves(tt.tenant, tt.email); got != tt.want {
+			t.Errorf("Serves(%q, %q) = %v, want %v", tt.tenant, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestManagedRoles(t *testing.T) {
+	d := directory(newServer(t))
+	if got := d.ManagedRoles(); !slices.Equal(got, []string{"admin", "developer"}) {
+		t.Errorf("expected [admin developer], got %v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var defaultScopes = []string{"openid", "email"}
+
+// validName keeps provider names safe to use as a URL path segment.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Config registers this service as a client of an upstream provider.
+type Config struct {
+	// Name identifies the provider in URLs and linked identities, e.g.
+	// google. Changing it unlinks every user who signed in through it.
+	Name string `json:"name"`
+	// DisplayName is shown on the sign-in button. Defaults to Name.
+	DisplayName string `json:"display_name,omitempty"`
+	// Issuer is the provider's issuer URL. The discovery document is read
+	// from Issuer + /.well-known/openid-configuration.
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Scopes defaults to openid email.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// ReadConfigs reads a JSON array of provider configurations from path.
+func ReadConfigs(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if !validName.MatchString(c.Name) {
+			return nil, fmt.Errorf("provider name %q must be lowercase letters, digits, - and _", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("provider %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Issuer == "" || c.ClientID == "" || c.ClientSecret == "" {
+			return nil, fmt.Errorf("provider %s needs an issuer, client_id and client_secret", c.Name)
+		}
+	}
+	return configs, nil
+}
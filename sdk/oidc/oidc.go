@@ -0,0 +1,216 @@
+// Package oidc signs users in with upstream OpenID Connect providers. It is
+// the relying party side of the authorization code flow: it builds the
+// redirect to the provider, redeems the code it sends back and verifies the
+// ID token against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-as-a-service/sdk/pkce"
+	"auth-as-a-service/sdk/verifier"
+)
+
+// Identity is who the provider says signed in.
+type Identity struct {
+	// Subject is the provider's stable identifier for the user.
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// metadata is the part of the discovery document the flow needs.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an upstream OpenID Connect provider. Its discovery document
+// and keys are fetched on first use, so a provider that is down at startup
+// only fails the sign-ins that need it. It is safe for concurrent use.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	ids  *verifier.Verifier
+}
+
+// NewProvider returns a Provider for cfg. client defaults to one with a 10
+// second timeout.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultScopes
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Name identifies the provider in URLs and linked identities.
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// DisplayName is what the sign-in button says.
+func (p *Provider) DisplayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider URL to send the user to. state and nonce
+// must be unguessable and remembered until the callback; codeChallenge is
+// the S256 PKCE challenge of a verifier remembered with them.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("parse authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", pkce.MethodS256)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems code at the provider's token endpoint and returns the
+// identity in the ID token, once its signature, issuer, audience, expiry
+// and nonce have been checked.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI, nonce string) (Identity, error) {
+	meta, ids, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 section 2.3.1: credentials are form-encoded before Basic.
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("redeem code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return Identity{}, fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("redeem code: %s %s", body.Error, body.Description)
+	}
+	if body.IDToken == "" {
+		return Identity{}, fmt.Errorf("token response has no id_token")
+	}
+
+	claims, err := ids.VerifyIDToken(ctx, body.IDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("verify id token: %w", err)
+	}
+	if got, _ := claims.Custom["nonce"].(string); nonce == "" || got != nonce {
+		return Identity{}, fmt.Errorf("verify id token: nonce mismatch")
+	}
+
+	id := Identity{Subject: claims.Subject}
+	id.Email, _ = claims.Custom["email"].(string)
+	// Some providers send email_verified as a string.
+	switch v := claims.Custom["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	return id, nil
+}
+
+// discover fetches the discovery document and the keys it names, once. A
+// failure is not remembered, so the next call tries again.
+func (p *Provider) discover(ctx context.Context) (*metadata, *verifier.Verifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.ids, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build discovery request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetch discovery document: unexpected status %d", resp.StatusCode)
+	}
+
+	var meta metadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&meta); err != nil {
+		return nil, nil, fmt.Errorf("decode discovery document: %w", err)
+	}
+	// OpenID Connect Discovery section 4.3: the document must name the
+	// issuer it was fetched for.
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("discovery document names issuer %q, want %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("discovery document is missing an endpoint")
+	}
+
+	ids, err := verifier.New(ctx, verifier.Config{
+		JWKSURL:    meta.JWKSURI,
+		Issuer:     meta.Issuer,
+		Audiences:  []string{p.cfg.ClientID},
+		Leeway:     30 * time.Second,
+		HTTPClient: p.client,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.meta, p.ids = &meta, ids
+	return p.meta, p.ids, nil
+}
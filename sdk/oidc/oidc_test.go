@@ -0,0 +1,279 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/jwk"
+	"auth-as-a-service/sdk/oidc"
+	"auth-as-a-service/sdk/pkce"
+)
+
+const (
+	clientID     = "auth-service"
+	clientSecret = "s3cret/with+symbols"
+	redirectURI  = "https://auth.example/oauth/federated/test/callback"
+)
+
+// provider is a stand-in OpenID Connect provider. It serves discovery, a
+// JWKS and a token endpoint, and issues codes through authorize rather than
+// a sign-in page.
+type provider struct {
+	srv *httptest.Server
+	key ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+	// claims overrides or adds ID token claims for the next exchange.
+	claims jwt.MapClaims
+}
+
+// grant is what a code was issued for.
+type grant struct {
+	nonce     string
+	challenge string
+	redirect  string
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	p := &provider{key: key, codes: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/authorize",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.JWK{p.publicJWK(t)}})
+	})
+	mux.HandleFunc("POST /token", p.token(t))
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *provider) publicJWK(t *testing.T) jwk.JWK {
+	t.Helper()
+	j, err := jwk.FromPublicKey(p.key.Public())
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	j.Alg = "EdDSA"
+	j.Kid = jwk.Thumbprint(j)
+	return j
+}
+
+// authorize plays the user signing in at the provider: it reads the
+// request the relying party redirected to and returns the code the
+// provider would send back.
+func (p *provider) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != clientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != pkce.MethodS256 {
+		t.Fatalf("unexpected authorization request: %s", u.RawQuery)
+	}
+
+	code := rand.Text()
+	p.mu.Lock()
+	p.codes[code] = grant{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), redirect: q.Get("redirect_uri")}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *provider) token(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if id != clientID || secret != clientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		p.mu.Lock()
+		g, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		extra := p.claims
+		p.mu.Unlock()
+		if !ok || g.redirect != r.PostFormValue("redirect_uri") || !pkce.Verify(r.PostFormValue("code_verifier"), g.challenge) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":            p.srv.URL,
+			"sub":            "upstream-user-1",
+			"aud":            clientID,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          g.nonce,
+			"email":          "jane@example.com",
+			"email_verified": true,
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		tok.Header["kid"] = p.publicJWK(t).Kid
+		signed, err := tok.SignedString(p.key)
+		if err != nil {
+			t.Errorf("sign id token: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "upstream", "token_type": "Bearer", "id_token": signed})
+	}
+}
+
+func (p *provider) config() oidc.Config {
+	return oidc.Config{Name: "test", Issuer: p.srv.URL, ClientID: clientID, ClientSecret: clientSecret}
+}
+
+// signIn runs the flow up to the callback and returns what Exchange says.
+func signIn(t *testing.T, p *provider, rp *oidc.Provider, nonce string) (oidc.Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, err := pkce.NewVerifier()
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	authURL, err := rp.AuthCodeURL(ctx, redirectURI, "state-1", "nonce-1", pkce.Challenge(verifier))
+	if err != nil {
+		t.Fatalf("auth code URL: %v", err)
+	}
+	code := p.authorize(t, authURL)
+	return rp.Exchange(ctx, code, verifier, redirectURI, nonce)
+}
+
+func TestExchangeReturnsIdentity(t *testing.T) {
+	p := newProvider(t)
+	rp := oidc.NewProvider(p.config(), nil)
+
+	id, err := signIn(t, p, rp, "nonce-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if id.Subject != "upstream-user-1" || id.Email != "jane@example.com" || !id.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+}
+
+func TestAuthCodeURLCarriesRequest(t *testing.T) {
+	p := newProvider(t)
+	rp := oidc.NewProvider(p.config(), nil)
+
+	authURL, err := rp.AuthCodeURL(context.Background(), redirectURI, "state-1", "nonce-1", "challenge")
+	if err != nil {
+		t.Fatalf("auth code URL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if !strings.HasPrefix(authURL, p.srv.URL+"/authorize?") {
+		t.Errorf("expected the provider's authorization endpoint, got %s", authURL)
+	}
+	if q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" || q.Get("redirect_uri") != redirectURI || q.Get("scope") != "openid email" {
+		t.Errorf("unexpected query: %s", u.RawQuery)
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	p := newProvider(t)
+	rp := oidc.NewProvider(p.config(), nil)
+
+	if _, err := signIn(t, p, rp, "another-nonce"); err == nil {
+		t.Fatal("expected error for mismatched nonce, got nil")
+	}
+}
+
+func TestExchangeRejectsTokenForAnotherClient(t *testing.T) {
+	p := newProvider(t)
+	p.claims = jwt.MapClaims{"aud": "someone-else"}
+	rp := oidc.NewProvider(p.config(), nil)
+
+	if _, err := signIn(t, p, rp, "nonce-1"); err == nil {
+		t.Fatal("expected error for ID token issued to another client, got nil")
+	}
+}
+
+func TestExchangeRejectsExpiredToken(t *testing.T) {
+	p := newProvider(t)
+	p.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+	rp := oidc.NewProvider(p.config(), nil)
+
+	if _, err := signIn(t, p, rp, "nonce-1"); err == nil {
+		t.Fatal("expected error for expired ID token, got nil")
+	}
+}
+
+func TestExchangeRejectsBadCode(t *testing.T) {
+	p := newProvider(t)
+	rp := oidc.NewProvider(p.config(), nil)
+
+	if _, err := rp.Exchange(context.Background(), "made-up", "verifier", redirectURI, "nonce-1"); err == nil {
+		t.Fatal("expected error for unknown code, got nil")
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	p := newProvider(t)
+	cfg := p.config()
+	cfg.Issuer = p.srv.URL + "/"
+	rp := oidc.NewProvider(cfg, nil)
+
+	if _, err := rp.AuthCodeURL(context.Background(), redirectURI, "s", "n", "c"); err == nil {
+		t.Fatal("expected error for discovery document naming another issuer, got nil")
+	}
+}
+
+func TestReadConfigs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+
+	good := write("good.json", `[{"name":"google","issuer":"https://accounts.google.com","client_id":"id","client_secret":"secret"}]`)
+	configs, err := oidc.ReadConfigs(good)
+	if err != nil || len(configs) != 1 || configs[0].Name != "google" {
+		t.Fatalf("expected one google provider, got %+v (%v)", configs, err)
+	}
+
+	for name, content := range map[string]string{
+		"bad-name.json":  `[{"name":"Google!","issuer":"https://a","client_id":"id","client_secret":"s"}]`,
+		"duplicate.json": `[{"name":"a","issuer":"https://a","client_id":"id","client_secret":"s"},{"name":"a","issuer":"https://b","client_id":"id","client_secret":"s"}]`,
+		"no-secret.json": `[{"name":"a","issuer":"https://a","client_id":"id"}]`,
+	} {
+		if _, err := oidc.ReadConfigs(write(name, content)); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
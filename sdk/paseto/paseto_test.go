@@ -0,0 +1,71 @@
+package paseto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vector 4-S-1 from the PASETO specification.
+const (
+	vectorSecretKey = "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	vectorPayload   = `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+	vectorToken     = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+)
+
+func TestSignMatchesSpecVector(t *testing.T) {
+	seed, err := hex.DecodeString(vectorSecretKey)
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	priv := ed25519.PrivateKey(seed)
+
+	if got := Sign(priv, []byte(vectorPayload), nil, nil); got != vectorToken {
+		t.Fatalf("unexpected token:\n got %s\nwant %s", got, vectorToken)
+	}
+
+	payload, err := Verify(priv.Public().(ed25519.PublicKey), vectorToken, nil)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if string(payload) != vectorPayload {
+		t.Errorf("unexpected payload: %s", payload)
+	}
+}
+
+func TestFooterAndImplicitAreAuthenticated(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	footer := []byte(`{"kid":"abc"}`)
+	tok := Sign(priv, []byte(`{"sub":"user-123"}`), footer, []byte("aad"))
+
+	if got, err := Footer(tok); err != nil || !bytes.Equal(got, footer) {
+		t.Fatalf("unexpected footer %q (%v)", got, err)
+	}
+	if _, err := Verify(pub, tok, []byte("aad")); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, err := Verify(pub, tok, []byte("other")); err == nil {
+		t.Fatal("expected error for wrong implicit assertion")
+	}
+
+	forged := tok[:len(tok)-len(b64.EncodeToString(footer))] + b64.EncodeToString([]byte(`{"kid":"xyz"}`))
+	if _, err := Verify(pub, forged, []byte("aad")); err == nil {
+		t.Fatal("expected error for tampered footer")
+	}
+}
+
+func TestRejectsOtherVersions(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	for _, tok := range []string{"v2.public.AAAA", "v4.local.AAAA", "v4.public.!!!", "v4.public.AAAA"} {
+		if _, err := Verify(pub, tok, nil); err == nil {
+			t.Errorf("expected error for %q", tok)
+		}
+	}
+}
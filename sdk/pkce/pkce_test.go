@@ -0,0 +1,41 @@
+package pkce
+
+import "testing"
+
+// The example from RFC 7636 appendix B.
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestChallengeMatchesRFCExample(t *testing.T) {
+	if got := Challenge(rfcVerifier); got != rfcChallenge {
+		t.Fatalf("expected %s, got %s", rfcChallenge, got)
+	}
+	if !ValidChallenge(rfcChallenge) {
+		t.Error("RFC example challenge should be valid")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if !Verify(rfcVerifier, rfcChallenge) {
+		t.Fatal("expected RFC example to verify")
+	}
+
+	v, err := NewVerifier()
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	if !Verify(v, Challenge(v)) {
+		t.Fatal("expected generated verifier to verify")
+	}
+	if Verify(v, rfcChallenge) {
+		t.Error("expected mismatched verifier to fail")
+	}
+	if Verify("too-short", Challenge("too-short")) {
+		t.Error("expected verifier shorter than 43 characters to fail")
+	}
+	if Verify(rfcVerifier+"!", Challenge(rfcVerifier+"!")) {
+		t.Error("expected verifier with a disallowed character to fail")
+	}
+}
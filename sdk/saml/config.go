@@ -0,0 +1,72 @@
+package saml
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// validName keeps IdP names safe to use as a URL path segment.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Config trusts an enterprise's identity provider.
+type Config struct {
+	// Name identifies the IdP in URLs and linked identities, e.g. acme.
+	// Changing it unlinks every user who signed in through it.
+	Name string `json:"name"`
+	// EntityID is the IdP's entity ID, which its responses name as Issuer.
+	EntityID string `json:"entity_id"`
+	// SSOURL is the IdP's single sign-on endpoint for the HTTP-Redirect
+	// binding.
+	SSOURL string `json:"sso_url"`
+	// Certificate is the PEM-encoded certificate the IdP signs with. Keys
+	// sent inside responses are never trusted.
+	Certificate string `json:"certificate"`
+	// EmailAttribute names the attribute holding the user's email address.
+	// Empty uses the NameID when its format is emailAddress.
+	EmailAttribute string `json:"email_attribute,omitempty"`
+	// TrustEmail treats the email addresses the IdP sends as verified, so
+	// they can sign in to existing accounts. Only set it for an IdP that
+	// owns the addresses' domain.
+	TrustEmail bool `json:"trust_email,omitempty"`
+	// Domains and Tenants limit what the IdP vouches for: users with an
+	// email address in one of Domains, in the tenants with slugs in
+	// Tenants. At least one must be set, and Domains must be if
+	// TrustEmail is.
+	Domains []string `json:"domains,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// ReadConfigs reads a JSON array of IdP configurations from path.
+func ReadConfigs(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range configs {
+		if !validName.MatchString(c.Name) {
+			return nil, fmt.Errorf("IdP name %q must be lowercase letters, digits, - and _", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("IdP %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.EntityID == "" || c.SSOURL == "" || c.Certificate == "" {
+			return nil, fmt.Errorf("IdP %s needs an entity_id, sso_url and certificate", c.Name)
+		}
+		if len(c.Domains) == 0 && len(c.Tenants) == 0 {
+			return nil, fmt.Errorf("IdP %s needs domains or tenants", c.Name)
+		}
+		if c.TrustEmail && len(c.Domains) == 0 {
+			return nil, fmt.Errorf("IdP %s trusts emails, so needs domains", c.Name)
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,130 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// XML Signature namespaces and the algorithms verifySignature accepts.
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	// algExcC14N is also the namespace of InclusiveNamespaces.
+	algExcC14N   = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512    = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+)
+
+var digests = map[string]crypto.Hash{
+	algSHA256: crypto.SHA256,
+	algSHA512: crypto.SHA512,
+}
+
+var signatureHashes = map[string]crypto.Hash{
+	algRSASHA256: crypto.SHA256,
+	algRSASHA512: crypto.SHA512,
+}
+
+// errUnsigned is returned for an element without a signature.
+var errUnsigned = errors.New("saml: response is not signed")
+
+// verifySignature checks that e carries an enveloped XML signature over
+// itself made with key. Only what SAML IdPs use is supported: a single
+// reference to e by its ID, the enveloped-signature and exclusive
+// canonicalization transforms, SHA-256 or SHA-512 digests and RSA
+// signatures. SHA-1 is refused. Any key in KeyInfo is ignored.
+//
+// The reference must point at e itself, not at an element found by ID, so
+// a signed element moved elsewhere in the document cannot vouch for an
+// unsigned one put in its place.
+func verifySignature(e *element, key *rsa.PublicKey) error {
+	sigs := e.all(nsDSig, "Signature")
+	switch len(sigs) {
+	case 0:
+		return errUnsigned
+	case 1:
+	default:
+		return errors.New("saml: more than one signature")
+	}
+	sig := sigs[0]
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+
+	inclusive, err := c14nMethod(signedInfo.child(nsDSig, "CanonicalizationMethod"))
+	if err != nil {
+		return err
+	}
+	sigHash, ok := signatureHashes[signedInfo.child(nsDSig, "SignatureMethod").attr("Algorithm")]
+	if !ok {
+		return errors.New("saml: unsupported signature method")
+	}
+
+	refs := signedInfo.all(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return errors.New("saml: signature must have exactly one reference")
+	}
+	ref := refs[0]
+	if id := e.attr("ID"); id == "" || ref.attr("URI") != "#"+id {
+		return errors.New("saml: signature does not reference the signed element")
+	}
+
+	refInclusive, err := transforms(ref.child(nsDSig, "Transforms"))
+	if err != nil {
+		return err
+	}
+	digest, ok := digests[ref.child(nsDSig, "DigestMethod").attr("Algorithm")]
+	if !ok {
+		return errors.New("saml: unsupported digest method")
+	}
+	want, err := decodeBase64(ref.child(nsDSig, "DigestValue").text())
+	if err != nil {
+		return fmt.Errorf("saml: decode digest: %w", err)
+	}
+	h := digest.New()
+	h.Write(canonicalize(e, sig, refInclusive))
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return errors.New("saml: digest mismatch")
+	}
+
+	value, err := decodeBase64(sig.child(nsDSig, "SignatureValue").text())
+	if err != nil {
+		return fmt.Errorf("saml: decode signature: %w", err)
+	}
+	h = sigHash.New()
+	h.Write(canonicalize(signedInfo, nil, inclusive))
+	if err := rsa.VerifyPKCS1v15(key, sigHash, h.Sum(nil), value); err != nil {
+		return errors.New("saml: invalid signature")
+	}
+	return nil
+}
+
+// transforms checks a reference's transforms are enveloped-signature then
+// exclusive canonicalization, and returns the latter's inclusive prefixes.
+func transforms(list *element) ([]string, error) {
+	ts := list.all(nsDSig, "Transform")
+	if len(ts) != 2 || ts[0].attr("Algorithm") != algEnveloped {
+		return nil, errors.New("saml: unsupported reference transforms")
+	}
+	return c14nMethod(ts[1])
+}
+
+// c14nMethod checks m names exclusive canonicalization without comments
+// and returns its InclusiveNamespaces PrefixList.
+func c14nMethod(m *element) ([]string, error) {
+	if m.attr("Algorithm") != algExcC14N {
+		return nil, errors.New("saml: unsupported canonicalization method")
+	}
+	return strings.Fields(m.child(algExcC14N, "InclusiveNamespaces").attr("PrefixList")), nil
+}
+
+// decodeBase64 decodes s, which IdPs often wrap across lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,352 @@
+// Package saml signs users in with enterprise SAML 2.0 identity providers.
+// It is the service provider side of Web Browser SSO: it publishes
+// metadata, sends AuthnRequests over the HTTP-Redirect binding and
+// verifies the signed responses the IdP posts back.
+//
+// Encrypted assertions and IdP-initiated sign-in are not supported: every
+// response must answer a request this service made.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SAML namespaces and identifiers.
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingPOST        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDEmail        = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	nameIDTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+	nameIDPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// clockSkew is how far the IdP's clock may be from ours.
+const clockSkew = time.Minute
+
+// maxResponseSize bounds the encoded SAMLResponse accepted.
+const maxResponseSize = 1 << 20
+
+// ServiceProvider is this service as one IdP knows it.
+type ServiceProvider struct {
+	// EntityID names this service to the IdP.
+	EntityID string
+	// ACSURL is the Assertion Consumer Service the IdP posts responses to.
+	ACSURL string
+}
+
+// Identity is who the IdP says signed in.
+type Identity struct {
+	// Subject is the NameID, the IdP's identifier for the user.
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Assertion is what a verified response says.
+type Assertion struct {
+	// InResponseTo is the ID of the AuthnRequest the response answers.
+	InResponseTo string
+	Identity     Identity
+	// Attributes holds the attribute statements' values by attribute name.
+	Attributes map[string][]string
+}
+
+// IdP is an enterprise identity provider.
+type IdP struct {
+	cfg Config
+	key *rsa.PublicKey
+}
+
+// NewIdP returns an IdP for cfg, whose certificate must hold an RSA key.
+func NewIdP(cfg Config) (*IdP, error) {
+	block, _ := pem.Decode([]byte(cfg.Certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("IdP %s: certificate is not PEM", cfg.Name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("IdP %s: %w", cfg.Name, err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("IdP %s: certificate key is not RSA", cfg.Name)
+	}
+	return &IdP{cfg: cfg, key: key}, nil
+}
+
+// Name identifies the IdP in URLs and linked identities.
+func (p *IdP) Name() string {
+	return p.cfg.Name
+}
+
+// ServesTenant reports whether users of the tenant with slug may sign in
+// through p.
+func (p *IdP) ServesTenant(slug string) bool {
+	return len(p.cfg.Tenants) == 0 || slices.Contains(p.cfg.Tenants, slug)
+}
+
+// AllowsEmail reports whether p may vouch for email, which an IdP limited
+// to domains must send.
+func (p *IdP) AllowsEmail(email string) bool {
+	if len(p.cfg.Domains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(email, "@")
+	return ok && slices.ContainsFunc(p.cfg.Domains, func(d string) bool {
+		return strings.EqualFold(d, domain)
+	})
+}
+
+type metadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SP       struct {
+		AuthnRequestsSigned        bool     `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool     `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string   `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormats              []string `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+		ACS                        struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			Index     int    `xml:"index,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SPSSODescriptor"`
+}
+
+// Metadata returns the SP metadata document to register sp with an IdP.
+func Metadata(sp ServiceProvider) ([]byte, error) {
+	var m metadata
+	m.EntityID = sp.EntityID
+	m.SP.WantAssertionsSigned = true
+	m.SP.ProtocolSupportEnumeration = nsProtocol
+	m.SP.NameIDFormats = []string{nameIDPersistent, nameIDEmail}
+	m.SP.ACS.Binding = bindingPOST
+	m.SP.ACS.Location = sp.ACSURL
+	m.SP.ACS.IsDefault = true
+
+	out, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type authnRequest struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	IssueInstant string   `xml:"IssueInstant,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	ACSURL       string   `xml:"AssertionConsumerServiceURL,attr"`
+	Binding      string   `xml:"ProtocolBinding,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// NewRequestID returns an unguessable AuthnRequest ID. IDs are XML names,
+// which cannot start with a digit.
+func NewRequestID() string {
+	return "_" + rand.Text()
+}
+
+// AuthnRequestURL returns the IdP URL to send the user to, carrying an
+// AuthnRequest with id over the HTTP-Redirect binding. The request is not
+// signed; the response must come back to sp's ACS URL regardless.
+func (p *IdP) AuthnRequestURL(sp ServiceProvider, id string, now time.Time) (string, error) {
+	out, err := xml.Marshal(authnRequest{
+		ID:           id,
+		Version:      "2.0",
+		IssueInstant: now.UTC().Format(time.RFC3339),
+		Destination:  p.cfg.SSOURL,
+		ACSURL:       sp.ACSURL,
+		Binding:      bindingPOST,
+		Issuer:       sp.EntityID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	w.Write(out)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(p.cfg.SSOURL)
+	if err != nil {
+		return "", fmt.Errorf("parse sso_url: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ParseResponse verifies the SAMLResponse form value the IdP posted to sp
+// and returns its assertion. The response must hold exactly one
+// assertion, signed by the IdP's certificate either itself or as part of
+// a signed response, issued for sp's entity ID and ACS URL and valid at
+// now. The caller must check InResponseTo names a request it made, and
+// accept each only once.
+func (p *IdP) ParseResponse(sp ServiceProvider, samlResponse string, now time.Time) (*Assertion, error) {
+	if len(samlResponse) > maxResponseSize {
+		return nil, errors.New("saml: response too large")
+	}
+	data, err := decodeBase64(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("saml: decode response: %w", err)
+	}
+	resp, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.is(nsProtocol, "Response") || resp.attr("Version") != "2.0" {
+		return nil, errors.New("saml: not a SAML 2.0 response")
+	}
+	if status := resp.child(nsProtocol, "Status").child(nsProtocol, "StatusCode").attr("Value"); status != statusSuccess {
+		return nil, fmt.Errorf("saml: IdP returned status %s", status)
+	}
+	if len(resp.all(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("saml: encrypted assertions are not supported")
+	}
+	assertions := resp.all(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("saml: response must hold exactly one assertion")
+	}
+	a := assertions[0]
+
+	// A signature on the response covers the assertion inside it.
+	signed := resp
+	if resp.child(nsDSig, "Signature") == nil {
+		signed = a
+	}
+	if err := verifySignature(signed, p.key); err != nil {
+		return nil, err
+	}
+
+	// Only now is the document trusted, and only below signed.
+	if signed == resp {
+		if d := resp.attr("Destination"); d != "" && d != sp.ACSURL {
+			return nil, errors.New("saml: response is for another destination")
+		}
+	}
+	return p.readAssertion(sp, a, resp.attr("InResponseTo"), now)
+}
+
+// readAssertion checks a verified assertion's issuer, subject
+// confirmation and conditions and reads the identity from it.
+func (p *IdP) readAssertion(sp ServiceProvider, a *element, inResponseTo string, now time.Time) (*Assertion, error) {
+	if a.attr("Version") != "2.0" || a.child(nsAssertion, "Issuer").text() != p.cfg.EntityID {
+		return nil, errors.New("saml: assertion is from another issuer")
+	}
+
+	subject := a.child(nsAssertion, "Subject")
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID.text() == "" {
+		return nil, errors.New("saml: assertion has no NameID")
+	}
+	if nameID.attr("Format") == nameIDTransient {
+		return nil, errors.New("saml: a transient NameID cannot identify a returning user")
+	}
+
+	// Bearer confirmation ties the assertion to this ACS and to the request
+	// it answers (SAML 2.0 Profiles section 4.1.4.2).
+	var confirmed string
+	for _, sc := range subject.all(nsAssertion, "SubjectConfirmation") {
+		data := sc.child(nsAssertion, "SubjectConfirmationData")
+		if sc.attr("Method") != confirmationBearer || data.attr("Recipient") != sp.ACSURL {
+			continue
+		}
+		if expires, err := time.Parse(time.RFC3339, data.attr("NotOnOrAfter")); err != nil || !now.Before(expires.Add(clockSkew)) {
+			continue
+		}
+		if id := data.attr("InResponseTo"); id != "" && (inResponseTo == "" || id == inResponseTo) {
+			confirmed = id
+			break
+		}
+	}
+	if confirmed == "" {
+		return nil, errors.New("saml: assertion has no bearer confirmation for this request")
+	}
+
+	if err := checkConditions(a.child(nsAssertion, "Conditions"), sp, now); err != nil {
+		return nil, err
+	}
+
+	attrs := map[string][]string{}
+	for _, st := range a.all(nsAssertion, "AttributeStatement") {
+		for _, at := range st.all(nsAssertion, "Attribute") {
+			for _, v := range at.all(nsAssertion, "AttributeValue") {
+				attrs[at.attr("Name")] = append(attrs[at.attr("Name")], v.text())
+			}
+		}
+	}
+
+	id := Identity{Subject: nameID.text()}
+	switch {
+	case p.cfg.EmailAttribute != "":
+		if v := attrs[p.cfg.EmailAttribute]; len(v) > 0 {
+			id.Email = v[0]
+		}
+	case nameID.attr("Format") == nameIDEmail:
+		id.Email = nameID.text()
+	}
+	id.EmailVerified = id.Email != "" && p.cfg.TrustEmail
+
+	return &Assertion{InResponseTo: confirmed, Identity: id, Attributes: attrs}, nil
+}
+
+// checkConditions checks the assertion is valid at now and names sp in
+// every audience restriction, of which there must be at least one.
+func checkConditions(c *element, sp ServiceProvider, now time.Time) error {
+	if c == nil {
+		return errors.New("saml: assertion has no conditions")
+	}
+	if v := c.attr("NotBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || now.Add(clockSkew).Before(t) {
+			return errors.New("saml: assertion is not yet valid")
+		}
+	}
+	if v := c.attr("NotOnOrAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !now.Before(t.Add(clockSkew)) {
+			return errors.New("saml: assertion has expired")
+		}
+	}
+
+	restrictions := c.all(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("saml: assertion has no audience restriction")
+	}
+	for _, r := range restrictions {
+		var audiences []string
+		for _, a := range r.all(nsAssertion, "Audience") {
+			audiences = append(audiences, a.text())
+		}
+		if !slices.Contains(audiences, sp.EntityID) {
+			return errors.New("saml: assertion is for another audience")
+		}
+	}
+	return nil
+}
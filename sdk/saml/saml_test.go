@@ -0,0 +1,420 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var sp = ServiceProvider{
+	EntityID: "https://auth.example/auth/saml/acme/metadata",
+	ACSURL:   "https://auth.example/auth/saml/acme/acs",
+}
+
+const idpEntityID = "https://idp.acme.example"
+
+// fakeIdP signs responses with a test key, as an enterprise IdP would.
+type fakeIdP struct {
+	key  *rsa.PrivateKey
+	cert string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.acme.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return &fakeIdP{key: key, cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func (f *fakeIdP) idp(t *testing.T, cfg Config) *IdP {
+	t.Helper()
+	cfg.Name, cfg.EntityID, cfg.SSOURL, cfg.Certificate = "acme", idpEntityID, "https://idp.acme.example/sso", f.cert
+	p, err := NewIdP(cfg)
+	if err != nil {
+		t.Fatalf("new IdP: %v", err)
+	}
+	return p
+}
+
+// assertion describes the response the fake IdP sends.
+type assertion struct {
+	requestID string
+	nameID    string
+	format    string
+	audience  string
+	recipient string
+	expires   time.Time
+	email     string
+}
+
+func validAssertion() assertion {
+	return assertion{
+		requestID: "_req1",
+		nameID:    "00u1abcd",
+		format:    nameIDPersistent,
+		audience:  sp.EntityID,
+		recipient: sp.ACSURL,
+		expires:   time.Now().Add(5 * time.Minute),
+		email:     "jane@acme.example",
+	}
+}
+
+// responseXML renders a response holding a, with {{sig}} where the
+// assertion's signature goes.
+func responseXML(a assertion) string {
+	exp := a.expires.UTC().Format(time.RFC3339)
+	now := time.Now().UTC().Format(time.RFC3339)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_resp1" Version="2.0" IssueInstant="` + now + `" Destination="` + sp.ACSURL + `" InResponseTo="` + a.requestID + `">
+  <saml:Issuer>` + idpEntityID + `</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  <saml:Assertion xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="_a1" Version="2.0" IssueInstant="` + now + `">
+    <saml:Issuer>` + idpEntityID + `</saml:Issuer>{{sig}}
+    <saml:Subject>
+      <saml:NameID Format="` + a.format + `">` + a.nameID + `</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="` + a.requestID + `" NotOnOrAfter="` + exp + `" Recipient="` + a.recipient + `"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="` + now + `" NotOnOrAfter="` + exp + `">
+      <saml:AudienceRestriction><saml:Audience>` + a.audience + `</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="email"><saml:AttributeValue xsi:type="xs:string">` + a.email + `</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="groups"><saml:AttributeValue xsi:type="xs:string">eng</saml:AttributeValue><saml:AttributeValue xsi:type="xs:string">admins &amp; ops</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+}
+
+// sign signs the element with ID id in doc and puts the signature where
+// {{sig}} is.
+func (f *fakeIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+	root, err := parse([]byte(strings.Replace(doc, "{{sig}}", "", 1)))
+	if err != nil {
+		t.Fatalf("parse unsigned: %v", err)
+	}
+	el := find(root, id)
+	if el == nil {
+		t.Fatalf("no element with ID %s", id)
+	}
+	digest := sha256.Sum256(canonicalize(el, nil, []string{"xs"}))
+
+	signedInfo := `<ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	sigOpen := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`
+
+	si, err := parse([]byte(sigOpen + signedInfo + `</ds:Signature>`))
+	if err != nil {
+		t.Fatalf("parse signature: %v", err)
+	}
+	sum := sha256.Sum256(canonicalize(si.children[0].el, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	// Wrapped as IdPs do, to check line breaks are tolerated.
+	encoded := base64.StdEncoding.EncodeToString(value)
+	wrapped := encoded[:40] + "\n" + encoded[40:]
+	return strings.Replace(doc, "{{sig}}", sigOpen+signedInfo+`<ds:SignatureValue>`+wrapped+`</ds:SignatureValue></ds:Signature>`, 1)
+}
+
+func find(e *element, id string) *element {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, n := range e.children {
+		if n.el != nil {
+			if found := find(n.el, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func encode(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func TestParseResponseReturnsIdentity(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.idp(t, Config{EmailAttribute: "email", TrustEmail: true})
+
+	a, err := p.ParseResponse(sp, encode(f.sign(t, responseXML(validAssertion()), "_a1")), time.Now())
+	if err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	want := Identity{Subject: "00u1abcd", Email: "jane@acme.example", EmailVerified: true}
+	if a.Identity != want || a.InResponseTo != "_req1" {
+		t.Fatalf("expected %+v answering _req1, got %+v answering %s", want, a.Identity, a.InResponseTo)
+	}
+	if g := a.Attributes["groups"]; len(g) != 2 || g[1] != "admins & ops" {
+		t.Errorf("unexpected groups: %q", g)
+	}
+}
+
+func TestParseResponseEmailFromNameID(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.idp(t, Config{})
+	a := validAssertion()
+	a.nameID, a.format = "jane@acme.example", nameIDEmail
+
+	got, err := p.ParseResponse(sp, encode(f.sign(t, responseXML(a), "_a1")), time.Now())
+	if err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if got.Identity.Email != "jane@acme.example" || got.Identity.EmailVerified {
+		t.Fatalf("expected an unverified email from the NameID, got %+v", got.Identity)
+	}
+}
+
+func TestParseResponseAcceptsSignedResponse(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.idp(t, Config{})
+	doc := strings.Replace(responseXML(validAssertion()), "{{sig}}", "", 1)
+	doc = strings.Replace(doc, "</saml:Issuer>", "</saml:Issuer>{{sig}}", 1)
+
+	if _, err := p.ParseResponse(sp, encode(f.sign(t, doc, "_resp1")), time.Now()); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+}
+
+func TestParseResponseRejects(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.idp(t, Config{})
+	signed := func(a assertion) string { return f.sign(t, responseXML(a), "_a1") }
+
+	tests := map[string]string{
+		"unsigned": strings.Replace(responseXML(validAssertion()), "{{sig}}", "", 1),
+		"tampered": strings.Replace(signed(validAssertion()), "00u1abcd", "00u1evil", 1),
+		"expired": signed(func() assertion {
+			a := validAssertion()
+			a.expires = time.Now().Add(-5 * time.Minute)
+			return a
+		}()),
+		"other audience": signed(func() assertion {
+			a := validAssertion()
+			a.audience = "https://other.example"
+			return a
+		}()),
+		"other recipient": signed(func() assertion {
+			a := validAssertion()
+			a.recipient = "https://other.example/acs"
+			return a
+		}()),
+		"transient": signed(func() assertion {
+			a := validAssertion()
+			a.format = nameIDTransient
+			return a
+		}()),
+		"other key": newFakeIdP(t).sign(t, responseXML(validAssertion()), "_a1"),
+		// The signed assertion moved out of the way and an unsigned one,
+		// with the same ID, put where it is read from.
+		"wrapped": func() string {
+			s := signed(validAssertion())
+			start := strings.Index(s, "<saml:Assertion")
+			end := strings.Index(s, "</saml:Assertion>") + len("</saml:Assertion>")
+			original := s[start:end]
+			forged := strings.Replace(strings.Replace(responseXML(validAssertion()), "{{sig}}", "", 1), "00u1abcd", "00u1evil", 1)
+			forged = forged[strings.Index(forged, "<saml:Assertion") : strings.Index(forged, "</saml:Assertion>")+len("</saml:Assertion>")]
+			return strings.Replace(s, original, forged+"<samlp:Extensions>"+original+"</samlp:Extensions>", 1)
+		}(),
+		"two assertions": func() string {
+			s := signed(validAssertion())
+			start := strings.Index(s, "<saml:Assertion")
+			end := strings.Index(s, "</saml:Assertion>") + len("</saml:Assertion>")
+			return s[:end] + s[start:end] + s[end:]
+		}(),
+		"dtd": `<?xml version="1.0"?><!DOCTYPE r [<!ENTITY x "y">]>` + signed(validAssertion())[strings.Index(signed(validAssertion()), "<samlp:Response"):],
+	}
+	for name, doc := range tests {
+		if _, err := p.ParseResponse(sp, encode(doc), time.Now()); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.idp(t, Config{})
+
+	u, err := p.AuthnRequestURL(sp, "_req1", time.Now())
+	if err != nil {
+		t.Fatalf("authn request URL: %v", err)
+	}
+	parsed, _ := url.Parse(u)
+	raw, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("decode SAMLRequest: %v", err)
+	}
+	inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("inflate SAMLRequest: %v", err)
+	}
+	req, err := parse(inflated)
+	if err != nil {
+		t.Fatalf("parse AuthnRequest: %v", err)
+	}
+	if !req.is(nsProtocol, "AuthnRequest") || req.attr("ID") != "_req1" || req.attr("AssertionConsumerServiceURL") != sp.ACSURL {
+		t.Errorf("unexpected AuthnRequest: %s", inflated)
+	}
+	if got := req.child(nsAssertion, "Issuer").text(); got != sp.EntityID {
+		t.Errorf("expected issuer %s, got %s", sp.EntityID, got)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	out, err := Metadata(sp)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	doc, err := parse(out)
+	if err != nil {
+		t.Fatalf("parse metadata: %v", err)
+	}
+	acs := doc.child(nsMetadata, "SPSSODescriptor").child(nsMetadata, "AssertionConsumerService")
+	if doc.attr("entityID") != sp.EntityID || acs.attr("Location") != sp.ACSURL || acs.attr("Binding") != bindingPOST {
+		t.Errorf("unexpected metadata: %s", out)
+	}
+}
+
+// The expected forms follow the examples in the Exclusive XML
+// Canonicalization and Canonical XML recommendations.
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		inclusive []string
+		want      string
+	}{
+		{
+			name: "attributes sorted, empty elements expanded, escapes normalised",
+			doc:  `<doc xmlns:b="http://b" b:y="1" a="x &gt; y" x="2"><e/>t&#x3E;&#13;</doc>`,
+			want: `<doc xmlns:b="http://b" a="x > y" x="2" b:y="1"><e></e>t&gt;&#xD;</doc>`,
+		},
+		{
+			name: "unused namespaces dropped, used ones pushed down",
+			doc:  `<n0:pdu xmlns:n0="http://a.example" xmlns:n1="http://b.example"><n1:elem2 xml:lang="en"><n1:inner/></n1:elem2></n0:pdu>`,
+			want: `<n0:pdu xmlns:n0="http://a.example"><n1:elem2 xmlns:n1="http://b.example" xml:lang="en"><n1:inner></n1:inner></n1:elem2></n0:pdu>`,
+		},
+		{
+			name:      "inclusive prefixes kept",
+			doc:       `<a:r xmlns:a="http://a" xmlns:xs="http://xs"><a:v>xs:string</a:v></a:r>`,
+			inclusive: []string{"xs"},
+			want:      `<a:r xmlns:a="http://a" xmlns:xs="http://xs"><a:v>xs:string</a:v></a:r>`,
+		},
+		{
+			name: "default namespace undeclared",
+			doc:  `<r xmlns="http://r"><c xmlns=""/></r>`,
+			want: `<r xmlns="http://r"><c xmlns=""></c></r>`,
+		},
+		{
+			name: "comments dropped",
+			doc:  `<r>jane@example.com<!-- x -->.evil</r>`,
+			want: `<r>jane@example.com.evil</r>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := parse([]byte(tt.doc))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.name, err)
+		}
+		if got := string(canonicalize(doc, nil, tt.inclusive)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeSubtreeTakesAncestorNamespaces(t *testing.T) {
+	doc, err := parse([]byte(`<p:r xmlns:p="http://p" xmlns:q="http://q"><p:c q:a="1"/></p:r>`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	got := string(canonicalize(doc.children[0].el, nil, nil))
+	if want := `<p:c xmlns:p="http://p" xmlns:q="http://q" q:a="1"></p:c>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestReadConfigsRejectsDuplicates(t *testing.T) {
+	path := t.TempDir() + "/idps.json"
+	c := `{"name":"acme","entity_id":"e","sso_url":"https://s","certificate":"c","tenants":["acme"]}`
+	if err := os.WriteFile(path, fmt.Appendf(nil, "[%s,%s]", c, c), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadConfigs(path); err == nil {
+		t.Fatal("expected error for duplicate IdP, got nil")
+	}
+}
+
+func TestReadConfigsRequiresScope(t *testing.T) {
+	for name, c := range map[string]string{
+		"unscoped":               `{"name":"acme","entity_id":"e","sso_url":"https://s","certificate":"c"}`,
+		"trusted without domain": `{"name":"acme","entity_id":"e","sso_url":"https://s","certificate":"c","tenants":["acme"],"trust_email":true}`,
+	} {
+		path := t.TempDir() + "/idps.json"
+		if err := os.WriteFile(path, fmt.Appendf(nil, "[%s]", c), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadConfigs(path); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestIdPScope(t *testing.T) {
+	p := &IdP{cfg: Config{Domains: []string{"acme.example"}, Tenants: []string{"acme"}}}
+	if !p.ServesTenant("acme") || p.ServesTenant("globex") {
+		t.Error("expected the IdP to serve acme only")
+	}
+	for email, want := range map[string]bool{
+		"jane@acme.example":  true,
+		"jane@ACME.example":  true,
+		"ceo@globex.example": false,
+		"acme.example":       false,
+		"":                   false,
+	} {
+		if got := p.AllowsEmail(email); got != want {
+			t.Errorf("AllowsEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+
+	unscoped := &IdP{cfg: Config{Tenants: []string{"acme"}}}
+	if !unscoped.AllowsEmail("ceo@globex.example") {
+		t.Error("expected an IdP without domains to allow any email")
+	}
+}
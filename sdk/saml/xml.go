@@ -0,0 +1,331 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// element is a parsed XML element. Prefixes are kept as written, unlike
+// with encoding/xml's Decoder.Token, because canonicalization has to
+// reproduce them. Comments and processing instructions are dropped.
+type element struct {
+	parent *element
+	prefix string
+	local  string
+	// ns holds the namespaces declared on the element, by prefix, with ""
+	// for the default namespace.
+	ns       map[string]string
+	attrs    []attr
+	children []node
+}
+
+type attr struct {
+	prefix, local, value string
+}
+
+// node is a child of an element: either el or text.
+type node struct {
+	el   *element
+	text string
+}
+
+// parse reads a document into a tree. Documents with a DTD are refused.
+func parse(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{parent: cur, prefix: t.Name.Space, local: t.Name.Local}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.declare("", a.Value)
+				case a.Name.Space == "xmlns":
+					e.declare(a.Name.Local, a.Value)
+				default:
+					e.attrs = append(e.attrs, attr{a.Name.Space, a.Name.Local, a.Value})
+				}
+			}
+			if err := e.checkPrefixes(); err != nil {
+				return nil, err
+			}
+			if cur != nil {
+				cur.children = append(cur.children, node{el: e})
+			} else if root != nil {
+				return nil, errors.New("xml: more than one root element")
+			} else {
+				root = e
+			}
+			cur = e
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.local {
+				return nil, fmt.Errorf("xml: unexpected end element %s", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, node{text: string(t)})
+			}
+		case xml.Directive:
+			return nil, errors.New("xml: DTDs are not allowed")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("xml: incomplete document")
+	}
+	return root, nil
+}
+
+func (e *element) declare(prefix, uri string) {
+	if e.ns == nil {
+		e.ns = map[string]string{}
+	}
+	e.ns[prefix] = uri
+}
+
+func (e *element) checkPrefixes() error {
+	if _, ok := e.lookup(e.prefix); !ok {
+		return fmt.Errorf("xml: undeclared prefix %s", e.prefix)
+	}
+	for _, a := range e.attrs {
+		if _, ok := e.lookup(a.prefix); a.prefix != "" && !ok {
+			return fmt.Errorf("xml: undeclared prefix %s", a.prefix)
+		}
+	}
+	return nil
+}
+
+// lookup returns the namespace prefix is bound to in e's scope.
+func (e *element) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for ; e != nil; e = e.parent {
+		if uri, ok := e.ns[prefix]; ok {
+			return uri, true
+		}
+	}
+	// Without a declaration, the default namespace is no namespace.
+	return "", prefix == ""
+}
+
+// is reports whether e is the element local in namespace space.
+func (e *element) is(space, local string) bool {
+	if e == nil || e.local != local {
+		return false
+	}
+	uri, _ := e.lookup(e.prefix)
+	return uri == space
+}
+
+// attr returns the value of e's unprefixed attribute local.
+func (e *element) attr(local string) string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.attrs {
+		if a.prefix == "" && a.local == local {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// child returns e's first child element local in namespace space. Like
+// the other accessors, it is safe to call on nil, so lookups chain.
+func (e *element) child(space, local string) *element {
+	if all := e.all(space, local); len(all) > 0 {
+		return all[0]
+	}
+	return nil
+}
+
+// all returns e's child elements local in namespace space.
+func (e *element) all(space, local string) []*element {
+	if e == nil {
+		return nil
+	}
+	var found []*element
+	for _, n := range e.children {
+		if n.el.is(space, local) {
+			found = append(found, n.el)
+		}
+	}
+	return found
+}
+
+// text returns the character data directly inside e, trimmed. Text split
+// by a comment is joined up again, as canonicalization sees it.
+func (e *element) text() string {
+	if e == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, n := range e.children {
+		if n.el == nil {
+			b.WriteString(n.text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// canonicalize returns the Exclusive XML Canonicalization 1.0 form,
+// without comments, of e less the subtree skip. inclusive is the
+// InclusiveNamespaces PrefixList, with #default for the default
+// namespace.
+func canonicalize(e, skip *element, inclusive []string) []byte {
+	c := canonicalizer{skip: skip, inclusive: inclusive}
+	c.element(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       bytes.Buffer
+	skip      *element
+	inclusive []string
+}
+
+// element writes e. rendered holds the namespaces already declared by
+// output ancestors, by prefix.
+func (c *canonicalizer) element(e *element, rendered map[string]string) {
+	// Exclusive canonicalization declares only the namespaces an element
+	// visibly uses, plus the inclusive ones, where the output does not
+	// already have them.
+	used := []string{e.prefix}
+	for _, a := range e.attrs {
+		if a.prefix != "" && a.prefix != "xml" {
+			used = append(used, a.prefix)
+		}
+	}
+	for _, p := range c.inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		if _, ok := e.lookup(p); ok {
+			used = append(used, p)
+		}
+	}
+	slices.Sort(used)
+	used = slices.Compact(used)
+
+	// The default namespace sorts first, as the specification requires.
+	var decls []string
+	for _, p := range used {
+		uri, _ := e.lookup(p)
+		if rendered[p] != uri {
+			decls = append(decls, p)
+		}
+	}
+	if len(decls) > 0 {
+		rendered = maps.Clone(rendered)
+	}
+
+	c.buf.WriteByte('<')
+	c.buf.WriteString(qname(e.prefix, e.local))
+	for _, p := range decls {
+		uri, _ := e.lookup(p)
+		rendered[p] = uri
+		c.buf.WriteString(" " + qname("xmlns", p) + `="`)
+		escapeAttr(&c.buf, uri)
+		c.buf.WriteByte('"')
+	}
+
+	attrs := slices.Clone(e.attrs)
+	slices.SortFunc(attrs, func(a, b attr) int {
+		ua, _ := e.lookup(a.prefix)
+		ub, _ := e.lookup(b.prefix)
+		if a.prefix == "" {
+			ua = ""
+		}
+		if b.prefix == "" {
+			ub = ""
+		}
+		if d := strings.Compare(ua, ub); d != 0 {
+			return d
+		}
+		return strings.Compare(a.local, b.local)
+	})
+	for _, a := range attrs {
+		c.buf.WriteString(" " + qname(a.prefix, a.local) + `="`)
+		escapeAttr(&c.buf, a.value)
+		c.buf.WriteByte('"')
+	}
+	c.buf.WriteByte('>')
+
+	for _, n := range e.children {
+		switch {
+		case n.el == nil:
+			escapeText(&c.buf, n.text)
+		case n.el != c.skip:
+			c.element(n.el, rendered)
+		}
+	}
+	c.buf.WriteString("</" + qname(e.prefix, e.local) + ">")
+}
+
+// qname joins prefix and local, or returns prefix alone for an xmlns
+// declaration of the default namespace.
+func qname(prefix, local string) string {
+	switch {
+	case prefix == "":
+		return local
+	case local == "":
+		return prefix
+	}
+	return prefix + ":" + local
+}
+
+func escapeText(b *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func escapeAttr(b *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\t':
+			b.WriteString("&#x9;")
+		case '\n':
+			b.WriteString("&#xA;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package token
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the token_type claim.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// Claims are the contents of a token we issue.
+type Claims struct {
+	Subject   string
+	ID        string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	TokenType string
+	// Family is the refresh token family the token belongs to, if any.
+	Family string
+	// Tenant is the user pool the subject belongs to. Set by the Issuer.
+	Tenant string
+	Scopes []string
+	Roles  []string
+	// KeyThumbprint binds the token to a DPoP key (the cnf.jkt claim). A
+	// bound token is only accepted alongside a proof signed by that key.
+	KeyThumbprint string
+	// Actor is the party acting on the subject's behalf in a token issued by
+	// token exchange (the act claim, RFC 8693 section 4.1).
+	Actor *Actor
+	// Custom holds any other claims. Registered names above take precedence.
+	Custom map[string]any
+}
+
+// Actor identifies who is acting for a token's subject. Actor is the
+// party that was acting before this one, if the token was exchanged again.
+type Actor struct {
+	Subject string
+	Actor   *Actor
+}
+
+func (a *Actor) toMap() map[string]any {
+	m := map[string]any{"sub": a.Subject}
+	if a.Actor != nil {
+		m["act"] = a.Actor.toMap()
+	}
+	return m
+}
+
+func actorFromMap(raw any) (*Actor, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("act claim must be an object")
+	}
+	a := &Actor{}
+	if a.Subject, ok = m["sub"].(string); !ok || a.Subject == "" {
+		return nil, fmt.Errorf("act claim needs a sub")
+	}
+	if prior, ok := m["act"]; ok {
+		var err error
+		if a.Actor, err = actorFromMap(prior); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// HasRole reports whether the token carries role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "token_type", "fam", "tenant", "scope", "roles", "cnf", "act"}
+
+// numericDate writes t as seconds with a microsecond fraction. iat carries
+// one so that a token issued just after RevokeUser is told apart from one
+// issued just before it in the same second.
+func numericDate(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+func fromNumericDate(f float64) time.Time {
+	return time.UnixMicro(int64(math.Round(f * 1e6)))
+}
+
+func (c *Claims) toMap() jwt.MapClaims {
+	m := jwt.MapClaims{}
+	for k, v := range c.Custom {
+		m[k] = v
+	}
+	for _, k := range registeredClaims {
+		delete(m, k)
+	}
+
+	m["iss"] = c.Issuer
+	m["sub"] = c.Subject
+	m["jti"] = c.ID
+	m["exp"] = c.ExpiresAt.Unix()
+	m["iat"] = numericDate(c.IssuedAt)
+	m["token_type"] = c.TokenType
+	// A single audience is written as a string, as most verifiers expect.
+	switch len(c.Audience) {
+	case 0:
+	case 1:
+		m["aud"] = c.Audience[0]
+	default:
+		m["aud"] = c.Audience
+	}
+	if c.Family != "" {
+		m["fam"] = c.Family
+	}
+	if c.Tenant != "" {
+		m["tenant"] = c.Tenant
+	}
+	if len(c.Scopes) > 0 {
+		m["scope"] = strings.Join(c.Scopes, " ")
+	}
+	if len(c.Roles) > 0 {
+		m["roles"] = c.Roles
+	}
+	if c.KeyThumbprint != "" {
+		m["cnf"] = map[string]any{"jkt": c.KeyThumbprint}
+	}
+	if c.Actor != nil {
+		m["act"] = c.Actor.toMap()
+	}
+	return m
+}
+
+func claimsFromMap(m jwt.MapClaims) (*Claims, error) {
+	c := &Claims{}
+	c.Issuer, _ = m["iss"].(string)
+	c.Subject, _ = m["sub"].(string)
+	c.ID, _ = m["jti"].(string)
+	c.TokenType, _ = m["token_type"].(string)
+	c.Family, _ = m["fam"].(string)
+	c.Tenant, _ = m["tenant"].(string)
+
+	aud, err := m.GetAudience()
+	if err != nil {
+		return nil, err
+	}
+	c.Audience = aud
+	if exp, err := m.GetExpirationTime(); err != nil {
+		return nil, err
+	} else if exp != nil {
+		c.ExpiresAt = exp.Time
+	}
+	if iat, err := m.GetIssuedAt(); err != nil {
+		return nil, err
+	} else if iat != nil {
+		c.IssuedAt = iat.Time
+	}
+	// NumericDates parse to whole seconds; keep iat's fraction.
+	if f, ok := m["iat"].(float64); ok {
+		c.IssuedAt = fromNumericDate(f)
+	}
+
+	if scope, _ := m["scope"].(string); scope != "" {
+		c.Scopes = strings.Fields(scope)
+	}
+	if raw, ok := m["roles"]; ok {
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("roles claim must be an array")
+		}
+		for _, r := range list {
+			s, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("roles claim must contain strings")
+			}
+			c.Roles = append(c.Roles, s)
+		}
+	}
+
+	if raw, ok := m["cnf"]; ok {
+		cnf, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cnf claim must be an object")
+		}
+		c.KeyThumbprint, _ = cnf["jkt"].(string)
+	}
+	if raw, ok := m["act"]; ok {
+		if c.Actor, err = actorFromMap(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range m {
+		if !slices.Contains(registeredClaims, k) {
+			if c.Custom == nil {
+				c.Custom = map[string]any{}
+			}
+			c.Custom[k] = v
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,118 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAudienceNotAllowed is returned for audiences outside Config.Audiences.
+var ErrAudienceNotAllowed = errors.New("audience not allowed")
+
+// Token formats an Issuer can produce. A Verifier accepts all of them, so
+// changing the format does not invalidate tokens already issued.
+const (
+	FormatJWT    = "jwt"
+	FormatPASETO = "paseto"
+	// FormatOpaque issues random reference tokens whose claims live in the
+	// cache. Holders cannot read them and they cannot be verified offline.
+	FormatOpaque = "opaque"
+)
+
+// Config is what an Issuer and Verifier need to mint and check tokens.
+type Config struct {
+	// Keys signs new tokens and verifies presented ones.
+	Keys *KeyRing
+	// Issuer is written to and required in the iss claim.
+	Issuer string
+	// Audiences lists the audiences tokens may be issued for and are
+	// accepted with. The first entry is the default. Empty means Issuer alone.
+	Audiences  []string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// ExchangeTTL caps the lifetime of tokens issued by token exchange,
+	// which act for someone else and so should not outlive their purpose.
+	ExchangeTTL time.Duration
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+	// Format is FormatJWT, FormatPASETO or FormatOpaque. It only affects issuing.
+	Format string
+	// Tenant, if set, is written to and required in the tenant claim, so a
+	// token issued for one tenant is never accepted by another's Verifier.
+	Tenant string
+}
+
+// ConfigFromEnv reads lifetimes, issuer, audiences and leeway from the
+// environment. Keys is left for the caller to fill in.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Issuer:      "auth-as-a-service",
+		AccessTTL:   24 * time.Hour,
+		RefreshTTL:  30 * 24 * time.Hour,
+		ExchangeTTL: 15 * time.Minute,
+		Leeway:      30 * time.Second,
+		Format:      FormatJWT,
+	}
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		cfg.Issuer = iss
+	}
+	for _, a := range strings.Split(os.Getenv("JWT_AUDIENCES"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.Audiences = append(cfg.Audiences, a)
+		}
+	}
+	if h, err := strconv.Atoi(os.Getenv("JWT_EXPIRY_HOURS")); err == nil && h > 0 {
+		cfg.AccessTTL = time.Duration(h) * time.Hour
+	}
+	if d, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_EXPIRY_DAYS")); err == nil && d > 0 {
+		cfg.RefreshTTL = time.Duration(d) * 24 * time.Hour
+	}
+	if m, err := strconv.Atoi(os.Getenv("TOKEN_EXCHANGE_EXPIRY_MINUTES")); err == nil && m > 0 {
+		cfg.ExchangeTTL = time.Duration(m) * time.Minute
+	}
+	if f := os.Getenv("TOKEN_FORMAT"); f != "" {
+		cfg.Format = f
+	}
+	if s, err := strconv.Atoi(os.Getenv("JWT_LEEWAY_SECONDS")); err == nil && s >= 0 {
+		cfg.Leeway = time.Duration(s) * time.Second
+	}
+	return cfg
+}
+
+// MaxLifetime is the longest any issued token stays valid. A key leaving
+// the current slot must keep verifying for at least this long.
+func (c Config) MaxLifetime() time.Duration {
+	return max(c.AccessTTL, c.RefreshTTL)
+}
+
+// ExchangeLifetime is how long a token issued by token exchange lives:
+// ExchangeTTL, but never longer than an ordinary access token.
+func (c Config) ExchangeLifetime() time.Duration {
+	if c.ExchangeTTL > 0 {
+		return min(c.AccessTTL, c.ExchangeTTL)
+	}
+	return c.AccessTTL
+}
+
+// ResolveAudience returns the audience a token should be issued for. An
+// empty request selects the default, the first allowed audience.
+func (c Config) ResolveAudience(requested string) (string, error) {
+	allowed := c.audiences()
+	if requested == "" {
+		return allowed[0], nil
+	}
+	if !slices.Contains(allowed, requested) {
+		return "", ErrAudienceNotAllowed
+	}
+	return requested, nil
+}
+
+func (c Config) audiences() []string {
+	if len(c.Audiences) == 0 {
+		return []string{c.Issuer}
+	}
+	return c.Audiences
+}
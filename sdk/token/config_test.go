@@ -0,0 +1,95 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestResolveAudience(t *testing.T) {
+	if aud, err := testConfig.ResolveAudience(""); err != nil || aud != "api" {
+		t.Errorf("expected default audience api, got %q (%v)", aud, err)
+	}
+	if aud, err := testConfig.ResolveAudience("admin"); err != nil || aud != "admin" {
+		t.Errorf("expected admin, got %q (%v)", aud, err)
+	}
+	if _, err := testConfig.ResolveAudience("billing"); !errors.Is(err, token.ErrAudienceNotAllowed) {
+		t.Errorf("expected ErrAudienceNotAllowed, got %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("JWT_ISSUER", "https://auth.example")
+	t.Setenv("JWT_AUDIENCES", " api , ,admin")
+	t.Setenv("JWT_EXPIRY_HOURS", "2")
+	t.Setenv("REFRESH_TOKEN_EXPIRY_DAYS", "7")
+	t.Setenv("JWT_LEEWAY_SECONDS", "0")
+
+	cfg := token.ConfigFromEnv()
+	if cfg.Issuer != "https://auth.example" || !slices.Equal(cfg.Audiences, []string{"api", "admin"}) {
+		t.Errorf("unexpected issuer or audiences: %q %q", cfg.Issuer, cfg.Audiences)
+	}
+	if cfg.AccessTTL != 2*time.Hour || cfg.RefreshTTL != 7*24*time.Hour || cfg.Leeway != 0 {
+		t.Errorf("unexpected durations: %+v", cfg)
+	}
+	if cfg.MaxLifetime() != cfg.RefreshTTL {
+		t.Errorf("expected max lifetime %v, got %v", cfg.RefreshTTL, cfg.MaxLifetime())
+	}
+}
+
+func TestIssuerAndAudienceEnforced(t *testing.T) {
+	base := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":        "https://auth.test",
+			"aud":        "admin",
+			"sub":        "user-123",
+			"jti":        "aud-jti",
+			"iat":        time.Now().Unix(),
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"token_type": "access",
+		}
+	}
+
+	if _, err := newVerifier().Validate(context.Background(), signWithTestKey(t, base())); err != nil {
+		t.Fatalf("token for an allowed audience should validate: %v", err)
+	}
+
+	cases := map[string]func(jwt.MapClaims){
+		"foreign audience": func(c jwt.MapClaims) { c["aud"] = "billing" },
+		"missing audience": func(c jwt.MapClaims) { delete(c, "aud") },
+		"foreign issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"missing issuer":   func(c jwt.MapClaims) { delete(c, "iss") },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := base()
+			mutate(claims)
+			if _, err := newVerifier().Validate(context.Background(), signWithTestKey(t, claims)); err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestLeewayToleratesClockSkew(t *testing.T) {
+	claims := jwt.MapClaims{
+		"iss":        "https://auth.test",
+		"aud":        "api",
+		"sub":        "user-123",
+		"jti":        "skew-jti",
+		"iat":        time.Now().Add(-time.Hour).Unix(),
+		"exp":        time.Now().Add(-2 * time.Second).Unix(),
+		"token_type": "access",
+	}
+
+	// testConfig allows 5 seconds of leeway.
+	if _, err := newVerifier().Validate(context.Background(), signWithTestKey(t, claims)); err != nil {
+		t.Fatalf("token expired within leeway should validate: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"auth-as-a-service/sdk/dpop"
+)
+
+// proofMaxAge is how old a DPoP proof may be. Proof IDs are remembered for
+// this long, plus leeway, to stop replay.
+const proofMaxAge = 5 * time.Minute
+
+// VerifyProof checks a DPoP proof for a request and records its jti so the
+// same proof cannot be presented twice. accessToken is the token the request
+// carries, or "" at login and refresh.
+func (v *Verifier) VerifyProof(ctx context.Context, proof, method, requestURL, accessToken string) (*dpop.Proof, error) {
+	p, err := dpop.Verify(proof, method, requestURL, accessToken, proofMaxAge, v.cfg.Leeway)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh, err := v.cache.SetNX(ctx, "dpop_jti:"+p.Thumbprint+":"+p.ID, "1", proofMaxAge+v.cfg.Leeway)
+	if err != nil {
+		return nil, fmt.Errorf("record DPoP proof: %w", err)
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: proof already used", dpop.ErrInvalidProof)
+	}
+	return p, nil
+}
@@ -0,0 +1,88 @@
+package token_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/dpop"
+	"auth-as-a-service/sdk/jwk"
+	"auth-as-a-service/sdk/token"
+)
+
+// dpopProof signs a proof for a POST to https://auth.test/auth/refresh.
+func dpopProof(t *testing.T, priv ed25519.PrivateKey, jti string) string {
+	t.Helper()
+	pub, err := jwk.FromPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	var header map[string]any
+	b, _ := json.Marshal(pub)
+	json.Unmarshal(b, &header)
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"jti": jti,
+		"htm": "POST",
+		"htu": "https://auth.test/auth/refresh",
+		"iat": time.Now().Unix(),
+	})
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = header
+	signed, err := proof.SignedString(priv)
+	if err != nil {
+		t.Fatalf("sign proof: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyProofRejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	verifier := newVerifier()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	proof := dpopProof(t, priv, "proof-1")
+
+	p, err := verifier.VerifyProof(ctx, proof, "POST", "https://auth.test/auth/refresh", "")
+	if err != nil {
+		t.Fatalf("verify proof: %v", err)
+	}
+	pub, _ := jwk.FromPublicKey(priv.Public())
+	if p.Thumbprint != jwk.Thumbprint(pub) {
+		t.Errorf("unexpected thumbprint %s", p.Thumbprint)
+	}
+
+	if _, err := verifier.VerifyProof(ctx, proof, "POST", "https://auth.test/auth/refresh", ""); !errors.Is(err, dpop.ErrInvalidProof) {
+		t.Fatalf("expected replayed proof to be rejected, got %v", err)
+	}
+}
+
+func TestBoundTokenCarriesThumbprint(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	tok, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", KeyThumbprint: "thumb"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	claims, err := verifier.Validate(ctx, tok)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.KeyThumbprint != "thumb" || len(claims.Custom) != 0 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if in := verifier.Introspect(ctx, tok); in.Confirmation == nil || in.Confirmation.KeyThumbprint != "thumb" {
+		t.Errorf("expected cnf in introspection, got %+v", in)
+	}
+}
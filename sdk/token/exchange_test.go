@@ -0,0 +1,80 @@
+package token_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestExchangedTokenCarriesActorChain(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig
+	cfg.ExchangeTTL = 10 * time.Minute
+	exchanger := token.NewIssuer(cfg, newMockCache())
+
+	tok, err := exchanger.GenerateExchanged(ctx, token.Claims{
+		Subject: "user-123",
+		Actor:   &token.Actor{Subject: "billing-service", Actor: &token.Actor{Subject: "staff-7"}},
+	}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("generate exchanged: %v", err)
+	}
+
+	claims, err := newVerifier().Validate(ctx, tok)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "billing-service" {
+		t.Fatalf("expected billing-service as actor, got %+v", claims.Actor)
+	}
+	if claims.Actor.Actor == nil || claims.Actor.Actor.Subject != "staff-7" {
+		t.Fatalf("expected staff-7 as prior actor, got %+v", claims.Actor.Actor)
+	}
+	// exp is in whole seconds, iat to the microsecond.
+	if life := claims.ExpiresAt.Sub(claims.IssuedAt); life > cfg.ExchangeTTL || life <= cfg.ExchangeTTL-time.Second {
+		t.Errorf("expected lifetime %v, got %v", cfg.ExchangeTTL, life)
+	}
+
+	in := newVerifier().Introspect(ctx, tok)
+	if in.Actor == nil || in.Actor.Subject != "billing-service" || in.Actor.Actor == nil {
+		t.Errorf("expected actor chain in introspection, got %+v", in.Actor)
+	}
+}
+
+func TestExchangedTokenNeedsActor(t *testing.T) {
+	if _, err := issuer.GenerateExchanged(context.Background(), token.Claims{Subject: "user-123"}, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("expected error for exchanged token without an actor, got nil")
+	}
+}
+
+func TestExchangedTokenExpiresWithItsSource(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig
+	cfg.ExchangeTTL = 10 * time.Minute
+	exchanger := token.NewIssuer(cfg, newMockCache())
+	c := token.Claims{Subject: "user-123", Actor: &token.Actor{Subject: "billing-service"}}
+
+	// Re-exchanging tokens as they are issued never gets past the first
+	// one's expiry.
+	notAfter := time.Now().Add(2 * time.Minute)
+	for range 3 {
+		tok, err := exchanger.GenerateExchanged(ctx, c, notAfter)
+		if err != nil {
+			t.Fatalf("generate exchanged: %v", err)
+		}
+		claims, err := newVerifier().Validate(ctx, tok)
+		if err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		if claims.ExpiresAt.After(notAfter) {
+			t.Fatalf("expected expiry by %v, got %v", notAfter, claims.ExpiresAt)
+		}
+		notAfter = claims.ExpiresAt
+	}
+
+	if _, err := exchanger.GenerateExchanged(ctx, c, time.Now().Add(-time.Second)); err == nil {
+		t.Fatal("expected error exchanging an expired token, got nil")
+	}
+}
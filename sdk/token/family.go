@@ -0,0 +1,63 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A family is the chain of refresh tokens produced by rotating the one
+// issued at login. Every token in the chain, and every access token minted
+// alongside it, carries the family ID in its `fam` claim.
+
+// ReuseError is returned by ValidateRefresh when a refresh token that was
+// already rotated is presented again. By the time it is returned the whole
+// family has been revoked.
+type ReuseError struct {
+	UserID  string
+	Family  string
+	TokenID string
+}
+
+func (e *ReuseError) Error() string {
+	return "refresh token reused; token family revoked"
+}
+
+// NewFamily returns a fresh family ID for a login.
+func NewFamily() string {
+	return uuid.New().String()
+}
+
+// RevokeFamily revokes every token carrying the family ID. The marker lives
+// as long as the longest refresh token in the family can.
+func (v *Verifier) RevokeFamily(ctx context.Context, family string) error {
+	return v.cache.Set(ctx, "family_revoked:"+family, "1", v.cfg.RefreshTTL)
+}
+
+func (v *Verifier) familyRevoked(ctx context.Context, family string) bool {
+	val, err := v.cache.Get(ctx, "family_revoked:"+family)
+	return err == nil && val != ""
+}
+
+// Rotate spends a refresh token ValidateRefresh accepted, before the next
+// pair is issued. The claim is atomic: of any number of requests racing with
+// the same token, exactly one succeeds and the others get a *ReuseError,
+// with the family revoked, as a replay after the rotation would.
+func (v *Verifier) Rotate(ctx context.Context, tokenString string, claims *Claims) error {
+	// The marker need only outlive the token; ValidateRefresh has checked it
+	// has not expired, give or take the leeway.
+	ttl := max(time.Until(claims.ExpiresAt), v.cfg.Leeway, time.Second)
+	claimed, err := v.cache.SetNX(ctx, "refresh_rotated:"+claims.ID, "1", ttl)
+	if err != nil {
+		return fmt.Errorf("claim refresh token: %w", err)
+	}
+	if !claimed {
+		if err := v.RevokeFamily(ctx, claims.Family); err != nil {
+			return fmt.Errorf("revoke token family: %w", err)
+		}
+		return &ReuseError{UserID: claims.Subject, Family: claims.Family, TokenID: claims.ID}
+	}
+	return v.Revoke(ctx, tokenString)
+}
@@ -0,0 +1,52 @@
+package token_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestGenerateIDToken(t *testing.T) {
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	tok, err := issuer.GenerateIDToken(token.IDClaims{
+		Subject:       "user-123",
+		ClientID:      "web-app",
+		Nonce:         "n-0S6_WzA2Mj",
+		AuthTime:      authTime,
+		Email:         "jane@example.com",
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("generate id token: %v", err)
+	}
+
+	// A relying party verifies an ID token with the published key alone.
+	parsed, err := jwt.Parse(tok, func(*jwt.Token) (any, error) { return testKey.Public(), nil },
+		jwt.WithIssuer("https://auth.test"), jwt.WithAudience("web-app"))
+	if err != nil {
+		t.Fatalf("parse id token: %v", err)
+	}
+	m := parsed.Claims.(jwt.MapClaims)
+	if m["sub"] != "user-123" || m["nonce"] != "n-0S6_WzA2Mj" || m["email"] != "jane@example.com" || m["email_verified"] != true {
+		t.Errorf("unexpected claims: %v", m)
+	}
+	if got := int64(m["auth_time"].(float64)); got != authTime.Unix() {
+		t.Errorf("expected auth_time %d, got %d", authTime.Unix(), got)
+	}
+}
+
+func TestIDTokenRejectedAsAccessToken(t *testing.T) {
+	// Even an ID token whose audience the verifier accepts is refused.
+	tok, err := issuer.GenerateIDToken(token.IDClaims{Subject: "user-123", ClientID: "api", AuthTime: time.Now()})
+	if err != nil {
+		t.Fatalf("generate id token: %v", err)
+	}
+
+	if _, err := newVerifier().Validate(context.Background(), tok); err == nil {
+		t.Fatal("expected error using an id token as access token, got nil")
+	}
+}
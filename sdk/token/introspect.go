@@ -0,0 +1,72 @@
+package token
+
+import (
+	"context"
+	"strings"
+)
+
+// Introspection is the RFC 7662 view of a token.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+	// Confirmation is present for DPoP-bound tokens (RFC 9449 section 6.2).
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// Actor is present for tokens issued by token exchange (RFC 8693 section 4.1).
+	Actor *IntrospectedActor `json:"act,omitempty"`
+}
+
+// IntrospectedActor is the act claim as introspection reports it.
+type IntrospectedActor struct {
+	Subject string             `json:"sub"`
+	Actor   *IntrospectedActor `json:"act,omitempty"`
+}
+
+func introspectActor(a *Actor) *IntrospectedActor {
+	if a == nil {
+		return nil
+	}
+	return &IntrospectedActor{Subject: a.Subject, Actor: introspectActor(a.Actor)}
+}
+
+// Confirmation names the key a token is bound to.
+type Confirmation struct {
+	KeyThumbprint string `json:"jkt"`
+}
+
+// Introspect runs the checks Validate and ValidateRefresh apply, without
+// their side effects, and reports the result. Any failure yields an
+// inactive response with no further detail, as RFC 7662 requires.
+func (v *Verifier) Introspect(ctx context.Context, tokenString string) Introspection {
+	claims, err := v.verify(ctx, tokenString, "")
+	if err != nil {
+		return Introspection{Active: false}
+	}
+
+	in := Introspection{
+		Active:    true,
+		Subject:   claims.Subject,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		ID:        claims.ID,
+		TokenType: claims.TokenType,
+		Scope:     strings.Join(claims.Scopes, " "),
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		Tenant:    claims.Tenant,
+		Actor:     introspectActor(claims.Actor),
+	}
+	if claims.KeyThumbprint != "" {
+		in.Confirmation = &Confirmation{KeyThumbprint: claims.KeyThumbprint}
+	}
+	if !claims.IssuedAt.IsZero() {
+		in.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return in
+}
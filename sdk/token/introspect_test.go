@@ -0,0 +1,81 @@
+package token_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestIntrospectActiveTokens(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	access, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	refresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	for tok, wantType := range map[string]string{access: "access", refresh: "refresh"} {
+		in := verifier.Introspect(ctx, tok)
+		if !in.Active {
+			t.Fatalf("expected %s token to be active", wantType)
+		}
+		if in.Subject != "user-123" || in.TokenType != wantType || in.ID == "" || in.ExpiresAt == 0 || in.IssuedAt == 0 ||
+			in.Issuer != "https://auth.test" || len(in.Audience) != 1 || in.Audience[0] != "api" {
+			t.Errorf("unexpected introspection for %s token: %+v", wantType, in)
+		}
+	}
+}
+
+func TestIntrospectInactiveTokens(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	revoked, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := verifier.Revoke(ctx, revoked); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	for name, tok := range map[string]string{"revoked": revoked, "garbage": "not-a-token"} {
+		if in := verifier.Introspect(ctx, tok); !reflect.DeepEqual(in, token.Introspection{}) {
+			t.Errorf("expected bare inactive response for %s token, got %+v", name, in)
+		}
+	}
+}
+
+func TestIntrospectRotatedRefreshDoesNotRevokeFamily(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	family := token.NewFamily()
+
+	rotated, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-123", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+	if err := verifier.Revoke(ctx, rotated); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	next, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-123", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	if in := verifier.Introspect(ctx, rotated); in.Active {
+		t.Fatal("expected rotated refresh token to be inactive")
+	}
+	if _, err := verifier.ValidateRefresh(ctx, next); err != nil {
+		t.Fatalf("introspection must not revoke the family: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package token
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"auth-as-a-service/sdk/jwk"
+)
+
+// KeyState tracks where a key is in its rotation lifecycle.
+type KeyState string
+
+const (
+	// KeyCurrent signs new tokens. Exactly one key is current.
+	KeyCurrent KeyState = "current"
+	// KeyPrevious no longer signs but still verifies until RetiresAt.
+	KeyPrevious KeyState = "previous"
+	// KeyRetired is neither used for signing nor verification.
+	KeyRetired KeyState = "retired"
+)
+
+// KeyRing holds the current signing key and the previous keys that still verify.
+// It is safe for concurrent use.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+// NewKeyRing builds a ring from keys. Exactly one key must be current.
+func NewKeyRing(keys ...*Key) (*KeyRing, error) {
+	r := &KeyRing{}
+	if err := r.Replace(keys); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Replace swaps the ring contents, e.g. after reloading keys from storage.
+func (r *KeyRing) Replace(keys []*Key) error {
+	current := 0
+	for _, k := range keys {
+		if k.State == KeyCurrent {
+			current++
+		}
+	}
+	if current != 1 {
+		return fmt.Errorf("key ring needs exactly one current key, got %d", current)
+	}
+
+	r.mu.Lock()
+	r.keys = cloneKeys(keys)
+	r.mu.Unlock()
+	return nil
+}
+
+// Keys returns a snapshot of every key in the ring, including retired ones.
+func (r *KeyRing) Keys() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return cloneKeys(r.keys)
+}
+
+// Current returns the key that signs new tokens.
+func (r *KeyRing) Current() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.State == KeyCurrent {
+			return k
+		}
+	}
+	return nil
+}
+
+// Lookup returns the key with the given kid if it may still verify tokens.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.ID == kid && k.verifies(now) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS returns the public keys of every key that still verifies.
+func (r *KeyRing) JWKS() jwk.Set {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	set := jwk.Set{Keys: []jwk.JWK{}}
+	for _, k := range r.keys {
+		if k.verifies(now) {
+			set.Keys = append(set.Keys, k.JWK())
+		}
+	}
+	return set
+}
+
+// Rotate makes next the current key. The outgoing current key becomes
+// previous and keeps verifying for overlap, which should be at least the
+// longest token lifetime. Previous keys whose window has passed are retired.
+func (r *KeyRing) Rotate(next *Key, now time.Time, overlap time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Copy on write: keys handed out by Current and Lookup stay immutable.
+	r.keys = cloneKeys(r.keys)
+	for _, k := range r.keys {
+		switch {
+		case k.State == KeyCurrent:
+			k.State = KeyPrevious
+			k.RetiresAt = now.Add(overlap)
+		case k.State == KeyPrevious && !now.Before(k.RetiresAt):
+			k.State = KeyRetired
+		}
+	}
+
+	next.State = KeyCurrent
+	next.CreatedAt = now
+	next.RetiresAt = time.Time{}
+	r.keys = append(r.keys, next)
+}
+
+// Retire stops a previous key from verifying immediately, e.g. after a leak.
+// The current key cannot be retired; rotate away from it first.
+func (r *KeyRing) Retire(kid string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = cloneKeys(r.keys)
+	for _, k := range r.keys {
+		if k.ID != kid {
+			continue
+		}
+		if k.State == KeyCurrent {
+			return fmt.Errorf("key %s is current; rotate before retiring it", kid)
+		}
+		k.State = KeyRetired
+		k.RetiresAt = now
+		return nil
+	}
+	return fmt.Errorf("key %s not found", kid)
+}
+
+func (k *Key) verifies(now time.Time) bool {
+	switch k.State {
+	case KeyCurrent:
+		return true
+	case KeyPrevious:
+		return now.Before(k.RetiresAt)
+	default:
+		return false
+	}
+}
+
+func cloneKeys(keys []*Key) []*Key {
+	out := make([]*Key, len(keys))
+	for i, k := range keys {
+		c := *k
+		out[i] = &c
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package token_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-as-a-service/sdk/token"
+)
+
+// withRing returns an issuer and verifier that use ring in place of the
+// test key ring.
+func withRing(ring *token.KeyRing, cache *mockCache) (*token.Issuer, *token.Verifier) {
+	cfg := testConfig
+	cfg.Keys = ring
+	return token.NewIssuer(cfg, newMockCache()), token.NewVerifier(cfg, cache)
+}
+
+func newCurrentKey(t *testing.T, alg string) *token.Key {
+	t.Helper()
+	k, err := token.GenerateKey(alg)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	k.State = token.KeyCurrent
+	return k
+}
+
+func TestKeyRingRequiresOneCurrentKey(t *testing.T) {
+	k, err := token.GenerateKey(token.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	k.State = token.KeyPrevious
+
+	if _, err := token.NewKeyRing(k); err == nil {
+		t.Fatal("expected error for ring without a current key, got nil")
+	}
+	if _, err := token.NewKeyRing(newCurrentKey(t, token.AlgEdDSA), newCurrentKey(t, token.AlgES256)); err == nil {
+		t.Fatal("expected error for ring with two current keys, got nil")
+	}
+}
+
+func TestRotationKeepsPreviousKeyVerifying(t *testing.T) {
+	old := newCurrentKey(t, token.AlgES256)
+	ring, err := token.NewKeyRing(old)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	issuer, verifier := withRing(ring, newMockCache())
+	oldTok, err := issuer.GenerateRefresh(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	next := newCurrentKey(t, token.AlgRS256)
+	ring.Rotate(next, time.Now(), time.Hour)
+
+	if got := ring.Current().ID; got != next.ID {
+		t.Fatalf("expected %s to be current, got %s", next.ID, got)
+	}
+	if _, err := verifier.ValidateRefresh(context.Background(), oldTok); err != nil {
+		t.Fatalf("token signed by previous key should still verify: %v", err)
+	}
+
+	jwks := ring.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected current and previous keys in JWKS, got %d", len(jwks.Keys))
+	}
+	if _, ok := jwks.Find(old.ID); !ok {
+		t.Error("previous key missing from JWKS")
+	}
+}
+
+func TestPreviousKeyStopsVerifyingAfterOverlap(t *testing.T) {
+	old := newCurrentKey(t, token.AlgEdDSA)
+	ring, err := token.NewKeyRing(old)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	issuer, verifier := withRing(ring, newMockCache())
+
+	oldTok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	// Rotated long enough ago that the overlap window has already closed.
+	ring.Rotate(newCurrentKey(t, token.AlgEdDSA), time.Now().Add(-2*time.Hour), time.Hour)
+
+	if _, err := verifier.Validate(context.Background(), oldTok); err == nil {
+		t.Fatal("expected error for token signed by expired previous key, got nil")
+	}
+	if _, ok := ring.Lookup(old.ID); ok {
+		t.Error("expired previous key should not be available for verification")
+	}
+}
+
+func TestRetiredKeyRejected(t *testing.T) {
+	old := newCurrentKey(t, token.AlgEdDSA)
+	ring, err := token.NewKeyRing(old)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	issuer, verifier := withRing(ring, newMockCache())
+
+	oldTok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	ring.Rotate(newCurrentKey(t, token.AlgEdDSA), time.Now(), time.Hour)
+	if err := ring.Retire(old.ID, time.Now()); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+
+	if _, err := verifier.Validate(context.Background(), oldTok); err == nil {
+		t.Fatal("expected error for token signed by retired key, got nil")
+	}
+	if _, ok := ring.JWKS().Find(old.ID); ok {
+		t.Error("retired key should not be published in JWKS")
+	}
+}
+
+func TestCurrentKeyCannotBeRetired(t *testing.T) {
+	k := newCurrentKey(t, token.AlgEdDSA)
+	ring, err := token.NewKeyRing(k)
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+
+	if err := ring.Retire(k.ID, time.Now()); err == nil {
+		t.Fatal("expected error retiring the current key, got nil")
+	}
+}
@@ -0,0 +1,152 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/jwk"
+)
+
+// Supported asymmetric signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is an asymmetric signing key. ID is the RFC 7638 thumbprint of the
+// public half and is written to the `kid` header of every token it signs.
+type Key struct {
+	ID        string
+	Algorithm string
+	State     KeyState
+	CreatedAt time.Time
+	// RetiresAt is when a previous key stops verifying.
+	RetiresAt time.Time
+	signer    crypto.Signer
+}
+
+// NewKey wraps a private key, inferring the algorithm from its type.
+func NewKey(signer crypto.Signer) (*Key, error) {
+	var alg string
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		alg = AlgRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ecdsa curve: %s", k.Curve.Params().Name)
+		}
+		alg = AlgES256
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", signer)
+	}
+
+	pub, err := jwk.FromPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:        jwk.Thumbprint(pub),
+		Algorithm: alg,
+		CreatedAt: time.Now(),
+		signer:    signer,
+	}, nil
+}
+
+// GenerateKey creates a fresh key for the given algorithm.
+func GenerateKey(alg string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key: %w", alg, err)
+	}
+	return NewKey(signer)
+}
+
+// ParseKey decodes a PEM private key (PKCS#8, PKCS#1 or SEC 1).
+func ParseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type: %T", parsed)
+	}
+	return NewKey(signer)
+}
+
+// MarshalPEM encodes the private key as PKCS#8 PEM.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.signer)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Public returns the public half of the key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// JWK returns the public key in the form published at /.well-known/jwks.json.
+func (k *Key) JWK() jwk.JWK {
+	// NewKey already proved the public key encodes.
+	j, _ := jwk.FromPublicKey(k.Public())
+	j.Use = "sig"
+	j.Alg = k.Algorithm
+	j.Kid = k.ID
+	return j
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// LoadKeyFile reads a PEM private key from disk.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	return ParseKey(data)
+}
@@ -0,0 +1,113 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/app/memory/redis"
+)
+
+// An opaque token is 32 random bytes. The cache maps a hash of it to the
+// claims it stands for, for as long as the token is valid, so a leaked
+// cache dump yields no usable tokens.
+
+// opaqueEntry is the cache value behind an opaque token.
+type opaqueEntry struct {
+	Claims jwt.MapClaims `json:"claims"`
+	// Revoked marks a rotated refresh token. Its entry is kept so that
+	// replaying it is still recognized as reuse.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// isOpaque tells opaque tokens apart from JWTs and PASETO tokens, which
+// always contain dots.
+func isOpaque(tokenString string) bool {
+	return tokenString != "" && !strings.Contains(tokenString, ".")
+}
+
+func opaqueKey(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return "opaque_token:" + hex.EncodeToString(sum[:])
+}
+
+func (i *Issuer) storeOpaque(ctx context.Context, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	if i.cache == nil {
+		return "", fmt.Errorf("opaque tokens need a cache")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate opaque token: %w", err)
+	}
+	tok := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := writeOpaque(ctx, i.cache, tok, opaqueEntry{Claims: claims}, ttl); err != nil {
+		return "", err
+	}
+	return tok, nil
+}
+
+func writeOpaque(ctx context.Context, cache redis.Service, tokenString string, entry opaqueEntry, ttl time.Duration) error {
+	val, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal opaque token: %w", err)
+	}
+	return cache.Set(ctx, opaqueKey(tokenString), string(val), ttl)
+}
+
+// lookupOpaque resolves an opaque token to its claims and reports whether it
+// was revoked by rotation. With validate set the claims get the same issuer,
+// audience and lifetime checks a signed token would.
+func (v *Verifier) lookupOpaque(ctx context.Context, tokenString string, validate bool) (*Claims, bool, error) {
+	val, err := v.cache.Get(ctx, opaqueKey(tokenString))
+	if err != nil || val == "" {
+		return nil, false, fmt.Errorf("unknown token")
+	}
+
+	var entry opaqueEntry
+	if err := json.Unmarshal([]byte(val), &entry); err != nil {
+		return nil, false, fmt.Errorf("decode opaque token: %w", err)
+	}
+	if validate {
+		if err := jwt.NewValidator(v.validationOptions()...).Validate(entry.Claims); err != nil {
+			return nil, false, err
+		}
+	}
+
+	claims, err := claimsFromMap(entry.Claims)
+	if err != nil {
+		return nil, false, err
+	}
+	return claims, entry.Revoked, nil
+}
+
+// revokeOpaque deletes an access token's entry outright. A refresh token's
+// entry is marked revoked instead, for reuse detection.
+func (v *Verifier) revokeOpaque(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, _, err := v.lookupOpaque(ctx, tokenString, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !v.sameTenant(claims) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, errWrongTenant)
+	}
+
+	if claims.TokenType != TypeRefresh {
+		return claims, v.cache.Delete(ctx, opaqueKey(tokenString))
+	}
+
+	ttl := time.Until(claims.ExpiresAt)
+	if ttl <= 0 {
+		return claims, nil
+	}
+	return claims, writeOpaque(ctx, v.cache, tokenString, opaqueEntry{Claims: claims.toMap(), Revoked: true}, ttl)
+}
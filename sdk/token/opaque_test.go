@@ -0,0 +1,94 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func opaquePair(cache *mockCache) (*token.Issuer, *token.Verifier) {
+	cfg := testConfig
+	cfg.Format = token.FormatOpaque
+	return token.NewIssuer(cfg, cache), token.NewVerifier(cfg, cache)
+}
+
+func TestOpaqueAccessToken(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	issuer, verifier := opaquePair(cache)
+
+	tok, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if strings.Contains(tok, ".") || strings.Contains(tok, "user-123") {
+		t.Fatalf("expected an opaque token, got %s", tok)
+	}
+	for key := range cache.data {
+		if strings.Contains(key, tok) {
+			t.Fatalf("cache key must not contain the raw token: %s", key)
+		}
+	}
+
+	claims, err := verifier.Validate(ctx, tok)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.Subject != "user-123" || !claims.HasRole("admin") || claims.TokenType != token.TypeAccess {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if err := verifier.Revoke(ctx, tok); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if len(cache.data) != 0 {
+		t.Fatalf("revoking an opaque access token should delete its entry, got %v", cache.data)
+	}
+	if _, err := verifier.Validate(ctx, tok); err == nil {
+		t.Fatal("expected revoked opaque token to be rejected")
+	}
+}
+
+func TestOpaqueRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	issuer, verifier := opaquePair(cache)
+	family := token.NewFamily()
+	claims := token.Claims{Subject: "user-456", Family: family}
+
+	oldRefresh, err := issuer.GenerateRefresh(ctx, claims)
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+	if err := verifier.Revoke(ctx, oldRefresh); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	newAccess, err := issuer.Generate(ctx, claims)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	_, err = verifier.ValidateRefresh(ctx, oldRefresh)
+	var reuse *token.ReuseError
+	if !errors.As(err, &reuse) || reuse.Family != family {
+		t.Fatalf("expected ReuseError for family %s, got %v", family, err)
+	}
+	if _, err := verifier.Validate(ctx, newAccess); err == nil {
+		t.Fatal("expected access token to be revoked with its family")
+	}
+}
+
+func TestOpaqueUnknownTokenRejected(t *testing.T) {
+	ctx := context.Background()
+	_, verifier := opaquePair(newMockCache())
+
+	if _, err := verifier.Validate(ctx, "bm90LWEtcmVhbC10b2tlbg"); err == nil {
+		t.Fatal("expected unknown opaque token to be rejected")
+	}
+	if err := verifier.Revoke(ctx, "bm90LWEtcmVhbC10b2tlbg"); !errors.Is(err, token.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/paseto"
+)
+
+// pasetoFooter names the signing key, as the kid header does for JWTs.
+type pasetoFooter struct {
+	Kid string `json:"kid"`
+}
+
+// timeClaims are NumericDates in a JWT and RFC 3339 strings in PASETO.
+var timeClaims = []string{"exp", "iat", "nbf"}
+
+// signPASETO signs claims as a v4.public token. Only Ed25519 keys qualify.
+func signPASETO(k *Key, claims jwt.MapClaims) (string, error) {
+	priv, ok := k.signer.(ed25519.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("PASETO v4.public needs an EdDSA key, current key %s is %s", k.ID, k.Algorithm)
+	}
+
+	payload := make(map[string]any, len(claims))
+	for name, v := range claims {
+		payload[name] = v
+	}
+	for _, name := range timeClaims {
+		switch v := claims[name].(type) {
+		case int64:
+			payload[name] = time.Unix(v, 0).UTC().Format(time.RFC3339)
+		case float64:
+			payload[name] = fromNumericDate(v).UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+	footer, err := json.Marshal(pasetoFooter{Kid: k.ID})
+	if err != nil {
+		return "", fmt.Errorf("marshal footer: %w", err)
+	}
+	return paseto.Sign(priv, body, footer, nil), nil
+}
+
+// parsePASETO verifies a v4.public token against the key its footer names
+// and returns the claims with times converted to NumericDates, so they can
+// be validated exactly like a JWT's.
+func (v *Verifier) parsePASETO(tokenString string) (jwt.MapClaims, error) {
+	if v.cfg.Keys == nil {
+		return nil, fmt.Errorf("verifier has no key ring")
+	}
+
+	raw, err := paseto.Footer(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	var footer pasetoFooter
+	if err := json.Unmarshal(raw, &footer); err != nil {
+		return nil, fmt.Errorf("decode footer: %w", err)
+	}
+
+	k, ok := v.cfg.Keys.Lookup(footer.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown or retired signing key: %v", footer.Kid)
+	}
+	pub, ok := k.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s cannot verify PASETO tokens", k.ID)
+	}
+
+	payload, err := paseto.Verify(pub, tokenString, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.MapClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+	for _, name := range timeClaims {
+		raw, present := claims[name]
+		if !present {
+			continue
+		}
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s claim must be an RFC 3339 time", name)
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s claim must be an RFC 3339 time", name)
+		}
+		claims[name] = numericDate(t)
+	}
+	return claims, nil
+}
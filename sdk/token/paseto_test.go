@@ -0,0 +1,116 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-as-a-service/sdk/paseto"
+	"auth-as-a-service/sdk/token"
+)
+
+func pasetoIssuer() *token.Issuer {
+	cfg := testConfig
+	cfg.Format = token.FormatPASETO
+	return token.NewIssuer(cfg, newMockCache())
+}
+
+func TestPASETOAccessToken(t *testing.T) {
+	tok, err := pasetoIssuer().Generate(context.Background(), token.Claims{Subject: "user-123", Scopes: []string{"read"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.HasPrefix(tok, "v4.public.") {
+		t.Fatalf("expected a v4.public token, got %s", tok)
+	}
+
+	claims, err := newVerifier().Validate(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.Subject != "user-123" || !claims.HasScope("read") || claims.Audience[0] != "api" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if time.Until(claims.ExpiresAt) < 23*time.Hour {
+		t.Errorf("unexpected expiry: %v", claims.ExpiresAt)
+	}
+}
+
+func TestPASETORevocationAndRotation(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	issuer := pasetoIssuer()
+	family := token.NewFamily()
+	claims := token.Claims{Subject: "user-456", Family: family}
+
+	access, err := issuer.Generate(ctx, claims)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := verifier.Revoke(ctx, access); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := verifier.Validate(ctx, access); err == nil {
+		t.Fatal("expected revoked PASETO token to be rejected")
+	}
+
+	oldRefresh, err := issuer.GenerateRefresh(ctx, claims)
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+	if _, err := verifier.ValidateRefresh(ctx, oldRefresh); err != nil {
+		t.Fatalf("validate refresh: %v", err)
+	}
+	if err := verifier.Revoke(ctx, oldRefresh); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	_, err = verifier.ValidateRefresh(ctx, oldRefresh)
+	var reuse *token.ReuseError
+	if !errors.As(err, &reuse) || reuse.Family != family {
+		t.Fatalf("expected ReuseError for family %s, got %v", family, err)
+	}
+}
+
+func TestPASETORejectsTamperingAndExpiry(t *testing.T) {
+	tok, err := pasetoIssuer().Generate(context.Background(), token.Claims{Subject: "user-123"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	k, err := token.NewKey(testKey)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	expired := paseto.Sign(testKey, []byte(`{"iss":"https://auth.test","aud":"api","sub":"user-123","jti":"old",`+
+		`"exp":"2020-01-01T00:00:00Z","token_type":"access"}`), []byte(`{"kid":"`+k.ID+`"}`), nil)
+
+	// Flip a payload character; the signature covers it.
+	tampered := []byte(tok)
+	tampered[20] ^= 1
+
+	for name, tok := range map[string]string{
+		"tampered": string(tampered),
+		"expired":  expired,
+	} {
+		if _, err := newVerifier().Validate(context.Background(), tok); err == nil {
+			t.Errorf("expected %s token to be rejected", name)
+		}
+	}
+}
+
+func TestPASETONeedsEd25519Key(t *testing.T) {
+	ring, err := token.NewKeyRing(newCurrentKey(t, token.AlgES256))
+	if err != nil {
+		t.Fatalf("new key ring: %v", err)
+	}
+	cfg := testConfig
+	cfg.Keys = ring
+	cfg.Format = token.FormatPASETO
+
+	if _, err := token.NewIssuer(cfg, newMockCache()).Generate(context.Background(), token.Claims{Subject: "user-123"}); err == nil {
+		t.Fatal("expected error issuing PASETO with an ES256 key")
+	}
+}
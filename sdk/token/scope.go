@@ -0,0 +1,16 @@
+package token
+
+import "slices"
+
+// GrantScopes returns the requested scopes that appear in allowed, without
+// duplicates, in the order requested. Scopes outside allowed are dropped,
+// as RFC 6749 section 3.3 lets a server do.
+func GrantScopes(requested, allowed []string) []string {
+	var granted []string
+	for _, s := range requested {
+		if slices.Contains(allowed, s) && !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	return granted
+}
@@ -0,0 +1,18 @@
+package token_test
+
+import (
+	"slices"
+	"testing"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestGrantScopes(t *testing.T) {
+	got := token.GrantScopes([]string{"orders:write", "openid", "admin", "openid"}, []string{"openid", "orders:write"})
+	if want := []string{"orders:write", "openid"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := token.GrantScopes([]string{"admin"}, nil); got != nil {
+		t.Errorf("expected nothing granted, got %v", got)
+	}
+}
@@ -2,162 +2,344 @@ package token
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
 	"auth-as-a-service/app/memory/redis"
+	"auth-as-a-service/sdk/paseto"
 )
 
-func Generate(userID string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	expiryHours := 24
-	if h, err := strconv.Atoi(os.Getenv("JWT_EXPIRY_HOURS")); err == nil && h > 0 {
-		expiryHours = h
+// Issuer mints access and refresh tokens signed by the ring's current key,
+// or stored in cache when the format is opaque.
+type Issuer struct {
+	cfg   Config
+	cache redis.Service
+}
+
+// NewIssuer returns an Issuer for cfg. cfg.Keys must be set.
+func NewIssuer(cfg Config, cache redis.Service) *Issuer {
+	return &Issuer{cfg: cfg, cache: cache}
+}
+
+// Config returns the configuration the Issuer was built with.
+func (i *Issuer) Config() Config {
+	return i.cfg
+}
+
+// Generate issues an access token for c. Subject is required; Audience
+// defaults to the first allowed audience. ID, Issuer, Tenant, IssuedAt,
+// ExpiresAt and TokenType are always set by the Issuer.
+func (i *Issuer) Generate(ctx context.Context, c Claims) (string, error) {
+	return i.issue(ctx, c, TypeAccess, i.cfg.AccessTTL)
+}
+
+// GenerateRefresh issues a refresh token for c, which must carry a Family
+// and exactly one audience once defaults are applied.
+func (i *Issuer) GenerateRefresh(ctx context.Context, c Claims) (string, error) {
+	if c.Family == "" {
+		return "", fmt.Errorf("refresh token needs a family")
 	}
+	if len(c.Audience) > 1 {
+		return "", fmt.Errorf("refresh token must name exactly one audience")
+	}
+	return i.issue(ctx, c, TypeRefresh, i.cfg.RefreshTTL)
+}
 
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub":        userID,
-		"jti":        uuid.New().String(),
-		"exp":        now.Add(time.Duration(expiryHours) * time.Hour).Unix(),
-		"iat":        now.Unix(),
-		"token_type": "access",
+// GenerateExchanged issues an access token for c on behalf of c.Actor, as
+// token exchange does. It lives for Config.ExchangeLifetime but never past
+// notAfter, the expiry of the tokens it was exchanged for, so exchanging
+// each new token again before it expires cannot keep a delegation alive.
+func (i *Issuer) GenerateExchanged(ctx context.Context, c Claims, notAfter time.Time) (string, error) {
+	if c.Actor == nil {
+		return "", fmt.Errorf("exchanged token needs an actor")
+	}
+	ttl := i.ExchangedLifetime(notAfter)
+	if ttl <= 0 {
+		return "", fmt.Errorf("exchanged token would outlive the tokens it was exchanged for")
 	}
+	return i.issue(ctx, c, TypeAccess, ttl)
+}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString([]byte(secret))
+// ExchangedLifetime is how long a token GenerateExchanged issues now with
+// notAfter lives.
+func (i *Issuer) ExchangedLifetime(notAfter time.Time) time.Duration {
+	return min(i.cfg.ExchangeLifetime(), time.Until(notAfter).Truncate(time.Second))
 }
 
-func GenerateRefresh(userID string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	expiryDays := 30
-	if d, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_EXPIRY_DAYS")); err == nil && d > 0 {
-		expiryDays = d
+func (i *Issuer) issue(ctx context.Context, c Claims, tokenType string, ttl time.Duration) (string, error) {
+	if c.Subject == "" {
+		return "", fmt.Errorf("token needs a subject")
+	}
+	if len(c.Audience) == 0 {
+		c.Audience = i.cfg.audiences()[:1]
+	}
+	for _, aud := range c.Audience {
+		if !slices.Contains(i.cfg.audiences(), aud) {
+			return "", fmt.Errorf("%w: %s", ErrAudienceNotAllowed, aud)
+		}
 	}
 
 	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub":        userID,
-		"jti":        uuid.New().String(),
-		"exp":        now.Add(time.Duration(expiryDays) * 24 * time.Hour).Unix(),
-		"iat":        now.Unix(),
-		"token_type": "refresh",
+	c.ID = uuid.New().String()
+	c.Issuer = i.cfg.Issuer
+	c.Tenant = i.cfg.Tenant
+	c.IssuedAt = now
+	c.ExpiresAt = now.Add(ttl)
+	c.TokenType = tokenType
+	if i.cfg.Format == FormatOpaque {
+		return i.storeOpaque(ctx, c.toMap(), ttl)
+	}
+	return i.sign(c.toMap())
+}
+
+// sign signs claims with the ring's current key in the configured format.
+// JWTs carry the key's kid in the header, PASETO tokens in the footer.
+func (i *Issuer) sign(claims jwt.MapClaims) (string, error) {
+	k := i.cfg.Keys.Current()
+	switch i.cfg.Format {
+	case FormatJWT, "":
+		return signJWT(k, claims)
+	case FormatPASETO:
+		return signPASETO(k, claims)
+	default:
+		return "", fmt.Errorf("unsupported token format: %s", i.cfg.Format)
 	}
+}
+
+// signJWT signs claims as a JWT naming k in its kid header.
+func signJWT(k *Key, claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(k.method(), claims)
+	t.Header["kid"] = k.ID
+	return t.SignedString(k.signer)
+}
+
+// Verifier checks tokens against the key ring and the revocation state
+// kept in cache.
+type Verifier struct {
+	cfg   Config
+	cache redis.Service
+}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString([]byte(secret))
+// NewVerifier returns a Verifier for cfg. cfg.Keys may be nil for a
+// Verifier that is only used to revoke families and users.
+func NewVerifier(cfg Config, cache redis.Service) *Verifier {
+	return &Verifier{cfg: cfg, cache: cache}
 }
 
-func Validate(ctx context.Context, tokenString string, cache redis.Service) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+var (
+	errTokenRevoked  = errors.New("token revoked")
+	errFamilyRevoked = errors.New("token family revoked")
+	errUserRevoked   = errors.New("token issued before the user signed out everywhere")
+	errWrongTenant   = errors.New("token was issued for another tenant")
+)
+
+// Validate checks an access token and returns its claims.
+func (v *Verifier) Validate(ctx context.Context, tokenString string) (*Claims, error) {
+	return v.verify(ctx, tokenString, TypeAccess)
+}
 
-	t, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+// ValidateRefresh checks a refresh token and returns its claims, which
+// always carry a Family and exactly one audience. Presenting a refresh
+// token that was already rotated revokes its family and returns a
+// *ReuseError.
+func (v *Verifier) ValidateRefresh(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := v.verify(ctx, tokenString, TypeRefresh)
+	if errors.Is(err, errTokenRevoked) {
+		if claims.Family == "" {
+			return nil, err
 		}
-		return []byte(secret), nil
-	})
+		if err := v.RevokeFamily(ctx, claims.Family); err != nil {
+			return nil, fmt.Errorf("revoke token family: %w", err)
+		}
+		return nil, &ReuseError{UserID: claims.Subject, Family: claims.Family, TokenID: claims.ID}
+	}
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if claims.Family == "" {
+		return nil, fmt.Errorf("missing fam claim")
 	}
+	if len(claims.Audience) != 1 {
+		return nil, fmt.Errorf("refresh token must name exactly one audience")
+	}
+	return claims, nil
+}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok || !t.Valid {
-		return "", fmt.Errorf("invalid token")
+// verify checks the signature, expiry, token type and revocation state.
+// tokenType is TypeAccess, TypeRefresh, or "" to accept either. On
+// errTokenRevoked the verified claims are returned alongside the error.
+func (v *Verifier) verify(ctx context.Context, tokenString, tokenType string) (*Claims, error) {
+	var claims *Claims
+	var revoked bool
+	var err error
+	if isOpaque(tokenString) {
+		claims, revoked, err = v.lookupOpaque(ctx, tokenString, true)
+	} else {
+		claims, err = v.parse(tokenString, true)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if tt, _ := claims["token_type"].(string); tt == "refresh" {
-		return "", fmt.Errorf("refresh token cannot be used as access token")
+	switch {
+	case claims.TokenType == TypeID:
+		return nil, fmt.Errorf("id token cannot be used as access token")
+	case tokenType == TypeAccess && claims.TokenType == TypeRefresh:
+		return nil, fmt.Errorf("refresh token cannot be used as access token")
+	case tokenType == TypeRefresh && claims.TokenType != TypeRefresh:
+		return nil, fmt.Errorf("not a refresh token")
 	}
 
-	jti, ok := claims["jti"].(string)
-	if !ok || jti == "" {
-		return "", fmt.Errorf("missing jti claim")
+	if claims.ID == "" {
+		return nil, fmt.Errorf("missing jti claim")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("missing sub claim")
+	}
+	if !v.sameTenant(claims) {
+		return nil, errWrongTenant
 	}
 
-	val, err := cache.Get(ctx, "blacklist:"+jti)
-	if err == nil && val != "" {
-		return "", fmt.Errorf("token revoked")
+	if claims.Family != "" && v.familyRevoked(ctx, claims.Family) {
+		return nil, errFamilyRevoked
+	}
+	if v.issuedBeforeCutoff(ctx, claims.Subject, claims.IssuedAt) {
+		return nil, errUserRevoked
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("missing sub claim")
+	// Opaque tokens are revoked in place, so they need no blacklist lookup.
+	if !isOpaque(tokenString) {
+		val, err := v.cache.Get(ctx, "blacklist:"+claims.ID)
+		revoked = err == nil && val != ""
+	}
+	if revoked {
+		return claims, errTokenRevoked
 	}
 
-	return sub, nil
+	return claims, nil
 }
 
-func ValidateRefresh(ctx context.Context, tokenString string, cache redis.Service) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+// sameTenant reports whether claims belong to the Verifier's tenant. A
+// Verifier without a tenant accepts tokens from any.
+func (v *Verifier) sameTenant(claims *Claims) bool {
+	return v.cfg.Tenant == "" || claims.Tenant == v.cfg.Tenant
+}
 
-	t, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
-	if err != nil {
-		return "", err
+func (v *Verifier) validationOptions() []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithAudience(v.cfg.audiences()...),
+		jwt.WithLeeway(v.cfg.Leeway),
+		jwt.WithExpirationRequired(),
 	}
+}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok || !t.Valid {
-		return "", fmt.Errorf("invalid token")
-	}
+// parse verifies the signature of a JWT or PASETO token and, if validate is
+// set, its issuer, audience and lifetime.
+func (v *Verifier) parse(tokenString string, validate bool) (*Claims, error) {
+	opts := v.validationOptions()
 
-	if tt, _ := claims["token_type"].(string); tt != "refresh" {
-		return "", fmt.Errorf("not a refresh token")
+	var mc jwt.MapClaims
+	if paseto.IsV4Public(tokenString) {
+		var err error
+		if mc, err = v.parsePASETO(tokenString); err != nil {
+			return nil, err
+		}
+		if validate {
+			if err := jwt.NewValidator(opts...).Validate(mc); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if !validate {
+			opts = []jwt.ParserOption{jwt.WithoutClaimsValidation()}
+		}
+		t, err := jwt.Parse(tokenString, v.verificationKey, opts...)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if mc, ok = t.Claims.(jwt.MapClaims); !ok || !t.Valid {
+			return nil, fmt.Errorf("invalid token")
+		}
 	}
+	return claimsFromMap(mc)
+}
 
-	jti, ok := claims["jti"].(string)
-	if !ok || jti == "" {
-		return "", fmt.Errorf("missing jti claim")
+// verificationKey resolves the public key named by the token's kid and
+// rejects any algorithm other than the one that key signs with.
+func (v *Verifier) verificationKey(t *jwt.Token) (any, error) {
+	if v.cfg.Keys == nil {
+		return nil, fmt.Errorf("verifier has no key ring")
 	}
 
-	val, err := cache.Get(ctx, "blacklist:"+jti)
-	if err == nil && val != "" {
-		return "", fmt.Errorf("token revoked")
+	kid, _ := t.Header["kid"].(string)
+	k, ok := v.cfg.Keys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown or retired signing key: %v", t.Header["kid"])
 	}
-
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("missing sub claim")
+	if t.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 	}
+	return k.Public(), nil
+}
 
-	return sub, nil
+// ErrInvalidToken is returned by Revoke for tokens that are malformed or
+// were not signed by a key in the ring.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Revoke blacklists the token's jti for the rest of its lifetime. The
+// signature is verified first so forged tokens cannot fill the blacklist;
+// expiry is not, since an expired token needs no blacklisting. Opaque
+// tokens are revoked in the cache entry that backs them instead.
+func (v *Verifier) Revoke(ctx context.Context, tokenString string) error {
+	_, err := v.revoke(ctx, tokenString)
+	return err
 }
 
-func Revoke(ctx context.Context, tokenString string, cache redis.Service) error {
-	t, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+// RevokeGrant revokes the token and, for a refresh token, every token in its
+// family, as RFC 7009 recommends for refresh token revocation.
+func (v *Verifier) RevokeGrant(ctx context.Context, tokenString string) error {
+	claims, err := v.revoke(ctx, tokenString)
 	if err != nil {
-		return fmt.Errorf("parse token: %w", err)
+		return err
+	}
+	if claims.TokenType != TypeRefresh || claims.Family == "" {
+		return nil
 	}
+	return v.RevokeFamily(ctx, claims.Family)
+}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok {
-		return fmt.Errorf("invalid claims")
+func (v *Verifier) revoke(ctx context.Context, tokenString string) (*Claims, error) {
+	if isOpaque(tokenString) {
+		return v.revokeOpaque(ctx, tokenString)
 	}
 
-	jti, ok := claims["jti"].(string)
-	if !ok || jti == "" {
-		return fmt.Errorf("missing jti claim")
+	claims, err := v.parse(tokenString, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 
-	expFloat, ok := claims["exp"].(float64)
-	if !ok {
-		return fmt.Errorf("missing exp claim")
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing jti claim", ErrInvalidToken)
+	}
+	if !v.sameTenant(claims) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, errWrongTenant)
+	}
+	if claims.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
 	}
 
-	ttl := time.Until(time.Unix(int64(expFloat), 0))
+	ttl := time.Until(claims.ExpiresAt)
 	if ttl <= 0 {
-		return nil
+		return claims, nil
 	}
 
-	return cache.Set(ctx, "blacklist:"+jti, "1", ttl)
+	return claims, v.cache.Set(ctx, "blacklist:"+claims.ID, "1", ttl)
 }
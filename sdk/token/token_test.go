@@ -2,9 +2,15 @@ package token_test
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +21,7 @@ import (
 
 // mockCache is an in-memory redis.Service for testing.
 type mockCache struct {
+	mu   sync.Mutex
 	data map[string]string
 }
 
@@ -23,6 +30,8 @@ func newMockCache() *mockCache {
 }
 
 func (m *mockCache) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	v, ok := m.data[key]
 	if !ok {
 		return "", errors.New("not found")
@@ -31,11 +40,45 @@ func (m *mockCache) Get(_ context.Context, key string) (string, error) {
 }
 
 func (m *mockCache) Set(_ context.Context, key string, value any, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[key] = fmt.Sprintf("%v", value)
 	return nil
 }
 
+func (m *mockCache) SetNX(_ context.Context, key string, value any, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		return false, nil
+	}
+	m.data[key] = fmt.Sprintf("%v", value)
+	return true, nil
+}
+
+func (m *mockCache) GetDel(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	delete(m.data, key)
+	return v, nil
+}
+
+func (m *mockCache) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(m.data[key], 10, 64)
+	n++
+	m.data[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
 func (m *mockCache) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, key)
 	return nil
 }
@@ -43,73 +86,207 @@ func (m *mockCache) Delete(_ context.Context, key string) error {
 func (m *mockCache) Health() map[string]string { return nil }
 func (m *mockCache) Close() error              { return nil }
 
+// testKey is the signing key every test issuer and verifier uses unless a
+// test builds its own ring.
+var testKey ed25519.PrivateKey
+
+var (
+	testConfig token.Config
+	issuer     *token.Issuer
+)
+
 func TestMain(m *testing.M) {
-	os.Setenv("JWT_SECRET", "test-secret-key-for-unit-tests")
-	os.Setenv("JWT_EXPIRY_HOURS", "24")
-	os.Setenv("REFRESH_TOKEN_EXPIRY_DAYS", "30")
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	testKey = priv
+
+	k, err := token.NewKey(priv)
+	if err != nil {
+		panic(err)
+	}
+	k.State = token.KeyCurrent
+	ring, err := token.NewKeyRing(k)
+	if err != nil {
+		panic(err)
+	}
+
+	testConfig = token.Config{
+		Keys:       ring,
+		Issuer:     "https://auth.test",
+		Audiences:  []string{"api", "admin"},
+		AccessTTL:  24 * time.Hour,
+		RefreshTTL: 30 * 24 * time.Hour,
+		Leeway:     5 * time.Second,
+	}
+	issuer = token.NewIssuer(testConfig, newMockCache())
 	os.Exit(m.Run())
 }
 
+// newVerifier returns a verifier for testConfig backed by an empty cache.
+func newVerifier() *token.Verifier {
+	return token.NewVerifier(testConfig, newMockCache())
+}
+
+// signWithTestKey signs arbitrary claims the way the service would.
+func signWithTestKey(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	k, err := token.NewKey(testKey)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["kid"] = k.ID
+	signed, err := tok.SignedString(testKey)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
 func TestValidToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.Generate("user-123")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate: %v", err)
 	}
 
-	userID, err := token.Validate(context.Background(), tok, cache)
+	claims, err := verifier.Validate(context.Background(), tok)
 	if err != nil {
 		t.Fatalf("validate: %v", err)
 	}
-	if userID != "user-123" {
-		t.Errorf("expected user-123, got %s", userID)
+	if claims.Subject != "user-123" || claims.TokenType != token.TypeAccess || claims.ID == "" {
+		t.Errorf("unexpected claims: %+v", claims)
 	}
 }
 
 func TestExpiredToken(t *testing.T) {
-	secret := os.Getenv("JWT_SECRET")
-	claims := jwt.MapClaims{
+	tok := signWithTestKey(t, jwt.MapClaims{
 		"sub": "user-123",
 		"jti": "expired-jti",
 		"exp": time.Now().Add(-time.Hour).Unix(),
 		"iat": time.Now().Add(-2 * time.Hour).Unix(),
-	}
-	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
-	if err != nil {
-		t.Fatalf("sign expired token: %v", err)
-	}
+	})
 
-	_, err = token.Validate(context.Background(), tok, newMockCache())
+	_, err := newVerifier().Validate(context.Background(), tok)
 	if err == nil {
 		t.Fatal("expected error for expired token, got nil")
 	}
 }
 
 func TestTamperedSignature(t *testing.T) {
-	tok, err := token.Generate("user-123")
+	tok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate: %v", err)
 	}
 	tampered := tok[:len(tok)-4] + "xxxx"
 
-	_, err = token.Validate(context.Background(), tampered, newMockCache())
+	_, err = newVerifier().Validate(context.Background(), tampered)
 	if err == nil {
 		t.Fatal("expected error for tampered token, got nil")
 	}
 }
 
+func TestTokenCarriesKid(t *testing.T) {
+	tok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(tok, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+	if _, ok := testConfig.Keys.JWKS().Find(kid); !ok {
+		t.Fatalf("kid %q not published in JWKS", kid)
+	}
+	if parsed.Method.Alg() != token.AlgEdDSA {
+		t.Errorf("expected EdDSA, got %s", parsed.Method.Alg())
+	}
+}
+
+func TestHMACTokenRejected(t *testing.T) {
+	// An attacker who knows the public key must not be able to use it as an HMAC secret.
+	k, err := token.NewKey(testKey)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-123",
+		"jti": "forged-jti",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	forged.Header["kid"] = k.ID
+	tok, err := forged.SignedString([]byte(testKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+
+	_, err = newVerifier().Validate(context.Background(), tok)
+	if err == nil {
+		t.Fatal("expected error for HS256 token, got nil")
+	}
+}
+
+func TestUnknownKidRejected(t *testing.T) {
+	tok := signWithTestKey(t, jwt.MapClaims{
+		"sub": "user-123",
+		"jti": "unknown-kid",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	// Swap in a kid that was never published.
+	parts := strings.Split(tok, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"nope","typ":"JWT"}`))
+	tok = header + "." + parts[1] + "." + parts[2]
+
+	_, err := newVerifier().Validate(context.Background(), tok)
+	if err == nil {
+		t.Fatal("expected error for unknown kid, got nil")
+	}
+}
+
+func TestKeyPEMRoundTrip(t *testing.T) {
+	for _, alg := range []string{token.AlgRS256, token.AlgES256, token.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			k, err := token.GenerateKey(alg)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			pemBytes, err := k.MarshalPEM()
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			parsed, err := token.ParseKey(pemBytes)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if parsed.ID != k.ID || parsed.Algorithm != alg {
+				t.Errorf("round trip mismatch: got %s/%s, want %s/%s", parsed.ID, parsed.Algorithm, k.ID, alg)
+			}
+			if jwk := parsed.JWK(); jwk.Kid != k.ID || jwk.Alg != alg || jwk.Use != "sig" {
+				t.Errorf("unexpected JWK: %+v", jwk)
+			}
+		})
+	}
+}
+
 func TestRevokedToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.Generate("user-123")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate: %v", err)
 	}
 
-	if err := token.Revoke(context.Background(), tok, cache); err != nil {
+	if err := verifier.Revoke(context.Background(), tok); err != nil {
 		t.Fatalf("revoke: %v", err)
 	}
 
-	_, err = token.Validate(context.Background(), tok, cache)
+	_, err = verifier.Validate(context.Background(), tok)
 	if err == nil {
 		t.Fatal("expected error for revoked token, got nil")
 	}
@@ -117,28 +294,30 @@ func TestRevokedToken(t *testing.T) {
 
 func TestValidRefreshToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.GenerateRefresh("user-456")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.GenerateRefresh(context.Background(), token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate refresh: %v", err)
 	}
 
-	userID, err := token.ValidateRefresh(context.Background(), tok, cache)
+	claims, err := verifier.ValidateRefresh(context.Background(), tok)
 	if err != nil {
 		t.Fatalf("validate refresh: %v", err)
 	}
-	if userID != "user-456" {
-		t.Errorf("expected user-456, got %s", userID)
+	if claims.Subject != "user-456" || len(claims.Audience) != 1 || claims.Audience[0] != "api" {
+		t.Errorf("unexpected claims: %+v", claims)
 	}
 }
 
 func TestRefreshTokenRejectedAsAccessToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.GenerateRefresh("user-456")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.GenerateRefresh(context.Background(), token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate refresh: %v", err)
 	}
 
-	_, err = token.Validate(context.Background(), tok, cache)
+	_, err = verifier.Validate(context.Background(), tok)
 	if err == nil {
 		t.Fatal("expected error using refresh token as access token, got nil")
 	}
@@ -146,12 +325,13 @@ func TestRefreshTokenRejectedAsAccessToken(t *testing.T) {
 
 func TestAccessTokenRejectedAsRefreshToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.Generate("user-456")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate: %v", err)
 	}
 
-	_, err = token.ValidateRefresh(context.Background(), tok, cache)
+	_, err = verifier.ValidateRefresh(context.Background(), tok)
 	if err == nil {
 		t.Fatal("expected error using access token as refresh token, got nil")
 	}
@@ -159,16 +339,17 @@ func TestAccessTokenRejectedAsRefreshToken(t *testing.T) {
 
 func TestRevokedRefreshToken(t *testing.T) {
 	cache := newMockCache()
-	tok, err := token.GenerateRefresh("user-456")
+	verifier := token.NewVerifier(testConfig, cache)
+	tok, err := issuer.GenerateRefresh(context.Background(), token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate refresh: %v", err)
 	}
 
-	if err := token.Revoke(context.Background(), tok, cache); err != nil {
+	if err := verifier.Revoke(context.Background(), tok); err != nil {
 		t.Fatalf("revoke: %v", err)
 	}
 
-	_, err = token.ValidateRefresh(context.Background(), tok, cache)
+	_, err = verifier.ValidateRefresh(context.Background(), tok)
 	if err == nil {
 		t.Fatal("expected error for revoked refresh token, got nil")
 	}
@@ -176,19 +357,271 @@ func TestRevokedRefreshToken(t *testing.T) {
 
 func TestRotatedRefreshTokenRejected(t *testing.T) {
 	cache := newMockCache()
-	oldRefresh, err := token.GenerateRefresh("user-456")
+	verifier := token.NewVerifier(testConfig, cache)
+	oldRefresh, err := issuer.GenerateRefresh(context.Background(), token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
 	if err != nil {
 		t.Fatalf("generate refresh: %v", err)
 	}
 
 	// Simulate rotation: revoke old refresh token.
-	if err := token.Revoke(context.Background(), oldRefresh, cache); err != nil {
+	if err := verifier.Revoke(context.Background(), oldRefresh); err != nil {
 		t.Fatalf("revoke: %v", err)
 	}
 
 	// Old refresh token must no longer be usable.
-	_, err = token.ValidateRefresh(context.Background(), oldRefresh, cache)
+	_, err = verifier.ValidateRefresh(context.Background(), oldRefresh)
 	if err == nil {
 		t.Fatal("expected error reusing rotated refresh token, got nil")
 	}
 }
+
+func TestReusedRefreshTokenRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	family := token.NewFamily()
+
+	oldRefresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-456", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	// Legitimate rotation: revoke the old token, issue the next pair in the same family.
+	if err := verifier.Revoke(ctx, oldRefresh); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	newAccess, err := issuer.Generate(ctx, token.Claims{Subject: "user-456", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	newRefresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-456", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	// Replaying the rotated token is reported as reuse.
+	_, err = verifier.ValidateRefresh(ctx, oldRefresh)
+	var reuse *token.ReuseError
+	if !errors.As(err, &reuse) {
+		t.Fatalf("expected ReuseError, got %v", err)
+	}
+	if reuse.UserID != "user-456" || reuse.Family != family {
+		t.Errorf("unexpected reuse details: %+v", reuse)
+	}
+
+	// Every token in the family is now dead.
+	if _, err := verifier.ValidateRefresh(ctx, newRefresh); err == nil {
+		t.Fatal("expected newest refresh token to be revoked with its family")
+	}
+	if _, err := verifier.Validate(ctx, newAccess); err == nil {
+		t.Fatal("expected access token to be revoked with its family")
+	}
+}
+
+func TestConcurrentRotationIsReuse(t *testing.T) {
+	ctx := context.Background()
+	verifier := newVerifier()
+	refresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	// Every request validates the token before any of them rotates it, the
+	// window a check-then-revoke rotation would let all of them through.
+	const n = 8
+	grants := make([]*token.Claims, n)
+	for i := range n {
+		if grants[i], err = verifier.ValidateRefresh(ctx, refresh); err != nil {
+			t.Fatalf("validate refresh: %v", err)
+		}
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() { errs[i] = verifier.Rotate(ctx, refresh, grants[i]) })
+	}
+	wg.Wait()
+
+	rotated := 0
+	for _, err := range errs {
+		var reuse *token.ReuseError
+		switch {
+		case err == nil:
+			rotated++
+		case !errors.As(err, &reuse):
+			t.Errorf("expected ReuseError, got %v", err)
+		}
+	}
+	if rotated != 1 {
+		t.Fatalf("expected exactly one rotation to succeed, got %d", rotated)
+	}
+	if _, err := verifier.ValidateRefresh(ctx, refresh); err == nil {
+		t.Fatal("expected the family to be revoked after the race")
+	}
+}
+
+func TestFamilyRevocationLeavesOtherFamiliesAlone(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	revoked, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+	other, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	claims, err := verifier.ValidateRefresh(ctx, revoked)
+	if err != nil {
+		t.Fatalf("validate refresh: %v", err)
+	}
+	if err := verifier.RevokeFamily(ctx, claims.Family); err != nil {
+		t.Fatalf("revoke family: %v", err)
+	}
+
+	if _, err := verifier.ValidateRefresh(ctx, revoked); err == nil {
+		t.Fatal("expected revoked family to be rejected")
+	}
+	if _, err := verifier.ValidateRefresh(ctx, other); err != nil {
+		t.Fatalf("other family should still validate: %v", err)
+	}
+}
+
+func TestRevokeRejectsForgedToken(t *testing.T) {
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub": "user-123",
+		"jti": "victim-jti",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	k, err := token.NewKey(testKey)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	forged.Header["kid"] = k.ID
+	tok, err := forged.SignedString(otherKey)
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	err = verifier.Revoke(context.Background(), tok)
+	if !errors.Is(err, token.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+	if len(cache.data) != 0 {
+		t.Fatalf("forged token must not touch the blacklist, got %v", cache.data)
+	}
+}
+
+func TestRevokeExpiredTokenIsNoop(t *testing.T) {
+	tok := signWithTestKey(t, jwt.MapClaims{
+		"sub": "user-123",
+		"jti": "expired-jti",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	if err := verifier.Revoke(context.Background(), tok); err != nil {
+		t.Fatalf("revoke expired token: %v", err)
+	}
+	if len(cache.data) != 0 {
+		t.Fatalf("expired token needs no blacklist entry, got %v", cache.data)
+	}
+}
+
+func TestRevokeGrantRevokesRefreshFamily(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+	family := token.NewFamily()
+
+	access, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	refresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-123", Family: family, Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+
+	if err := verifier.RevokeGrant(ctx, refresh); err != nil {
+		t.Fatalf("revoke grant: %v", err)
+	}
+	if _, err := verifier.Validate(ctx, access); err == nil {
+		t.Fatal("expected access token to be revoked with its refresh token's family")
+	}
+}
+
+func TestClaimsRoundTrip(t *testing.T) {
+	tok, err := issuer.Generate(context.Background(), token.Claims{
+		Subject:  "user-123",
+		Audience: []string{"admin"},
+		Scopes:   []string{"read", "write"},
+		Roles:    []string{"admin"},
+		Custom:   map[string]any{"org": "acme", "sub": "spoofed"},
+	})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	claims, err := newVerifier().Validate(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.Subject != "user-123" {
+		t.Errorf("custom claims must not override sub, got %q", claims.Subject)
+	}
+	if !claims.HasScope("write") || claims.HasScope("delete") || !claims.HasRole("admin") {
+		t.Errorf("unexpected scopes or roles: %v %v", claims.Scopes, claims.Roles)
+	}
+	if claims.Custom["org"] != "acme" || len(claims.Custom) != 1 {
+		t.Errorf("unexpected custom claims: %v", claims.Custom)
+	}
+	if claims.Issuer != "https://auth.test" || claims.Audience[0] != "admin" || claims.ExpiresAt.Before(time.Now()) {
+		t.Errorf("unexpected registered claims: %+v", claims)
+	}
+}
+
+func TestGenerateRejectsForeignAudience(t *testing.T) {
+	_, err := issuer.Generate(context.Background(), token.Claims{Subject: "user-123", Audience: []string{"billing"}})
+	if !errors.Is(err, token.ErrAudienceNotAllowed) {
+		t.Fatalf("expected ErrAudienceNotAllowed, got %v", err)
+	}
+}
+
+func TestTokenRejectedByOtherTenant(t *testing.T) {
+	// Even with a shared key ring, the tenant claim keeps pools apart.
+	acme, globex := testConfig, testConfig
+	acme.Tenant, globex.Tenant = "acme", "globex"
+	cache := newMockCache()
+
+	tok, err := token.NewIssuer(acme, cache).Generate(context.Background(), token.Claims{Subject: "user-123"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	claims, err := token.NewVerifier(acme, cache).Validate(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("own tenant should accept the token: %v", err)
+	}
+	if claims.Tenant != "acme" {
+		t.Errorf("expected tenant acme, got %q", claims.Tenant)
+	}
+
+	other := token.NewVerifier(globex, cache)
+	if _, err := other.Validate(context.Background(), tok); err == nil {
+		t.Fatal("expected error validating another tenant's token, got nil")
+	}
+	if err := other.Revoke(context.Background(), tok); !errors.Is(err, token.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken revoking another tenant's token, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package token_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/token"
+)
+
+func TestRevokeUserRejectsEarlierTokens(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	access, err := issuer.Generate(ctx, token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	refresh, err := issuer.GenerateRefresh(ctx, token.Claims{Subject: "user-123", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate refresh: %v", err)
+	}
+	otherUser, err := issuer.Generate(ctx, token.Claims{Subject: "user-456", Family: token.NewFamily(), Audience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	if err := verifier.RevokeUser(ctx, "user-123"); err != nil {
+		t.Fatalf("revoke user: %v", err)
+	}
+
+	if _, err := verifier.Validate(ctx, access); err == nil {
+		t.Fatal("expected access token issued before cutoff to be rejected")
+	}
+	if _, err := verifier.ValidateRefresh(ctx, refresh); err == nil {
+		t.Fatal("expected refresh token issued before cutoff to be rejected")
+	}
+	if _, err := verifier.Validate(ctx, otherUser); err != nil {
+		t.Fatalf("other users must be unaffected: %v", err)
+	}
+}
+
+func TestRevokeUserAllowsLaterTokens(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCache()
+	verifier := token.NewVerifier(testConfig, cache)
+
+	if err := verifier.RevokeUser(ctx, "user-123"); err != nil {
+		t.Fatalf("revoke user: %v", err)
+	}
+
+	// A token from the next login, one second after the cutoff.
+	later := signWithTestKey(t, jwt.MapClaims{
+		"iss":        "https://auth.test",
+		"aud":        "api",
+		"sub":        "user-123",
+		"jti":        "later-jti",
+		"iat":        time.Now().Add(time.Second).Unix(),
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"token_type": "access",
+	})
+
+	if _, err := verifier.Validate(ctx, later); err != nil {
+		t.Fatalf("token issued after cutoff should validate: %v", err)
+	}
+}
+
+func TestRevokeUserAllowsLoginInTheSameSecond(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []string{token.FormatJWT, token.FormatPASETO, token.FormatOpaque} {
+		cache := newMockCache()
+		cfg := testConfig
+		cfg.Format = format
+		iss, verifier := token.NewIssuer(cfg, cache), token.NewVerifier(cfg, cache)
+
+		before, err := iss.Generate(ctx, token.Claims{Subject: "user-123", Audience: []string{"api"}})
+		if err != nil {
+			t.Fatalf("%s: generate: %v", format, err)
+		}
+		if err := verifier.RevokeUser(ctx, "user-123"); err != nil {
+			t.Fatalf("%s: revoke user: %v", format, err)
+		}
+		// Issued well within the second the cutoff was recorded in.
+		time.Sleep(time.Millisecond)
+		after, err := iss.Generate(ctx, token.Claims{Subject: "user-123", Audience: []string{"api"}})
+		if err != nil {
+			t.Fatalf("%s: generate: %v", format, err)
+		}
+
+		if _, err := verifier.Validate(ctx, before); err == nil {
+			t.Errorf("%s: expected the token issued before the cutoff to be rejected", format)
+		}
+		if _, err := verifier.Validate(ctx, after); err != nil {
+			t.Errorf("%s: token issued after the cutoff should validate: %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from RFC 6238 appendix B, base32 encoded.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	// RFC 6238 lists eight-digit codes; six-digit ones are their last six.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := NewSecret()
+	now := time.Unix(1_700_000_000, 0)
+	step := Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := Code(secret, step+offset)
+		got, ok := Verify(secret, code, now)
+		if !ok || got != step+offset {
+			t.Errorf("offset %d: expected step %d, got %d, %v", offset, step+offset, got, ok)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		code, _ := Code(secret, step+offset)
+		if _, ok := Verify(secret, code, now); ok {
+			t.Errorf("offset %d: expected a code outside the skew to fail", offset)
+		}
+	}
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Verify(secret, code, now); ok {
+			t.Errorf("expected %q to fail", code)
+		}
+	}
+	if _, ok := Verify("not base32!", "123456", now); ok {
+		t.Error("expected a malformed secret to fail")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Acme Corp", "jane@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Acme Corp:jane@example.com" {
+		t.Errorf("unexpected URI %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Acme Corp" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", q)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, b := NewSecret(), NewSecret()
+	if a == b {
+		t.Fatal("expected distinct secrets")
+	}
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != secretLen {
+		t.Fatalf("expected %d bytes of base32, got %d, %v", secretLen, len(key), err)
+	}
+}
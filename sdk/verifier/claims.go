@@ -0,0 +1,138 @@
+package verifier
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the contents of a verified access token.
+type Claims struct {
+	Subject   string
+	ID        string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	TokenType string
+	// Family is the issuer's session ID for the token.
+	Family string
+	// Tenant is the user pool the subject belongs to.
+	Tenant string
+	Scopes []string
+	Roles  []string
+	// KeyThumbprint is set for DPoP-bound tokens (the cnf.jkt claim).
+	KeyThumbprint string
+	// Actor is set when the token was issued by token exchange for someone
+	// acting on the subject's behalf, e.g. a support agent impersonating a
+	// customer or a service calling another for a user (the act claim).
+	Actor *Actor
+	// Custom holds any claims not listed above.
+	Custom map[string]any
+}
+
+// Actor identifies who is acting for a token's subject. Actor is the
+// party that was acting before this one, if any.
+type Actor struct {
+	Subject string
+	Actor   *Actor
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// HasRole reports whether the token carries role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "token_type", "fam", "tenant", "scope", "roles", "cnf", "act"}
+
+func claimsFromMap(m jwt.MapClaims) (*Claims, error) {
+	c := &Claims{}
+	c.Issuer, _ = m["iss"].(string)
+	c.Subject, _ = m["sub"].(string)
+	c.ID, _ = m["jti"].(string)
+	c.TokenType, _ = m["token_type"].(string)
+	c.Family, _ = m["fam"].(string)
+	c.Tenant, _ = m["tenant"].(string)
+
+	aud, err := m.GetAudience()
+	if err != nil {
+		return nil, err
+	}
+	c.Audience = aud
+	if exp, err := m.GetExpirationTime(); err != nil {
+		return nil, err
+	} else if exp != nil {
+		c.ExpiresAt = exp.Time
+	}
+	if iat, err := m.GetIssuedAt(); err != nil {
+		return nil, err
+	} else if iat != nil {
+		c.IssuedAt = iat.Time
+	}
+
+	if scope, _ := m["scope"].(string); scope != "" {
+		c.Scopes = strings.Fields(scope)
+	}
+	if raw, ok := m["roles"]; ok {
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("roles claim must be an array")
+		}
+		for _, r := range list {
+			s, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("roles claim must contain strings")
+			}
+			c.Roles = append(c.Roles, s)
+		}
+	}
+
+	if raw, ok := m["cnf"]; ok {
+		cnf, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cnf claim must be an object")
+		}
+		c.KeyThumbprint, _ = cnf["jkt"].(string)
+	}
+	if raw, ok := m["act"]; ok {
+		if c.Actor, err = actorFromMap(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range m {
+		if !slices.Contains(registeredClaims, k) {
+			if c.Custom == nil {
+				c.Custom = map[string]any{}
+			}
+			c.Custom[k] = v
+		}
+	}
+	return c, nil
+}
+
+func actorFromMap(raw any) (*Actor, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("act claim must be an object")
+	}
+	a := &Actor{}
+	if a.Subject, ok = m["sub"].(string); !ok || a.Subject == "" {
+		return nil, fmt.Errorf("act claim needs a sub")
+	}
+	if prior, ok := m["act"]; ok {
+		var err error
+		if a.Actor, err = actorFromMap(prior); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,55 @@
+package verifier
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"auth-as-a-service/sdk/dpop"
+)
+
+// proofMaxAge is how old a DPoP proof may be; proof IDs are remembered for
+// this long, plus leeway, to stop replay.
+const proofMaxAge = 5 * time.Minute
+
+// seenProofs remembers proof IDs in memory. Each instance of a service
+// keeps its own, which stops replay against that instance only.
+type seenProofs struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// add records id and reports whether it was new.
+func (s *seenProofs) add(id string, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.seen == nil {
+		s.seen = make(map[string]time.Time)
+	}
+	for k, exp := range s.seen {
+		if now.After(exp) {
+			delete(s.seen, k)
+		}
+	}
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = expires
+	return true
+}
+
+// VerifyProof checks a DPoP proof sent with accessToken and rejects proofs
+// already seen. RequireAuth calls it for every DPoP-bound token; callers of
+// Verify must do the same when Claims.KeyThumbprint is set.
+func (v *Verifier) VerifyProof(proof, method, requestURL, accessToken string) (*dpop.Proof, error) {
+	p, err := dpop.Verify(proof, method, requestURL, accessToken, proofMaxAge, v.cfg.Leeway)
+	if err != nil {
+		return nil, err
+	}
+	if !v.proofs.add(p.Thumbprint+":"+p.ID, time.Now().Add(proofMaxAge+v.cfg.Leeway)) {
+		return nil, fmt.Errorf("%w: proof already used", dpop.ErrInvalidProof)
+	}
+	return p, nil
+}
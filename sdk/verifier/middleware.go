@@ -0,0 +1,131 @@
+package verifier
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const ClaimsKey contextKey = "claims"
+
+// ClaimsFrom returns the claims RequireAuth verified for the request.
+func ClaimsFrom(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(ClaimsKey).(*Claims)
+	return claims
+}
+
+// RequireAuth rejects requests without a valid token and stores the
+// verified claims in the request context. Unbound tokens use the Bearer
+// scheme; DPoP-bound tokens use the DPoP scheme with a proof from the bound key.
+func RequireAuth(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, tokenString, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if tokenString == "" {
+				unauthorized(w)
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), tokenString)
+			if err != nil {
+				unauthorized(w)
+				return
+			}
+
+			switch {
+			case strings.EqualFold(scheme, "Bearer") && claims.KeyThumbprint == "":
+			case strings.EqualFold(scheme, "DPoP") && claims.KeyThumbprint != "":
+				proofs := r.Header.Values("DPoP")
+				if len(proofs) != 1 {
+					invalidProof(w)
+					return
+				}
+				proof, err := v.VerifyProof(proofs[0], r.Method, requestURL(r), tokenString)
+				if err != nil || proof.Thumbprint != claims.KeyThumbprint {
+					invalidProof(w)
+					return
+				}
+			default:
+				unauthorized(w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestURL returns the absolute URL the client requested, without the
+// query. The scheme comes from the connection itself.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+func invalidProof(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"invalid_dpop_proof"}`))
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"unauthorized"}`))
+}
+
+// RequireScope rejects requests whose token lacks any of scopes with 403
+// insufficient_scope. It must run after RequireAuth.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+
+			for _, s := range scopes {
+				if !claims.HasScope(s) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("WWW-Authenticate",
+						`Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(`{"error":"insufficient_scope"}`))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole rejects requests whose token does not carry role with 403.
+// It must run after RequireAuth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFrom(r.Context())
+			if claims == nil {
+				unauthorized(w)
+				return
+			}
+			if !claims.HasRole(role) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":"forbidden"}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
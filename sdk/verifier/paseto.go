@@ -0,0 +1,64 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/paseto"
+)
+
+// parsePASETO verifies a v4.public token against the JWKS key named in its
+// footer and converts its RFC 3339 times to NumericDates.
+func (v *Verifier) parsePASETO(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	raw, err := paseto.Footer(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	var footer struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(raw, &footer); err != nil {
+		return nil, fmt.Errorf("decode footer: %w", err)
+	}
+
+	k, err := v.key(ctx, footer.Kid)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s cannot verify PASETO tokens", footer.Kid)
+	}
+
+	payload, err := paseto.Verify(edPub, tokenString, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.MapClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+	for _, name := range []string{"exp", "iat", "nbf"} {
+		raw, present := claims[name]
+		if !present {
+			continue
+		}
+		s, _ := raw.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s claim must be an RFC 3339 time", name)
+		}
+		claims[name] = float64(t.Unix())
+	}
+	return claims, nil
+}
@@ -0,0 +1,107 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevocationChecker reports whether a token that passed every offline check
+// has nevertheless been revoked.
+type RevocationChecker interface {
+	Revoked(ctx context.Context, token string, claims *Claims) (bool, error)
+}
+
+// Introspection checks revocation against the issuer's RFC 7662 endpoint
+// (POST /oauth/introspect). Answers are cached per jti for CacheFor, which
+// bounds how long a revoked token keeps working.
+type Introspection struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	CacheFor     time.Duration
+	HTTPClient   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspectionResult
+}
+
+type introspectionResult struct {
+	active    bool
+	checkedAt time.Time
+	expiresAt time.Time
+}
+
+// NewIntrospection returns an Introspection checker that caches answers for 30 seconds.
+func NewIntrospection(endpoint, clientID, clientSecret string) *Introspection {
+	return &Introspection{
+		URL:          endpoint,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		CacheFor:     30 * time.Second,
+		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
+		cache:        make(map[string]introspectionResult),
+	}
+}
+
+// Revoked asks the issuer whether the token is still active.
+func (i *Introspection) Revoked(ctx context.Context, tok string, claims *Claims) (bool, error) {
+	now := time.Now()
+	i.mu.Lock()
+	res, ok := i.cache[claims.ID]
+	i.mu.Unlock()
+	if ok && now.Sub(res.checkedAt) < i.CacheFor {
+		return !res.active, nil
+	}
+
+	active, err := i.introspect(ctx, tok)
+	if err != nil {
+		return false, err
+	}
+
+	i.mu.Lock()
+	if i.cache == nil {
+		i.cache = make(map[string]introspectionResult)
+	}
+	for jti, r := range i.cache {
+		if now.After(r.expiresAt) {
+			delete(i.cache, jti)
+		}
+	}
+	i.cache[claims.ID] = introspectionResult{active: active, checkedAt: now, expiresAt: claims.ExpiresAt}
+	i.mu.Unlock()
+	return !active, nil
+}
+
+func (i *Introspection) introspect(ctx context.Context, tok string) (bool, error) {
+	form := url.Values{"token": {tok}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("build introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(i.ClientID, i.ClientSecret)
+
+	resp, err := i.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("introspect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("introspect: unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Active bool `json:"active"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, fmt.Errorf("decode introspection response: %w", err)
+	}
+	return body.Active, nil
+}
@@ -0,0 +1,244 @@
+// Package verifier checks access tokens issued by auth-as-a-service without
+// calling it on every request. Keys come from the published JWKS, which is
+// cached and refreshed in the background; revocation is optional.
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/jwk"
+	"auth-as-a-service/sdk/paseto"
+)
+
+const (
+	defaultRefreshInterval = 5 * time.Minute
+	// minRefetchInterval bounds how often an unknown kid can trigger a fetch.
+	minRefetchInterval = 30 * time.Second
+)
+
+// ErrRevoked is returned by Verify for tokens the revocation check rejects.
+var ErrRevoked = errors.New("token revoked")
+
+// Config describes the issuer a Verifier trusts.
+type Config struct {
+	// JWKSURL is the issuer's key set, e.g. https://auth.example/.well-known/jwks.json.
+	JWKSURL string
+	// Issuer must match the iss claim.
+	Issuer string
+	// Audiences lists the audiences this service accepts; the token must
+	// name at least one of them.
+	Audiences []string
+	// Tenant, if set, must match the tenant claim.
+	Tenant string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+	// RefreshInterval is how often the JWKS is refetched. Defaults to five minutes.
+	RefreshInterval time.Duration
+	// Revocation, if set, is consulted after a token passes every offline check.
+	Revocation RevocationChecker
+	// HTTPClient fetches the JWKS. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Verifier checks tokens against a cached copy of the issuer's JWKS.
+// It is safe for concurrent use.
+type Verifier struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	keys      jwk.Set
+	fetchedAt time.Time
+
+	proofs seenProofs
+
+	done chan struct{}
+}
+
+// New creates a Verifier and fetches the JWKS once, so a misconfigured URL
+// fails at startup rather than on the first request.
+func New(ctx context.Context, cfg Config) (*Verifier, error) {
+	if cfg.JWKSURL == "" || cfg.Issuer == "" || len(cfg.Audiences) == 0 {
+		return nil, fmt.Errorf("verifier needs a JWKS URL, issuer and at least one audience")
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	v := &Verifier{cfg: cfg, done: make(chan struct{})}
+	if err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Start launches the background JWKS refresh goroutine.
+func (v *Verifier) Start() {
+	go v.run()
+}
+
+// Stop signals the refresh goroutine to exit.
+func (v *Verifier) Stop() {
+	close(v.done)
+}
+
+func (v *Verifier) run() {
+	ticker := time.NewTicker(v.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			// A failed refresh keeps the last good key set.
+			if err := v.refresh(ctx); err != nil {
+				log.Printf("refresh JWKS: %v", err)
+			}
+			cancel()
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// Verify checks the token's signature, expiry, issuer and audience, rejects
+// refresh tokens, and consults the revocation check if one is configured.
+// Both JWTs and PASETO v4.public tokens are accepted. DPoP binding is not
+// checked here; see VerifyProof.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := v.verifySigned(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType == "refresh" || claims.TokenType == "id" {
+		return nil, fmt.Errorf("%s token cannot be used as access token", claims.TokenType)
+	}
+
+	if v.cfg.Revocation != nil {
+		revoked, err := v.cfg.Revocation.Revoked(ctx, tokenString, claims)
+		if err != nil {
+			return nil, fmt.Errorf("check revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+	return claims, nil
+}
+
+// VerifyIDToken checks an OpenID Connect ID token from any provider that
+// publishes a JWKS, for a relying party whose client ID is among the
+// Audiences. The nonce is in Custom for the caller to compare; revocation
+// does not apply to ID tokens.
+func (v *Verifier) VerifyIDToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := v.verifySigned(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// Other providers send no token_type; ours marks ID tokens as such.
+	if claims.TokenType != "" && claims.TokenType != "id" {
+		return nil, fmt.Errorf("%s token is not an ID token", claims.TokenType)
+	}
+	return claims, nil
+}
+
+// verifySigned runs the checks every token must pass: signature, expiry,
+// issuer, audience, subject and tenant.
+func (v *Verifier) verifySigned(ctx context.Context, tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithLeeway(v.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+
+	var mc jwt.MapClaims
+	if paseto.IsV4Public(tokenString) {
+		var err error
+		if mc, err = v.parsePASETO(ctx, tokenString); err != nil {
+			return nil, err
+		}
+		if err := jwt.NewValidator(opts...).Validate(mc); err != nil {
+			return nil, err
+		}
+	} else {
+		t, err := jwt.Parse(tokenString, v.keyFunc(ctx), opts...)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if mc, ok = t.Claims.(jwt.MapClaims); !ok || !t.Valid {
+			return nil, fmt.Errorf("invalid token")
+		}
+	}
+
+	claims, err := claimsFromMap(mc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.cfg.Audiences, aud)
+	}) {
+		return nil, fmt.Errorf("token is not intended for this audience")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("missing sub claim")
+	}
+	if v.cfg.Tenant != "" && claims.Tenant != v.cfg.Tenant {
+		return nil, fmt.Errorf("token was issued for another tenant")
+	}
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if k.Alg != "" && k.Alg != t.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return k.PublicKey()
+	}
+}
+
+// key resolves kid against the cached JWKS. An unknown kid usually means
+// the issuer rotated since the last fetch, so it triggers one refetch.
+func (v *Verifier) key(ctx context.Context, kid string) (jwk.JWK, error) {
+	k, ok := v.lookup(kid)
+	if !ok && v.mayRefetch() {
+		if err := v.refresh(ctx); err != nil {
+			return jwk.JWK{}, err
+		}
+		k, ok = v.lookup(kid)
+	}
+	if !ok {
+		return jwk.JWK{}, fmt.Errorf("unknown signing key: %v", kid)
+	}
+	return k, nil
+}
+
+func (v *Verifier) lookup(kid string) (jwk.JWK, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.keys.Find(kid)
+}
+
+func (v *Verifier) mayRefetch() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Since(v.fetchedAt) >= minRefetchInterval
+}
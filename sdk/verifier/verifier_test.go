@@ -0,0 +1,298 @@
+package verifier_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"auth-as-a-service/sdk/dpop"
+	"auth-as-a-service/sdk/jwk"
+	"auth-as-a-service/sdk/paseto"
+	"auth-as-a-service/sdk/verifier"
+)
+
+// issuer serves a JWKS for its keys and signs tokens with the newest one.
+type issuer struct {
+	keys    []ed25519.PrivateKey
+	fetches atomic.Int32
+	srv     *httptest.Server
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	iss := &issuer{}
+	iss.addKey(t)
+	iss.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		set := jwk.Set{}
+		for _, k := range iss.keys {
+			set.Keys = append(set.Keys, publicJWK(t, k))
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+func (iss *issuer) addKey(t *testing.T) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	iss.keys = append(iss.keys, priv)
+}
+
+func publicJWK(t *testing.T, k ed25519.PrivateKey) jwk.JWK {
+	t.Helper()
+	j, err := jwk.FromPublicKey(k.Public())
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+	j.Alg = "EdDSA"
+	j.Kid = jwk.Thumbprint(j)
+	return j
+}
+
+func (iss *issuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	k := iss.keys[len(iss.keys)-1]
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["kid"] = publicJWK(t, k).Kid
+	signed, err := tok.SignedString(k)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func accessClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":        "https://auth.test",
+		"aud":        "api",
+		"sub":        "user-123",
+		"jti":        "jti-1",
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"token_type": "access",
+		"scope":      "read write",
+		"roles":      []string{"admin"},
+		"org":        "acme",
+	}
+}
+
+func newVerifier(t *testing.T, iss *issuer, revocation verifier.RevocationChecker) *verifier.Verifier {
+	t.Helper()
+	v, err := verifier.New(context.Background(), verifier.Config{
+		JWKSURL:    iss.srv.URL,
+		Issuer:     "https://auth.test",
+		Audiences:  []string{"api"},
+		Leeway:     5 * time.Second,
+		Revocation: revocation,
+	})
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	return v
+}
+
+func TestVerifyReturnsTypedClaims(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	claims, err := v.Verify(context.Background(), iss.sign(t, accessClaims()))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Subject != "user-123" || !claims.HasScope("write") || !claims.HasRole("admin") || claims.Custom["org"] != "acme" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	// Upstream providers send no token_type.
+	claims := accessClaims()
+	delete(claims, "token_type")
+	claims["nonce"] = "n-1"
+	got, err := v.VerifyIDToken(context.Background(), iss.sign(t, claims))
+	if err != nil {
+		t.Fatalf("verify id token: %v", err)
+	}
+	if got.Custom["nonce"] != "n-1" {
+		t.Errorf("expected nonce in custom claims, got %+v", got.Custom)
+	}
+
+	if _, err := v.VerifyIDToken(context.Background(), iss.sign(t, accessClaims())); err == nil {
+		t.Fatal("expected access token to be rejected as ID token, got nil")
+	}
+	claims["token_type"] = "id"
+	if _, err := v.Verify(context.Background(), iss.sign(t, claims)); err == nil {
+		t.Fatal("expected ID token to be rejected as access token, got nil")
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	cases := map[string]func(jwt.MapClaims){
+		"expired":          func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"foreign issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"foreign audience": func(c jwt.MapClaims) { c["aud"] = "billing" },
+		"refresh token":    func(c jwt.MapClaims) { c["token_type"] = "refresh" },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := accessClaims()
+			mutate(claims)
+			if _, err := v.Verify(context.Background(), iss.sign(t, claims)); err == nil {
+				t.Fatal("expected verification error, got nil")
+			}
+		})
+	}
+}
+
+func TestUnknownKidTriggersRefetch(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	// The issuer rotates after the verifier cached its JWKS. The first fetch
+	// is too recent to refetch, so the new key is not yet trusted.
+	iss.addKey(t)
+	tok := iss.sign(t, accessClaims())
+	if _, err := v.Verify(context.Background(), tok); err == nil {
+		t.Fatal("expected unknown kid to be rejected within the refetch interval")
+	}
+	if n := iss.fetches.Load(); n != 1 {
+		t.Fatalf("expected a single JWKS fetch, got %d", n)
+	}
+}
+
+type revokeAll struct{ calls int }
+
+func (r *revokeAll) Revoked(context.Context, string, *verifier.Claims) (bool, error) {
+	r.calls++
+	return true, nil
+}
+
+func TestRevocationConsulted(t *testing.T) {
+	iss := newIssuer(t)
+	rev := &revokeAll{}
+	v := newVerifier(t, iss, rev)
+
+	_, err := v.Verify(context.Background(), iss.sign(t, accessClaims()))
+	if !errors.Is(err, verifier.ErrRevoked) || rev.calls != 1 {
+		t.Fatalf("expected ErrRevoked after one check, got %v (%d calls)", err, rev.calls)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	var sub string
+	h := verifier.RequireAuth(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub = verifier.ClaimsFrom(r.Context()).Subject
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+iss.sign(t, accessClaims()))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || sub != "user-123" {
+		t.Fatalf("expected 200 for user-123, got %d (%q)", rec.Code, sub)
+	}
+}
+
+func TestVerifyPASETO(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	k := iss.keys[0]
+	payload := `{"iss":"https://auth.test","aud":"api","sub":"user-123","jti":"jti-2","token_type":"access",` +
+		`"exp":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+	tok := paseto.Sign(k, []byte(payload), []byte(`{"kid":"`+publicJWK(t, k).Kid+`"}`), nil)
+
+	claims, err := v.Verify(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Subject != "user-123" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestRequireAuthDPoPBoundToken(t *testing.T) {
+	iss := newIssuer(t)
+	v := newVerifier(t, iss, nil)
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	clientJWK, err := jwk.FromPublicKey(clientKey.Public())
+	if err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+
+	claims := accessClaims()
+	claims["cnf"] = map[string]any{"jkt": jwk.Thumbprint(clientJWK)}
+	tok := iss.sign(t, claims)
+
+	var header map[string]any
+	b, _ := json.Marshal(clientJWK)
+	json.Unmarshal(b, &header)
+	proof := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": "GET",
+		"htu": "http://example.com/orders",
+		"iat": time.Now().Unix(),
+		"ath": dpop.AccessTokenHash(tok),
+	})
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = header
+	signedProof, err := proof.SignedString(clientKey)
+	if err != nil {
+		t.Fatalf("sign proof: %v", err)
+	}
+
+	h := verifier.RequireAuth(v)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(scheme, proof string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/orders", nil)
+		req.Header.Set("Authorization", scheme+" "+tok)
+		if proof != "" {
+			req.Header.Set("DPoP", proof)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("Bearer", ""); code != http.StatusUnauthorized {
+		t.Fatalf("bound token used as bearer: expected 401, got %d", code)
+	}
+	if code := serve("DPoP", signedProof); code != http.StatusOK {
+		t.Fatalf("bound token with proof: expected 200, got %d", code)
+	}
+	if code := serve("DPoP", signedProof); code != http.StatusUnauthorized {
+		t.Fatalf("replayed proof: expected 401, got %d", code)
+	}
+}